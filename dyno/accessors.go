@@ -0,0 +1,207 @@
+package dyno
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/guyvdb/dstore/fault"
+	"github.com/guyvdb/dstore/store"
+)
+
+// The typed accessors take a property name or a dotted path into nested objects
+// and lists, e.g. "address.city" or "lines.0.quantity". A property whose name
+// contains a dot is found by its full name first. Values are converted from the
+// types JSON decodes into: a whole float64 is an int64 and an RFC 3339 string
+// is a time.Time. A missing or null property is fault.ErrPropertyNotFound, a
+// value of another type fault.ErrPropertyTypeMismatch.
+
+// Lookup returns the value at path and whether it is present.
+func (do *DynamicObject) Lookup(path string) (interface{}, bool) {
+	if value, found := do.Properties[path]; found {
+		return value, value != nil
+	}
+
+	var current interface{} = do.Properties
+	for _, segment := range strings.Split(path, ".") {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			current = node[segment]
+		case []interface{}:
+			i, err := strconv.Atoi(segment)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			current = node[i]
+		default:
+			return nil, false
+		}
+		if current == nil {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// GetString returns the string at path.
+func (do *DynamicObject) GetString(path string) (string, error) {
+	value, err := do.lookupAs(path, StringProperty)
+	if err != nil {
+		return "", err
+	}
+	return value.(string), nil
+}
+
+// GetInt64 returns the integer at path.
+func (do *DynamicObject) GetInt64(path string) (int64, error) {
+	value, err := do.lookupAs(path, Int64Property)
+	if err != nil {
+		return 0, err
+	}
+	return value.(int64), nil
+}
+
+// GetFloat64 returns the number at path.
+func (do *DynamicObject) GetFloat64(path string) (float64, error) {
+	value, err := do.lookupAs(path, Float64Property)
+	if err != nil {
+		return 0, err
+	}
+	return value.(float64), nil
+}
+
+// GetBool returns the boolean at path.
+func (do *DynamicObject) GetBool(path string) (bool, error) {
+	value, err := do.lookupAs(path, BoolProperty)
+	if err != nil {
+		return false, err
+	}
+	return value.(bool), nil
+}
+
+// GetTime returns the date/time at path.
+func (do *DynamicObject) GetTime(path string) (time.Time, error) {
+	value, err := do.lookup(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, mismatch(path, DateTimeProperty, value)
+}
+
+// GetList returns the list at path. The list is not copied.
+func (do *DynamicObject) GetList(path string) ([]interface{}, error) {
+	value, err := do.lookup(path)
+	if err != nil {
+		return nil, err
+	}
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, mismatch(path, ListProperty, value)
+	}
+	return list, nil
+}
+
+// GetObject returns the nested object at path. The object is not copied.
+func (do *DynamicObject) GetObject(path string) (map[string]interface{}, error) {
+	value, err := do.lookup(path)
+	if err != nil {
+		return nil, err
+	}
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, mismatch(path, ObjectProperty, value)
+	}
+	return object, nil
+}
+
+// Decode copies the properties of the DynamicObject into the struct pointed to
+// by into, matching property names the way encoding/json matches field names.
+// It is used to promote a dynamic type to a compiled one; a Storable into keeps
+// its own Id, which must be allocated for its type, even if the properties hold
+// one.
+func (do *DynamicObject) Decode(into interface{}) error {
+	data, err := json.Marshal(do.Properties)
+	if err != nil {
+		return fmt.Errorf("%w: %w", fault.ErrMarshalFailed, err)
+	}
+
+	// Keep a copy of the Id, json.Unmarshal writes through the pointer.
+	storable, isStorable := into.(store.Storable)
+	var id *store.Id
+	if isStorable && storable.GetId() != nil {
+		copied := *storable.GetId()
+		id = &copied
+	}
+	if err := json.Unmarshal(data, into); err != nil {
+		return fmt.Errorf("%w: %w", fault.ErrUnmarshalFailed, err)
+	}
+	if isStorable {
+		storable.SetId(id)
+	}
+	return nil
+}
+
+// FromStruct creates a DynamicObject of dynamicType whose properties are the
+// fields of v as encoding/json would write them. Numbers are kept as
+// json.Number so that large integers survive. The Id of v, a property named id
+// in any case, is left out: the object has no Id yet and gets its own.
+func FromStruct(dynamicType string, v interface{}) (*DynamicObject, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", fault.ErrMarshalFailed, err)
+	}
+
+	do := NewDynamicObject(dynamicType)
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&do.Properties); err != nil {
+		return nil, fmt.Errorf("%w: %w", fault.ErrUnmarshalFailed, err)
+	}
+	if do.Properties == nil {
+		return nil, fmt.Errorf("%w: %T does not encode to a JSON object", fault.ErrTypeMismatch, v)
+	}
+	for name := range do.Properties {
+		if strings.EqualFold(name, "id") {
+			delete(do.Properties, name)
+		}
+	}
+	return do, nil
+}
+
+// lookup returns the value at path or fault.ErrPropertyNotFound.
+func (do *DynamicObject) lookup(path string) (interface{}, error) {
+	value, found := do.Lookup(path)
+	if !found {
+		return nil, fmt.Errorf("%s: %w", path, fault.ErrPropertyNotFound)
+	}
+	return value, nil
+}
+
+// lookupAs returns the scalar value at path converted to the Go type of t.
+func (do *DynamicObject) lookupAs(path string, t PropertyType) (interface{}, error) {
+	value, err := do.lookup(path)
+	if err != nil {
+		return nil, err
+	}
+	converted, ok := normalizeValue(t, value)
+	if !ok {
+		return nil, mismatch(path, t, value)
+	}
+	return converted, nil
+}
+
+func mismatch(path string, t PropertyType, value interface{}) error {
+	return fmt.Errorf("%s is a %T, not a %s: %w", path, value, t, fault.ErrPropertyTypeMismatch)
+}
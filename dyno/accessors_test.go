@@ -0,0 +1,123 @@
+package dyno_test
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/guyvdb/dstore/dyno"
+	"github.com/guyvdb/dstore/fault"
+	"github.com/guyvdb/dstore/store"
+	"github.com/guyvdb/dstore/types"
+)
+
+type Customer struct {
+	Id      *store.Id `json:"id"`
+	Name    string    `json:"name"`
+	Age     int64     `json:"age"`
+	Big     int64     `json:"big"`
+	Since   time.Time `json:"since"`
+	Address struct {
+		City string `json:"city"`
+	} `json:"address"`
+	Tags []string `json:"tags"`
+}
+
+func (c *Customer) GetId() *store.Id         { return c.Id }
+func (c *Customer) SetId(id *store.Id)       { c.Id = id }
+func (c *Customer) GetTypeName() string      { return "Customer" }
+func (c *Customer) Marshal() ([]byte, error) { return json.Marshal(c) }
+func (c *Customer) Unmarshal(d []byte) error { return json.Unmarshal(d, c) }
+
+func newCustomer() *Customer {
+	c := &Customer{Id: store.NewId(2000, 1), Name: "ann", Age: 40, Big: 1<<62 + 1, Since: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), Tags: []string{"a", "b"}}
+	c.Address.City = "Paris"
+	return c
+}
+
+func TestAccessors(t *testing.T) {
+	r := types.NewSystemRegistry()
+	dyno.Register(r)
+	dyno.Index(r, "Customer", "address.city", store.StringIndex, store.NonUniqueIndex)
+	s, err := types.OpenBoltStore(filepath.Join(t.TempDir(), "db"), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	c := newCustomer()
+	do, err := dyno.FromStruct("Customer", c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AllocateId(do); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(do); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := s.Get(do.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := stored.(*dyno.DynamicObject)
+
+	if v, err := o.GetInt64("age"); err != nil || v != 40 {
+		t.Errorf("GetInt64(age) = %d, %v; want 40", v, err)
+	}
+	if v, err := o.GetString("address.city"); err != nil || v != "Paris" {
+		t.Errorf("GetString(address.city) = %q, %v; want Paris", v, err)
+	}
+	if v, err := o.GetString("tags.1"); err != nil || v != "b" {
+		t.Errorf("GetString(tags.1) = %q, %v; want b", v, err)
+	}
+	if v, err := o.GetTime("since"); err != nil || !v.Equal(c.Since) {
+		t.Errorf("GetTime(since) = %v, %v; want %v", v, err, c.Since)
+	}
+	if _, err := o.GetInt64("name"); !errors.Is(err, fault.ErrPropertyTypeMismatch) {
+		t.Errorf("GetInt64(name) returned %v, want %v", err, fault.ErrPropertyTypeMismatch)
+	}
+	if _, err := o.GetInt64("nope.x"); !errors.Is(err, fault.ErrPropertyNotFound) {
+		t.Errorf("GetInt64(nope.x) returned %v, want %v", err, fault.ErrPropertyNotFound)
+	}
+
+	found, err := s.Match(dyno.IndexName("Customer", "address.city"), "Paris")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 {
+		t.Errorf("Match found %d objects, want 1", len(found))
+	}
+}
+
+// TestStructRoundTripKeepsIds converts a struct with an Id to a DynamicObject
+// and back, checking that neither takes the other's Id.
+func TestStructRoundTripKeepsIds(t *testing.T) {
+	c := newCustomer()
+	do, err := dyno.FromStruct("Customer", c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, found := do.Properties["id"]; found {
+		t.Errorf("FromStruct copied the Id into the properties: %v", do.Properties)
+	}
+	if do.Id != nil {
+		t.Errorf("FromStruct gave the object Id %s, want none", do.Id)
+	}
+
+	do.Id = store.NewId(1005, 7)
+	do.SetProperty("id", map[string]interface{}{"type_id": 1, "object_id": 1}) // As stored by older versions
+
+	back := &Customer{Id: store.NewId(2000, 9)}
+	if err := do.Decode(back); err != nil {
+		t.Fatal(err)
+	}
+	if back.Id.String() != store.NewId(2000, 9).String() {
+		t.Errorf("Decode changed the Id to %s, want %s", back.Id, store.NewId(2000, 9))
+	}
+	if back.Big != c.Big || back.Address.City != "Paris" || !back.Since.Equal(c.Since) {
+		t.Errorf("Decode = %+v, want the properties of %+v", back, c)
+	}
+}
@@ -2,6 +2,7 @@ package dyno
 
 import (
 	"encoding/json"
+	"strings"
 
 	"github.com/guyvdb/dstore/store"
 	"github.com/guyvdb/dstore/types"
@@ -10,6 +11,7 @@ import (
 const DYNAMIC_OBJECT_TYPE_NAME string = "DynamicObject"
 
 var _ store.Storable = (*DynamicObject)(nil)
+var _ store.PropertySource = (*DynamicObject)(nil)
 
 type DynamicObject struct {
 	Id          *store.Id              `json:"id"`
@@ -17,14 +19,61 @@ type DynamicObject struct {
 	Properties  map[string]interface{} `json:"properties"`
 }
 
-func init() {
-	types.GetRegistry().Register(DYNAMIC_OBJECT_TYPE_NAME, dynamicObjectFactory)
+// Register registers the DynamicObject type with r. It must be called before
+// the registry is loaded. Every DynamicType is a registry type of its own, named
+// by TypeName, with its own bucket and id sequence. A dynamic type is registered
+// when the first object of it is stored; use RegisterType to declare one up
+// front. Objects stored under the plain DynamicObject type by earlier versions
+// are moved to the types of their DynamicTypes on Load, with new Ids that
+// MovedId maps their old Ids to.
+func Register(r types.Registry) {
+	r.Register(DYNAMIC_OBJECT_TYPE_NAME, dynamicObjectFactory)
+	r.RegisterFamily(DYNAMIC_OBJECT_TYPE_NAME+".", dynamicTypeFactory)
+	r.OnLoad(moveLegacyObjects(r))
+}
+
+// RegisterType registers a dynamic type with r, before or after the registry is
+// loaded.
+func RegisterType(r types.Registry, dynamicType string) error {
+	typeName := TypeName(dynamicType)
+	return r.AddType(typeName, func() store.Storable {
+		return dynamicTypeFactory(typeName)
+	})
+}
+
+// TypeName returns the registry type name of a dynamic type, e.g. for
+// store.GetAllByTypeName(dyno.TypeName("Invoice")).
+func TypeName(dynamicType string) string {
+	return DYNAMIC_OBJECT_TYPE_NAME + "." + dynamicType
+}
+
+// Index declares an index on a property of the objects of one DynamicType.
+// Objects without the property are not indexed. Property values are coerced from
+// the types JSON decodes into, e.g. a float64 for an Int64Index or an RFC 3339
+// string for a DateTimeIndex. It must be called before the registry is loaded.
+// Use IndexName to query the index.
+func Index(r types.Registry, dynamicType string, property string, dataType store.IndexDataType, indexType store.IndexType) {
+	typeName := TypeName(dynamicType)
+	r.Register(typeName, func() store.Storable {
+		return dynamicTypeFactory(typeName)
+	})
+	r.Index(typeName, property, dataType, indexType)
+}
+
+// IndexName returns the name under which an index declared with Index is
+// queried, e.g. store.Match(dyno.IndexName("Invoice", "Number"), 1001).
+func IndexName(dynamicType string, property string) string {
+	return TypeName(dynamicType) + "." + property
 }
 
 func dynamicObjectFactory() store.Storable {
 	return &DynamicObject{}
 }
 
+func dynamicTypeFactory(typeName string) store.Storable {
+	return &DynamicObject{DynamicType: strings.TrimPrefix(typeName, DYNAMIC_OBJECT_TYPE_NAME+".")}
+}
+
 func NewDynamicObject(dynamicTypeName string) *DynamicObject {
 	return &DynamicObject{
 		DynamicType: dynamicTypeName,
@@ -42,9 +91,13 @@ func (do *DynamicObject) SetId(id *store.Id) {
 	do.Id = id
 }
 
-// GetTypeName returns the type name of the DynamicObject.
+// GetTypeName returns the registry type name of the DynamicObject's
+// DynamicType, or DynamicObject if it has none.
 func (do *DynamicObject) GetTypeName() string {
-	return DYNAMIC_OBJECT_TYPE_NAME
+	if do.DynamicType == "" {
+		return DYNAMIC_OBJECT_TYPE_NAME
+	}
+	return TypeName(do.DynamicType)
 }
 
 // Marshal serializes the DynamicObject to a byte slice.
@@ -64,3 +117,10 @@ func (do *DynamicObject) SetProperty(name string, value interface{}) {
 func (do *DynamicObject) GetProperty(name string) interface{} {
 	return do.Properties[name]
 }
+
+// IndexableProperty implements store.PropertySource. name may be a path into
+// nested objects, as for Lookup. Only objects that hold a non-nil value for the
+// property have one.
+func (do *DynamicObject) IndexableProperty(name string) (interface{}, bool) {
+	return do.Lookup(name)
+}
@@ -0,0 +1,159 @@
+package dyno_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/guyvdb/dstore/dyno"
+	"github.com/guyvdb/dstore/store"
+	"github.com/guyvdb/dstore/types"
+)
+
+// openDyno opens the store at path with the dyno types registered and an index
+// on the Number of Invoices.
+func openDyno(t *testing.T, path string) store.Store {
+	t.Helper()
+	r := types.NewSystemRegistry()
+	dyno.Register(r)
+	dyno.Index(r, "Invoice", "number", store.Int64Index, store.UniqueIndex)
+	s, err := types.OpenBoltStore(path, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestDynamicIndexes(t *testing.T) {
+	r := types.NewSystemRegistry()
+	dyno.Register(r)
+	dyno.Index(r, "Invoice", "Number", store.Int64Index, store.UniqueIndex)
+	dyno.Index(r, "Invoice", "Due", store.DateTimeIndex, store.NonUniqueIndex)
+	dyno.Index(r, "Invoice", "Total", store.Float64Index, store.NonUniqueIndex)
+	s, err := types.OpenBoltStore(filepath.Join(t.TempDir(), "db"), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// Properties hold what encoding/json decodes into, or what callers set.
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		d := dyno.NewDynamicObject("Invoice")
+		d.SetProperty("Number", float64(1000+i))
+		d.SetProperty("Due", base.AddDate(0, 0, i).Format(time.RFC3339))
+		d.SetProperty("Total", i*10)
+		if err := s.AllocateId(d); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Put(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Indexes of one dynamic type do not apply to another.
+	c := dyno.NewDynamicObject("Customer")
+	c.SetProperty("Number", "not a number")
+	if err := s.AllocateId(c); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(c); err != nil {
+		t.Fatalf("Put of a Customer with a Number Invoices index as Int64: %v", err)
+	}
+
+	if found, err := s.Match(dyno.IndexName("Invoice", "Number"), 1002); err != nil || len(found) != 1 {
+		t.Errorf("Match on Number found %d, %v; want 1", len(found), err)
+	}
+	if found, err := s.Range(dyno.IndexName("Invoice", "Due"), base.AddDate(0, 0, 1), base.AddDate(0, 0, 3), nil); err != nil || len(found) != 3 {
+		t.Errorf("Range on Due found %d, %v; want 3", len(found), err)
+	}
+	if found, err := s.Range(dyno.IndexName("Invoice", "Total"), 15, nil, nil); err != nil || len(found) != 3 {
+		t.Errorf("Range on Total found %d, %v; want 3", len(found), err)
+	}
+	if report, err := s.VerifyIndexes(dyno.TypeName("Invoice")); err != nil || !report.OK() {
+		t.Errorf("VerifyIndexes = %+v, %v", report, err)
+	}
+}
+
+// TestDynamicTypes checks that each dynamic type has its own bucket and id
+// space, that types created by a rolled back transaction do not survive, and
+// that types are kept across restarts.
+func TestDynamicTypes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	s := openDyno(t, path)
+	r := s.TypeManager().(types.Registry)
+
+	var ids []*store.Id
+	for i := 0; i < 3; i++ {
+		for _, dynamicType := range []string{"Invoice", "Customer", "Order"} {
+			d := dyno.NewDynamicObject(dynamicType)
+			d.SetProperty("number", i)
+			if err := s.AllocateId(d); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Put(d); err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, d.Id)
+		}
+	}
+	if ids[0].TypeId == ids[1].TypeId || ids[0].ObjectId != ids[1].ObjectId {
+		t.Errorf("an Invoice has Id %s and a Customer %s, want different types with their own ids", ids[0], ids[1])
+	}
+	customers, err := s.GetAllByTypeName(dyno.TypeName("Customer"))
+	if err != nil || len(customers) != 3 {
+		t.Fatalf("GetAll of Customers found %d, %v; want 3", len(customers), err)
+	}
+	if got := customers[0].(*dyno.DynamicObject).DynamicType; got != "Customer" {
+		t.Errorf("DynamicType of a Customer read back = %q", got)
+	}
+	if found, err := s.Match(dyno.IndexName("Invoice", "number"), 2); err != nil || len(found) != 1 {
+		t.Errorf("Match on the Invoice index found %d, %v; want 1", len(found), err)
+	}
+
+	failure := errors.New("failure")
+	err = s.Update(func(tx store.Tx) error {
+		if err := tx.AllocateId(dyno.NewDynamicObject("Ghost")); err != nil {
+			return err
+		}
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("Update returned %v, want %v", err, failure)
+	}
+	if _, err := r.GetTypeId(dyno.TypeName("Ghost")); err == nil {
+		t.Error("a type created in a rolled back transaction survived")
+	}
+
+	if err := dyno.RegisterType(r, "Supplier"); err != nil {
+		t.Fatal(err)
+	}
+	supplierId, err := r.GetTypeId(dyno.TypeName("Supplier"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s = openDyno(t, path)
+	r = s.TypeManager().(types.Registry)
+	if id, err := r.GetTypeId(dyno.TypeName("Supplier")); err != nil || id != supplierId {
+		t.Errorf("Supplier type id after restart = %d, %v; want %d", id, err, supplierId)
+	}
+	if n, err := s.DeleteAllByTypeName(dyno.TypeName("Order")); err != nil || n != 3 {
+		t.Errorf("DeleteAllByTypeName(Order) = %d, %v; want 3", n, err)
+	}
+	if _, err := s.Get(ids[0]); err != nil {
+		t.Errorf("Get of an Invoice after deleting the Orders: %v", err)
+	}
+	d := dyno.NewDynamicObject("Customer")
+	if err := s.AllocateId(d); err != nil {
+		t.Fatal(err)
+	}
+	if d.Id.ObjectId <= ids[7].ObjectId {
+		t.Errorf("new Customer got id %s, which was used before the restart", d.Id)
+	}
+}
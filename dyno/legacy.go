@@ -0,0 +1,183 @@
+package dyno
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/guyvdb/dstore/store"
+	"github.com/guyvdb/dstore/types"
+)
+
+// legacyMovedKey records in the store's Meta that the objects of earlier
+// versions have been moved, so that later loads do not look for them again.
+const legacyMovedKey = "dyno.legacyMoved"
+
+// movedIdPrefix prefixes the Meta keys that map the old Id of a moved object,
+// in its string form, to its new Id.
+const movedIdPrefix = "dyno.movedId."
+
+// legacyBatchSize is the number of objects moveLegacyObjects reads at a time.
+const legacyBatchSize = 1000
+
+// moveLegacyObjects returns the load hook that moves the objects earlier
+// versions stored under the plain DynamicObject type into the registry types of
+// their DynamicTypes, where they are indexed by the indexes of those types.
+// Moved objects are given new Ids, which MovedId maps their old Ids to, and
+// ReferenceProperty values declared by the schemas of their types are rewritten
+// to the new Ids. Objects without a DynamicType stay where they are. The move
+// runs once per store.
+func moveLegacyObjects(r types.Registry) func(tx store.Tx) error {
+	return func(tx store.Tx) error {
+		if done, err := tx.Meta(legacyMovedKey); err != nil || done != nil {
+			return err
+		}
+
+		// Every object gets its new Id before any is moved, so that references
+		// between moved objects can be rewritten.
+		err := eachLegacyObject(tx, func(old *DynamicObject) error {
+			do := &DynamicObject{DynamicType: old.DynamicType}
+			if err := tx.AllocateId(do); err != nil {
+				return fmt.Errorf("failed to move DynamicObject %s to %s: %w", old.Id, do.GetTypeName(), err)
+			}
+			return tx.SetMeta(movedIdPrefix+old.Id.String(), do.Id.Bytes())
+		})
+		if err != nil {
+			return err
+		}
+
+		moved := 0
+		err = eachLegacyObject(tx, func(old *DynamicObject) error {
+			id, err := MovedId(tx, old.Id)
+			if err != nil {
+				return err
+			}
+			do := &DynamicObject{Id: id, DynamicType: old.DynamicType, Properties: old.Properties}
+			if data := r.Schema(id.TypeId); data != nil {
+				schema, err := cachedSchema(do.GetTypeName(), data)
+				if err != nil {
+					return err
+				}
+				if err := rewriteReferences(tx, do.Properties, schema.Properties); err != nil {
+					return fmt.Errorf("failed to move DynamicObject %s to %s: %w", old.Id, do.GetTypeName(), err)
+				}
+			}
+
+			if err := tx.Delete(old.Id); err != nil {
+				return fmt.Errorf("failed to move DynamicObject %s to %s: %w", old.Id, do.GetTypeName(), err)
+			}
+			if err := tx.Put(do); err != nil {
+				return fmt.Errorf("failed to move DynamicObject %s to %s: %w", old.Id, do.GetTypeName(), err)
+			}
+			slog.Debug("dyno: Moved DynamicObject to its dynamic type", "from", old.Id.String(), "to", do.Id.String())
+			moved++
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if moved > 0 {
+			slog.Info("dyno: Moved DynamicObjects stored under the DynamicObject type to their dynamic types", "objects", moved)
+		}
+		return tx.SetMeta(legacyMovedKey, []byte{1})
+	}
+}
+
+// MovedId returns the Id that Load gave the object an earlier version stored
+// at id under the plain DynamicObject type, when it moved the object to the
+// type of its DynamicType. It returns id itself for objects that were not
+// moved. References to moved objects held outside their schemas, for example
+// by other types, can be followed with it.
+func MovedId(tx store.Tx, id *store.Id) (*store.Id, error) {
+	data, err := tx.Meta(movedIdPrefix + id.String())
+	if err != nil || data == nil {
+		return id, err
+	}
+	return store.IdFromBytes(data)
+}
+
+// eachLegacyObject calls fn for every object stored under the plain
+// DynamicObject type that has a DynamicType, reading them a page at a time. fn
+// may delete the object it is given.
+func eachLegacyObject(tx store.Tx, fn func(old *DynamicObject) error) error {
+	var after *store.Id
+	for {
+		page, err := tx.GetPage(DYNAMIC_OBJECT_TYPE_NAME, after, legacyBatchSize)
+		if err != nil {
+			return err
+		}
+		for _, item := range page.Items {
+			old := item.(*DynamicObject)
+			after = old.Id
+			if old.DynamicType == "" {
+				continue
+			}
+			if err := fn(old); err != nil {
+				return err
+			}
+		}
+		if page.Next == "" {
+			return nil
+		}
+	}
+}
+
+// rewriteReferences replaces the ReferenceProperty values in fields that refer
+// to moved objects with their new Ids, descending into lists and objects.
+func rewriteReferences(tx store.Tx, fields map[string]interface{}, properties []*Property) error {
+	for _, p := range properties {
+		value, found := fields[p.Name]
+		if !found || value == nil {
+			continue
+		}
+		rewritten, err := p.rewriteReference(tx, value)
+		if err != nil {
+			return err
+		}
+		fields[p.Name] = rewritten
+	}
+	return nil
+}
+
+// rewriteReference returns value with the references it holds to moved objects
+// replaced by their new Ids. References keep the string form if they had it.
+func (p *Property) rewriteReference(tx store.Tx, value interface{}) (interface{}, error) {
+	switch p.Type {
+	case ReferenceProperty:
+		ref, ok := normalizeValue(ReferenceProperty, value)
+		if !ok {
+			return value, nil
+		}
+		id := ref.(store.Id)
+		moved, err := MovedId(tx, &id)
+		if err != nil || *moved == id {
+			return value, err
+		}
+		if _, ok := value.(string); ok {
+			return moved.String(), nil
+		}
+		return moved, nil
+
+	case ListProperty:
+		list, ok := value.([]interface{})
+		if !ok || p.Items == nil {
+			return value, nil
+		}
+		for i, element := range list {
+			if element == nil {
+				continue
+			}
+			rewritten, err := p.Items.rewriteReference(tx, element)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = rewritten
+		}
+
+	case ObjectProperty:
+		if fields, ok := value.(map[string]interface{}); ok {
+			return value, rewriteReferences(tx, fields, p.Properties)
+		}
+	}
+	return value, nil
+}
@@ -0,0 +1,215 @@
+package dyno_test
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/guyvdb/dstore/dyno"
+	"github.com/guyvdb/dstore/fault"
+	"github.com/guyvdb/dstore/store"
+	"github.com/guyvdb/dstore/types"
+)
+
+// legacyObject is a DynamicObject as versions before per-type buckets stored
+// it.
+type legacyObject struct {
+	dynamicType string
+	properties  map[string]interface{}
+}
+
+// storeLegacy stores objects under the plain DynamicObject type in the store at
+// path, as versions before per-type buckets did, and returns their Ids.
+func storeLegacy(t *testing.T, path string, objects []legacyObject) []*store.Id {
+	t.Helper()
+	r := types.NewSystemRegistry()
+	r.Register(dyno.DYNAMIC_OBJECT_TYPE_NAME, func() store.Storable { return &dyno.DynamicObject{} })
+	s, err := types.OpenBoltStore(path, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	var ids []*store.Id
+	for _, l := range objects {
+		do := &dyno.DynamicObject{Properties: l.properties}
+		if err := s.AllocateId(do); err != nil {
+			t.Fatal(err)
+		}
+		do.DynamicType = l.dynamicType
+		if err := s.Put(do); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, do.Id)
+	}
+	return ids
+}
+
+// movedId returns the new Id of the object stored at id by an earlier version.
+func movedId(t *testing.T, s store.Store, id *store.Id) *store.Id {
+	t.Helper()
+	var moved *store.Id
+	err := s.View(func(tx store.Tx) error {
+		var err error
+		moved, err = dyno.MovedId(tx, id)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return moved
+}
+
+// refId returns the string form of a reference read back from the store, which
+// holds either the string form or a decoded store.Id.
+func refId(t *testing.T, value interface{}) string {
+	t.Helper()
+	if s, ok := value.(string); ok {
+		return s
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var id store.Id
+	if err := json.Unmarshal(data, &id); err != nil {
+		t.Fatalf("reference %v: %v", value, err)
+	}
+	return id.String()
+}
+
+// TestLegacyObjectsMoveToTheirTypes stores DynamicObjects under the plain
+// DynamicObject type, as versions before per-type buckets did, and checks that
+// Load moves them to the types of their DynamicTypes: Invoice, which is
+// declared with an index, and Note, which is not.
+func TestLegacyObjectsMoveToTheirTypes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	legacyIds := storeLegacy(t, path, []legacyObject{
+		{"Invoice", map[string]interface{}{"number": 1001.0}},
+		{"Invoice", map[string]interface{}{"number": 1002.0}},
+		{"Note", map[string]interface{}{"text": "hello"}},
+		{"", map[string]interface{}{"text": "untyped"}},
+	})
+
+	s := openDyno(t, path)
+
+	invoices, err := s.GetAllByTypeName(dyno.TypeName("Invoice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(invoices) != 2 {
+		t.Fatalf("found %d Invoices, want 2", len(invoices))
+	}
+	notes, err := s.GetAllByTypeName(dyno.TypeName("Note"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notes) != 1 || notes[0].(*dyno.DynamicObject).GetProperty("text") != "hello" {
+		t.Fatalf("found Notes %v, want the one legacy Note", notes)
+	}
+	untyped, err := s.GetAllByTypeName(dyno.DYNAMIC_OBJECT_TYPE_NAME)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(untyped) != 1 || untyped[0].GetId().String() != legacyIds[3].String() {
+		t.Fatalf("found %v under DynamicObject, want only the untyped object", untyped)
+	}
+	if _, err := s.Get(legacyIds[0]); !errors.Is(err, fault.ErrKeyNotFound) {
+		t.Errorf("Get of a moved object's legacy id returned %v, want %v", err, fault.ErrKeyNotFound)
+	}
+	if got := movedId(t, s, legacyIds[2]); got.String() != notes[0].GetId().String() {
+		t.Errorf("MovedId of the legacy Note = %s, want its new Id %s", got, notes[0].GetId())
+	}
+	if got := movedId(t, s, legacyIds[3]); got.String() != legacyIds[3].String() {
+		t.Errorf("MovedId of the untyped object = %s, want its own Id", got)
+	}
+
+	found, err := s.Match(dyno.IndexName("Invoice", "number"), 1002)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 {
+		t.Fatalf("Match found %d Invoices, want 1", len(found))
+	}
+
+	// A moved object is updated in its new type.
+	invoice := found[0].(*dyno.DynamicObject)
+	invoice.SetProperty("number", 2002)
+	if err := s.Put(invoice); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Loading again moves nothing.
+	s = openDyno(t, path)
+	if invoices, err = s.GetAllByTypeName(dyno.TypeName("Invoice")); err != nil || len(invoices) != 2 {
+		t.Fatalf("found %d Invoices after reopening, %v; want 2", len(invoices), err)
+	}
+	if found, err = s.Match(dyno.IndexName("Invoice", "number"), 2002); err != nil || len(found) != 1 {
+		t.Fatalf("Match found %d updated Invoices, %v; want 1", len(found), err)
+	}
+	if got := movedId(t, s, legacyIds[2]); got.String() != notes[0].GetId().String() {
+		t.Errorf("MovedId of the legacy Note after reopening = %s, want %s", got, notes[0].GetId())
+	}
+}
+
+// TestLegacyReferencesFollowMovedObjects checks that the ReferenceProperty
+// values of moved objects are rewritten to the new Ids of the objects they
+// refer to, in string and in decoded form, in lists and nested objects.
+func TestLegacyReferencesFollowMovedObjects(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	legacyIds := storeLegacy(t, path, []legacyObject{
+		{"Customer", map[string]interface{}{"name": "ann"}},
+		{"Customer", map[string]interface{}{"name": "bob"}},
+	})
+	ann, bob := legacyIds[0], legacyIds[1]
+	stranger := store.NewId(ann.TypeId, 999)
+	invoiceId := storeLegacy(t, path, []legacyObject{{"Invoice", map[string]interface{}{
+		"customer": ann.String(),
+		"lines": []interface{}{
+			map[string]interface{}{"product": "p1", "buyer": map[string]interface{}{"type_id": bob.TypeId, "object_id": bob.ObjectId}},
+			map[string]interface{}{"product": "p2", "buyer": stranger.String()},
+		},
+		"note": ann.String(),
+	}}})[0]
+
+	r := types.NewSystemRegistry()
+	dyno.Register(r)
+	err := dyno.DefineType(r, "Invoice", &dyno.Schema{Open: true, Properties: []*dyno.Property{
+		{Name: "customer", Type: dyno.ReferenceProperty},
+		{Name: "lines", Type: dyno.ListProperty, Items: &dyno.Property{Type: dyno.ObjectProperty, Open: true, Properties: []*dyno.Property{
+			{Name: "buyer", Type: dyno.ReferenceProperty},
+		}}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := types.OpenBoltStore(path, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	newAnn, newBob := movedId(t, s, ann), movedId(t, s, bob)
+	got, err := s.Get(movedId(t, s, invoiceId))
+	if err != nil {
+		t.Fatal(err)
+	}
+	invoice := got.(*dyno.DynamicObject)
+	if customer := refId(t, invoice.GetProperty("customer")); customer != newAnn.String() {
+		t.Errorf("customer = %s, want the new Id of ann %s", customer, newAnn)
+	}
+	lines := invoice.GetProperty("lines").([]interface{})
+	if buyer := refId(t, lines[0].(map[string]interface{})["buyer"]); buyer != newBob.String() {
+		t.Errorf("buyer of the first line = %s, want the new Id of bob %s", buyer, newBob)
+	}
+	if other := refId(t, lines[1].(map[string]interface{})["buyer"]); other != stranger.String() {
+		t.Errorf("buyer of the second line = %s, want the reference to an object that was never stored kept", other)
+	}
+	if note := invoice.GetProperty("note"); note != ann.String() {
+		t.Errorf("note = %v, want the undeclared property left alone", note)
+	}
+}
@@ -0,0 +1,409 @@
+package dyno
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/guyvdb/dstore/fault"
+	"github.com/guyvdb/dstore/store"
+	"github.com/guyvdb/dstore/types"
+)
+
+var _ store.Validatable = (*DynamicObject)(nil)
+
+// PropertyType is the type of a property in a dynamic type schema.
+type PropertyType string
+
+const (
+	StringProperty    PropertyType = "string"
+	Int64Property     PropertyType = "int64"
+	Float64Property   PropertyType = "float64"
+	BoolProperty      PropertyType = "bool"
+	DateTimeProperty  PropertyType = "datetime"  // A time.Time or an RFC 3339 string
+	ReferenceProperty PropertyType = "reference" // A store.Id or its string form
+	ListProperty      PropertyType = "list"
+	ObjectProperty    PropertyType = "object" // A nested map[string]interface{}
+)
+
+// Schema describes the properties of a dynamic type. Objects holding properties
+// the schema does not declare are rejected unless Open is set.
+type Schema struct {
+	Properties []*Property `json:"properties"`
+	Open       bool        `json:"open,omitempty"`
+}
+
+// Property describes one property of a dynamic type or of a nested object.
+type Property struct {
+	Name     string        `json:"name"`
+	Type     PropertyType  `json:"type"`
+	Required bool          `json:"required,omitempty"`
+	Default  interface{}   `json:"default,omitempty"` // Set on Put when the property is absent
+	Enum     []interface{} `json:"enum,omitempty"`    // The values a scalar property may take, if not empty
+
+	// Items describes the elements of a ListProperty. A nil Items allows any
+	// elements.
+	Items *Property `json:"items,omitempty"`
+
+	// Properties and Open describe the fields of an ObjectProperty the way
+	// Schema does. An object without Properties may hold anything.
+	Properties []*Property `json:"properties,omitempty"`
+	Open       bool        `json:"open,omitempty"`
+}
+
+// Violation is a property of an object that does not conform to its schema.
+// Path names nested properties and list elements, e.g. "Lines[2].Quantity".
+type Violation struct {
+	Path    string
+	Message string
+}
+
+// ValidationError lists every violation found in an object. It matches
+// fault.ErrValidationFailed with errors.Is.
+type ValidationError struct {
+	DynamicType string
+	Id          *store.Id
+	Violations  []Violation
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s for %s", fault.ErrValidationFailed, TypeName(e.DynamicType))
+	if e.Id != nil {
+		fmt.Fprintf(&b, " %s", e.Id)
+	}
+	for i, v := range e.Violations {
+		if i == 0 {
+			b.WriteString(": ")
+		} else {
+			b.WriteString("; ")
+		}
+		fmt.Fprintf(&b, "%s %s", v.Path, v.Message)
+	}
+	return b.String()
+}
+
+func (e *ValidationError) Unwrap() error {
+	return fault.ErrValidationFailed
+}
+
+// DefineType registers dynamicType with r if needed and sets its schema, before
+// or after the registry is loaded. The schema is persisted in the registry, so
+// it only has to be defined again to change it.
+func DefineType(r types.Registry, dynamicType string, schema *Schema) error {
+	if err := schema.check(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(schema)
+	if err != nil {
+		return err
+	}
+	if err := RegisterType(r, dynamicType); err != nil {
+		return err
+	}
+	return r.SetSchema(TypeName(dynamicType), data)
+}
+
+// TypeSchema returns the schema of a loaded dynamic type, or nil if it has
+// none.
+func TypeSchema(r types.Registry, dynamicType string) (*Schema, error) {
+	typeId, err := r.GetTypeId(TypeName(dynamicType))
+	if err != nil {
+		return nil, err
+	}
+	data := r.Schema(typeId)
+	if data == nil {
+		return nil, nil
+	}
+	return parseSchema(data)
+}
+
+// Validate implements store.Validatable. Absent properties that have a default
+// are set to it, then every property is checked against the schema.
+func (do *DynamicObject) Validate(data []byte) error {
+	schema, err := cachedSchema(do.GetTypeName(), data)
+	if err != nil {
+		return err
+	}
+	if do.Properties == nil {
+		do.Properties = make(map[string]interface{})
+	}
+
+	var violations []Violation
+	validateFields(do.Properties, schema.Properties, schema.Open, "", &violations)
+	if len(violations) > 0 {
+		return &ValidationError{DynamicType: do.DynamicType, Id: do.Id, Violations: violations}
+	}
+	return nil
+}
+
+// parsedSchema is a schema parsed by cachedSchema and the JSON it was parsed
+// from.
+type parsedSchema struct {
+	data   []byte
+	schema *Schema
+}
+
+// parsedSchemas caches the parsed schema of each dynamic type by its type name,
+// as schemas are consulted on every Put.
+var parsedSchemas sync.Map
+
+// cachedSchema parses the schema of typeName, reusing the cached one as long as
+// data has not changed.
+func cachedSchema(typeName string, data []byte) (*Schema, error) {
+	if cached, found := parsedSchemas.Load(typeName); found && bytes.Equal(cached.(*parsedSchema).data, data) {
+		return cached.(*parsedSchema).schema, nil
+	}
+	schema, err := parseSchema(data)
+	if err != nil {
+		return nil, err
+	}
+	parsedSchemas.Store(typeName, &parsedSchema{data: bytes.Clone(data), schema: schema})
+	return schema, nil
+}
+
+func parseSchema(data []byte) (*Schema, error) {
+	schema := &Schema{}
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.UseNumber()
+	if err := decoder.Decode(schema); err != nil {
+		return nil, fmt.Errorf("%w: %w", fault.ErrInvalidSchema, err)
+	}
+	if err := schema.check(); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+// check reports schema definitions that cannot be validated against.
+func (s *Schema) check() error {
+	return checkProperties(s.Properties, "")
+}
+
+func checkProperties(properties []*Property, prefix string) error {
+	seen := make(map[string]bool)
+	for _, p := range properties {
+		path := prefix + p.Name
+		if p.Name == "" {
+			return fmt.Errorf("%w: property without a name in %q", fault.ErrInvalidSchema, prefix)
+		}
+		if seen[p.Name] {
+			return fmt.Errorf("%w: property %s is declared twice", fault.ErrInvalidSchema, path)
+		}
+		seen[p.Name] = true
+		if err := p.check(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Property) check(path string) error {
+	switch p.Type {
+	case StringProperty, Int64Property, Float64Property, BoolProperty, DateTimeProperty, ReferenceProperty:
+	case ListProperty:
+		if p.Items != nil {
+			if err := p.Items.check(path + "[]"); err != nil {
+				return err
+			}
+		}
+	case ObjectProperty:
+		if err := checkProperties(p.Properties, path+"."); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%w: property %s has unknown type %q", fault.ErrInvalidSchema, path, p.Type)
+	}
+
+	// Lists and objects are not comparable, an enum would match any of them.
+	if len(p.Enum) > 0 && (p.Type == ListProperty || p.Type == ObjectProperty) {
+		return fmt.Errorf("%w: property %s of type %s cannot have an enum", fault.ErrInvalidSchema, path, p.Type)
+	}
+
+	if p.Default != nil {
+		if msg := p.validate(p.Default); msg != "" {
+			return fmt.Errorf("%w: default of property %s %s", fault.ErrInvalidSchema, path, msg)
+		}
+	}
+	return nil
+}
+
+// validateFields checks the fields of an object, appending a Violation for every
+// problem found.
+func validateFields(fields map[string]interface{}, properties []*Property, open bool, prefix string, violations *[]Violation) {
+	for _, p := range properties {
+		path := prefix + p.Name
+		value, found := fields[p.Name]
+		if !found || value == nil {
+			if p.Default != nil {
+				fields[p.Name] = cloneValue(p.Default)
+				continue
+			}
+			if p.Required {
+				*violations = append(*violations, Violation{Path: path, Message: "is required"})
+			}
+			continue
+		}
+		p.validateValue(value, path, violations)
+	}
+
+	if open || (prefix != "" && len(properties) == 0) {
+		return
+	}
+	var undeclared []string
+	for name := range fields {
+		if !declares(properties, name) {
+			undeclared = append(undeclared, name)
+		}
+	}
+	sort.Strings(undeclared)
+	for _, name := range undeclared {
+		*violations = append(*violations, Violation{Path: prefix + name, Message: "is not declared"})
+	}
+}
+
+// validateValue checks a present value, descending into lists and objects.
+func (p *Property) validateValue(value interface{}, path string, violations *[]Violation) {
+	if msg := p.validate(value); msg != "" {
+		*violations = append(*violations, Violation{Path: path, Message: msg})
+		return
+	}
+
+	switch p.Type {
+	case ListProperty:
+		if p.Items == nil {
+			return
+		}
+		list := reflect.ValueOf(value)
+		for i := 0; i < list.Len(); i++ {
+			element := list.Index(i).Interface()
+			elementPath := fmt.Sprintf("%s[%d]", path, i)
+			if element == nil {
+				*violations = append(*violations, Violation{Path: elementPath, Message: "is null"})
+				continue
+			}
+			p.Items.validateValue(element, elementPath, violations)
+		}
+	case ObjectProperty:
+		validateFields(value.(map[string]interface{}), p.Properties, p.Open, path+".", violations)
+	}
+}
+
+// validate checks the type of a value and its enum constraint. It returns a
+// message describing the problem, or "".
+func (p *Property) validate(value interface{}) string {
+	normalized, ok := normalizeValue(p.Type, value)
+	if !ok {
+		return fmt.Sprintf("must be of type %s, got %T", p.Type, value)
+	}
+	if len(p.Enum) == 0 {
+		return ""
+	}
+	for _, allowed := range p.Enum {
+		if candidate, ok := normalizeValue(p.Type, allowed); ok && candidate == normalized {
+			return ""
+		}
+	}
+	return fmt.Sprintf("must be one of %v", p.Enum)
+}
+
+// normalizeValue checks that value is of type t, accepting what encoding/json
+// decodes into an interface{}, and converts scalar values to a comparable form
+// for enum checks. Scalars are coerced the way the store coerces indexed
+// property values.
+func normalizeValue(t PropertyType, value interface{}) (interface{}, bool) {
+	switch t {
+	case StringProperty:
+		return store.CoerceIndexValue(store.StringIndex, value)
+
+	case Int64Property:
+		return store.CoerceIndexValue(store.Int64Index, value)
+
+	case Float64Property:
+		return store.CoerceIndexValue(store.Float64Index, value)
+
+	case BoolProperty:
+		return store.CoerceIndexValue(store.BoolIndex, value)
+
+	case DateTimeProperty:
+		v, ok := store.CoerceIndexValue(store.DateTimeIndex, value)
+		if !ok {
+			return nil, false
+		}
+		return v.(time.Time).UnixNano(), true
+
+	case ReferenceProperty:
+		switch v := value.(type) {
+		case *store.Id:
+			if v == nil {
+				return nil, false
+			}
+			return *v, true
+		case store.Id:
+			return v, true
+		case string:
+			id, err := store.IdFromString(v)
+			if err != nil {
+				return nil, false
+			}
+			return *id, true
+		case map[string]interface{}:
+			// A store.Id decoded from JSON.
+			data, err := json.Marshal(v)
+			if err != nil {
+				return nil, false
+			}
+			var id store.Id
+			if err := json.Unmarshal(data, &id); err != nil || len(v) != 2 {
+				return nil, false
+			}
+			return id, true
+		}
+
+	case ListProperty:
+		if value == nil {
+			return nil, false
+		}
+		kind := reflect.TypeOf(value).Kind()
+		return nil, kind == reflect.Slice || kind == reflect.Array
+
+	case ObjectProperty:
+		_, ok := value.(map[string]interface{})
+		return nil, ok
+	}
+	return nil, false
+}
+
+// cloneValue copies a default value so objects do not share lists or maps with
+// the cached schema.
+func cloneValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		clone := make([]interface{}, len(v))
+		for i, element := range v {
+			clone[i] = cloneValue(element)
+		}
+		return clone
+	case map[string]interface{}:
+		clone := make(map[string]interface{}, len(v))
+		for k, element := range v {
+			clone[k] = cloneValue(element)
+		}
+		return clone
+	}
+	return value
+}
+
+func declares(properties []*Property, name string) bool {
+	for _, p := range properties {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
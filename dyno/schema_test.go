@@ -0,0 +1,163 @@
+package dyno_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/guyvdb/dstore/dyno"
+	"github.com/guyvdb/dstore/fault"
+	"github.com/guyvdb/dstore/store"
+	"github.com/guyvdb/dstore/types"
+)
+
+func invoiceSchema() *dyno.Schema {
+	return &dyno.Schema{Properties: []*dyno.Property{
+		{Name: "Number", Type: dyno.Int64Property, Required: true},
+		{Name: "Status", Type: dyno.StringProperty, Default: "open", Enum: []interface{}{"open", "paid"}},
+		{Name: "Due", Type: dyno.DateTimeProperty},
+		{Name: "Customer", Type: dyno.ReferenceProperty},
+		{Name: "Lines", Type: dyno.ListProperty, Items: &dyno.Property{Type: dyno.ObjectProperty, Properties: []*dyno.Property{
+			{Name: "Qty", Type: dyno.Int64Property, Required: true},
+			{Name: "Price", Type: dyno.Float64Property},
+		}}},
+	}}
+}
+
+func TestSchemaValidation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	r := types.NewSystemRegistry()
+	dyno.Register(r)
+	if err := dyno.DefineType(r, "Invoice", invoiceSchema()); err != nil {
+		t.Fatal(err)
+	}
+	s, err := types.OpenBoltStore(path, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := dyno.NewDynamicObject("Invoice")
+	d.SetProperty("Number", uint64(12))
+	d.SetProperty("Due", "2024-01-02T00:00:00Z")
+	d.SetProperty("Customer", store.NewId(5, 6))
+	d.SetProperty("Lines", []interface{}{map[string]interface{}{"Qty": 2.0, "Price": 1}})
+	if err := s.AllocateId(d); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(d); err != nil {
+		t.Fatal(err)
+	}
+	if d.GetProperty("Status") != "open" {
+		t.Errorf("Status = %v, want the default open", d.GetProperty("Status"))
+	}
+
+	// Values read back are what encoding/json decodes into.
+	got, err := s.Get(d.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := got.(*dyno.DynamicObject).Validate(r.Schema(d.Id.TypeId)); err != nil {
+		t.Errorf("object read back does not validate: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The schema is persisted with the type.
+	r = types.NewSystemRegistry()
+	dyno.Register(r)
+	s, err = types.OpenBoltStore(path, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	bad := dyno.NewDynamicObject("Invoice")
+	bad.SetProperty("Number", 1.5)
+	bad.SetProperty("Status", "void")
+	bad.SetProperty("Extra", 1)
+	bad.SetProperty("Lines", []interface{}{map[string]interface{}{"Price": "x"}, 3})
+	if err := s.AllocateId(bad); err != nil {
+		t.Fatal(err)
+	}
+	err = s.Put(bad)
+	var ve *dyno.ValidationError
+	if !errors.As(err, &ve) || !errors.Is(err, fault.ErrValidationFailed) {
+		t.Fatalf("Put returned %v, want a ValidationError", err)
+	}
+	if len(ve.Violations) != 6 {
+		t.Errorf("Violations = %+v, want 6", ve.Violations)
+	}
+	if exists, _ := s.Exists(bad.Id); exists {
+		t.Error("an object that failed validation was stored")
+	}
+
+	// Redefining the type replaces the schema objects are validated against.
+	schema, err := dyno.TypeSchema(r, "Invoice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schema.Properties) != 5 {
+		t.Fatalf("TypeSchema has %d properties, want 5", len(schema.Properties))
+	}
+	schema.Open = true
+	schema.Properties = schema.Properties[:1]
+	if err := dyno.DefineType(r, "Invoice", schema); err != nil {
+		t.Fatal(err)
+	}
+	err = s.Put(bad)
+	if !errors.As(err, &ve) || len(ve.Violations) != 1 || ve.Violations[0].Path != "Number" {
+		t.Errorf("Put after redefining returned %v, want only the Number violation", err)
+	}
+
+	err = dyno.DefineType(r, "X", &dyno.Schema{Properties: []*dyno.Property{{Name: "a", Type: "nope"}}})
+	if !errors.Is(err, fault.ErrInvalidSchema) {
+		t.Errorf("DefineType with an unknown property type returned %v, want %v", err, fault.ErrInvalidSchema)
+	}
+}
+
+// TestEnumOnlyOnScalars checks that enums are rejected on lists and objects,
+// whose values cannot be compared with them, wherever they are declared.
+func TestEnumOnlyOnScalars(t *testing.T) {
+	tests := []struct {
+		name     string
+		property *dyno.Property
+	}{
+		{"list", &dyno.Property{Name: "Tags", Type: dyno.ListProperty, Enum: []interface{}{[]interface{}{"a"}}}},
+		{"object", &dyno.Property{Name: "Address", Type: dyno.ObjectProperty, Enum: []interface{}{map[string]interface{}{"city": "Paris"}}}},
+		{"nested object", &dyno.Property{Name: "Lines", Type: dyno.ListProperty, Items: &dyno.Property{Type: dyno.ObjectProperty, Enum: []interface{}{"x"}}}},
+	}
+	for _, tt := range tests {
+		r := types.NewSystemRegistry()
+		dyno.Register(r)
+		err := dyno.DefineType(r, "Invoice", &dyno.Schema{Properties: []*dyno.Property{tt.property}})
+		if !errors.Is(err, fault.ErrInvalidSchema) {
+			t.Errorf("%s: DefineType with an enum returned %v, want %v", tt.name, err, fault.ErrInvalidSchema)
+		}
+	}
+
+	// Enums still constrain scalars inside lists.
+	r := types.NewSystemRegistry()
+	dyno.Register(r)
+	err := dyno.DefineType(r, "Invoice", &dyno.Schema{Properties: []*dyno.Property{
+		{Name: "Tags", Type: dyno.ListProperty, Items: &dyno.Property{Type: dyno.StringProperty, Enum: []interface{}{"red", "blue"}}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := types.OpenBoltStore(filepath.Join(t.TempDir(), "db"), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	d := dyno.NewDynamicObject("Invoice")
+	d.SetProperty("Tags", []interface{}{"red", "green"})
+	if err := s.AllocateId(d); err != nil {
+		t.Fatal(err)
+	}
+	var ve *dyno.ValidationError
+	if err := s.Put(d); !errors.As(err, &ve) || len(ve.Violations) != 1 || ve.Violations[0].Path != "Tags[1]" {
+		t.Errorf("Put with a value outside the enum returned %v, want a violation at Tags[1]", err)
+	}
+}
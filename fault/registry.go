@@ -3,6 +3,9 @@ package fault
 import "errors"
 
 var (
-	ErrTypeNotCreated = errors.New("type not created")
-	ErrTypeNotFound   = errors.New("type not found")
+	ErrTypeNotCreated    = errors.New("type not created")
+	ErrTypeNotFound      = errors.New("type not found")
+	ErrRegistryNotLoaded = errors.New("registry not loaded")
+	ErrRegistryInUse     = errors.New("registry is already loaded into another store")
+	ErrInvalidStructTag  = errors.New("invalid dstore struct tag")
 )
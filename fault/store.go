@@ -15,4 +15,57 @@ var (
 	ErrIndexUpdateFailed              = errors.New("index update failed")
 	ErrUnsupportedIndexDataType       = errors.New("unsupported index data type")
 	ErrUniqueIndexConstraintViolation = errors.New("uniqueness constraint violation")
+	ErrTypeMismatch                   = errors.New("storable is not of the expected type")
+)
+
+// Errors returned by indexed searches.
+var (
+	ErrInvalidIndexName       = errors.New("invalid index name")
+	ErrIndexNotFound          = errors.New("index not found")
+	ErrIndexValueTypeMismatch = errors.New("value does not match index data type")
+	ErrInvalidWildcardPattern = errors.New("invalid wildcard pattern")
+)
+
+// Errors returned by transactions.
+var (
+	ErrTxNotWritable = errors.New("transaction is not writable")
+)
+
+// Errors returned by paged queries.
+var (
+	ErrInvalidPageToken = errors.New("invalid page token")
+	ErrInvalidPageLimit = errors.New("page limit must be greater than zero")
+)
+
+// Errors returned when reading stored values.
+var (
+	ErrInvalidValueHeader     = errors.New("invalid stored value header")
+	ErrUnsupportedValueFormat = errors.New("stored value uses an unsupported format")
+	ErrSchemaVersionTooNew    = errors.New("schema version is newer than the registered type")
+	ErrMigrationNotFound      = errors.New("schema migration not found")
+	ErrMigrationFailed        = errors.New("schema migration failed")
+	ErrUnsupportedCodecType   = errors.New("type cannot be encoded by the codec")
+	ErrUnsupportedCompression = errors.New("unsupported compression algorithm")
+	ErrChecksumMismatch       = errors.New("stored value checksum mismatch")
+	ErrCorruptValue           = errors.New("stored value is corrupt")
+)
+
+// Errors returned by encryption at rest and hashed indexes.
+var (
+	ErrNoKeyProvider    = errors.New("no key provider set")
+	ErrKeyNotAvailable  = errors.New("encryption key not available")
+	ErrDecryptionFailed = errors.New("stored value could not be decrypted")
+	ErrHashedIndex      = errors.New("hashed index only supports equality matches")
+)
+
+// Errors returned when validating objects against the schema of their type.
+var (
+	ErrInvalidSchema    = errors.New("invalid schema")
+	ErrValidationFailed = errors.New("validation failed")
+)
+
+// Errors returned by the typed property accessors of dynamic objects.
+var (
+	ErrPropertyNotFound     = errors.New("property not found")
+	ErrPropertyTypeMismatch = errors.New("property is not of the requested type")
 )
@@ -0,0 +1,372 @@
+package store
+
+import (
+	"encoding"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+
+	"github.com/guyvdb/dstore/fault"
+)
+
+// binaryCodec writes the exported fields of a struct in declaration order:
+//
+//	struct        field count (uvarint), then each field
+//	bool          1 byte
+//	int kinds     zigzag varint
+//	uint kinds    uvarint
+//	float32/64    IEEE 754 bits, big-endian, 4 or 8 bytes
+//	string        length (uvarint), bytes
+//	slice, map    length+1 (uvarint, 0 for nil), elements or key/value pairs
+//	array         elements
+//	pointer       0 for nil, or 1 followed by the element
+//
+// Types implementing encoding.BinaryMarshaler, such as time.Time, are written
+// as a length-prefixed MarshalBinary result. Interfaces, channels and functions
+// cannot be encoded. Recording the field count lets a struct gain fields at the
+// end: older values leave them at their zero value.
+type binaryCodec struct{}
+
+var binaryMarshalerType = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+var binaryUnmarshalerType = reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()
+
+func (binaryCodec) Id() byte {
+	return BinaryCodecId
+}
+
+func (binaryCodec) Encode(m Storable) ([]byte, error) {
+	v := reflect.ValueOf(m)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%T: %w", m, fault.ErrUnsupportedCodecType)
+	}
+	return appendBinary(nil, v.Elem())
+}
+
+func (binaryCodec) Decode(data []byte, m Storable) error {
+	v := reflect.ValueOf(m)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("%T: %w", m, fault.ErrUnsupportedCodecType)
+	}
+	d := &binaryDecoder{data: data}
+	if err := d.decode(v.Elem()); err != nil {
+		return err
+	}
+	if len(d.data) != 0 {
+		return fmt.Errorf("%d trailing bytes: %w", len(d.data), fault.ErrUnmarshalFailed)
+	}
+	return nil
+}
+
+// binaryFields returns the indexes of the exported fields of a struct type.
+func binaryFields(t reflect.Type) []int {
+	fields := make([]int, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).IsExported() {
+			fields = append(fields, i)
+		}
+	}
+	return fields
+}
+
+// isBinaryMarshaler reports whether values of t encode themselves, which takes
+// MarshalBinary on the value and UnmarshalBinary on its pointer, as time.Time
+// has.
+func isBinaryMarshaler(t reflect.Type) bool {
+	return t.Kind() != reflect.Pointer && t.Implements(binaryMarshalerType) && reflect.PointerTo(t).Implements(binaryUnmarshalerType)
+}
+
+func appendBinary(buf []byte, v reflect.Value) ([]byte, error) {
+	if isBinaryMarshaler(v.Type()) {
+		data, err := v.Interface().(encoding.BinaryMarshaler).MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		buf = binary.AppendUvarint(buf, uint64(len(data)))
+		return append(buf, data...), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return append(buf, 1), nil
+		}
+		return append(buf, 0), nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return binary.AppendVarint(buf, v.Int()), nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return binary.AppendUvarint(buf, v.Uint()), nil
+
+	case reflect.Float32:
+		return binary.BigEndian.AppendUint32(buf, math.Float32bits(float32(v.Float()))), nil
+
+	case reflect.Float64:
+		return binary.BigEndian.AppendUint64(buf, math.Float64bits(v.Float())), nil
+
+	case reflect.String:
+		buf = binary.AppendUvarint(buf, uint64(v.Len()))
+		return append(buf, v.String()...), nil
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return append(buf, 0), nil
+		}
+		buf = binary.AppendUvarint(buf, uint64(v.Len())+1)
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return append(buf, v.Bytes()...), nil
+		}
+		return appendBinaryElements(buf, v)
+
+	case reflect.Array:
+		return appendBinaryElements(buf, v)
+
+	case reflect.Map:
+		if v.IsNil() {
+			return append(buf, 0), nil
+		}
+		buf = binary.AppendUvarint(buf, uint64(v.Len())+1)
+		var err error
+		iter := v.MapRange()
+		for iter.Next() {
+			if buf, err = appendBinary(buf, iter.Key()); err != nil {
+				return nil, err
+			}
+			if buf, err = appendBinary(buf, iter.Value()); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+
+	case reflect.Pointer:
+		if v.IsNil() {
+			return append(buf, 0), nil
+		}
+		return appendBinary(append(buf, 1), v.Elem())
+
+	case reflect.Struct:
+		fields := binaryFields(v.Type())
+		buf = binary.AppendUvarint(buf, uint64(len(fields)))
+		var err error
+		for _, i := range fields {
+			if buf, err = appendBinary(buf, v.Field(i)); err != nil {
+				return nil, fmt.Errorf("%s.%s: %w", v.Type().Name(), v.Type().Field(i).Name, err)
+			}
+		}
+		return buf, nil
+	}
+
+	return nil, fmt.Errorf("%s: %w", v.Type(), fault.ErrUnsupportedCodecType)
+}
+
+func appendBinaryElements(buf []byte, v reflect.Value) ([]byte, error) {
+	var err error
+	for i := 0; i < v.Len(); i++ {
+		if buf, err = appendBinary(buf, v.Index(i)); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// binaryDecoder reads values written by appendBinary, consuming data.
+type binaryDecoder struct {
+	data []byte
+}
+
+func (d *binaryDecoder) errTruncated() error {
+	return fmt.Errorf("truncated binary value: %w", fault.ErrUnmarshalFailed)
+}
+
+func (d *binaryDecoder) uvarint() (uint64, error) {
+	x, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		return 0, d.errTruncated()
+	}
+	d.data = d.data[n:]
+	return x, nil
+}
+
+func (d *binaryDecoder) varint() (int64, error) {
+	x, n := binary.Varint(d.data)
+	if n <= 0 {
+		return 0, d.errTruncated()
+	}
+	d.data = d.data[n:]
+	return x, nil
+}
+
+func (d *binaryDecoder) bytes(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)) {
+		return nil, d.errTruncated()
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b, nil
+}
+
+// length reads a nil-able length written as length+1. It returns -1 for nil.
+func (d *binaryDecoder) length() (int, error) {
+	n, err := d.uvarint()
+	if err != nil {
+		return 0, err
+	}
+	// Every element takes at least one byte, which bounds allocations made
+	// for corrupt lengths.
+	if n > uint64(len(d.data))+1 {
+		return 0, d.errTruncated()
+	}
+	return int(n) - 1, nil
+}
+
+func (d *binaryDecoder) decode(v reflect.Value) error {
+	if isBinaryMarshaler(v.Type()) {
+		n, err := d.uvarint()
+		if err != nil {
+			return err
+		}
+		data, err := d.bytes(n)
+		if err != nil {
+			return err
+		}
+		return v.Addr().Interface().(encoding.BinaryUnmarshaler).UnmarshalBinary(data)
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		b, err := d.bytes(1)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b[0] != 0)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		x, err := d.varint()
+		if err != nil {
+			return err
+		}
+		v.SetInt(x)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		x, err := d.uvarint()
+		if err != nil {
+			return err
+		}
+		v.SetUint(x)
+
+	case reflect.Float32:
+		b, err := d.bytes(4)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(float64(math.Float32frombits(binary.BigEndian.Uint32(b))))
+
+	case reflect.Float64:
+		b, err := d.bytes(8)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(math.Float64frombits(binary.BigEndian.Uint64(b)))
+
+	case reflect.String:
+		n, err := d.uvarint()
+		if err != nil {
+			return err
+		}
+		b, err := d.bytes(n)
+		if err != nil {
+			return err
+		}
+		v.SetString(string(b))
+
+	case reflect.Slice:
+		n, err := d.length()
+		if err != nil {
+			return err
+		}
+		if n < 0 {
+			v.SetZero()
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b, err := d.bytes(uint64(n))
+			if err != nil {
+				return err
+			}
+			v.SetBytes(append([]byte{}, b...))
+			return nil
+		}
+		v.Set(reflect.MakeSlice(v.Type(), n, n))
+		for i := 0; i < n; i++ {
+			if err := d.decode(v.Index(i)); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := d.decode(v.Index(i)); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		n, err := d.length()
+		if err != nil {
+			return err
+		}
+		if n < 0 {
+			v.SetZero()
+			return nil
+		}
+		v.Set(reflect.MakeMapWithSize(v.Type(), n))
+		for i := 0; i < n; i++ {
+			key := reflect.New(v.Type().Key()).Elem()
+			if err := d.decode(key); err != nil {
+				return err
+			}
+			value := reflect.New(v.Type().Elem()).Elem()
+			if err := d.decode(value); err != nil {
+				return err
+			}
+			v.SetMapIndex(key, value)
+		}
+
+	case reflect.Pointer:
+		present, err := d.bytes(1)
+		if err != nil {
+			return err
+		}
+		if present[0] == 0 {
+			v.SetZero()
+			return nil
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return d.decode(v.Elem())
+
+	case reflect.Struct:
+		count, err := d.uvarint()
+		if err != nil {
+			return err
+		}
+		fields := binaryFields(v.Type())
+		if count > uint64(len(fields)) {
+			return fmt.Errorf("%s has %d fields, value has %d: %w", v.Type(), len(fields), count, fault.ErrUnmarshalFailed)
+		}
+		for _, i := range fields[:count] {
+			if err := d.decode(v.Field(i)); err != nil {
+				return err
+			}
+		}
+		for _, i := range fields[count:] {
+			v.Field(i).SetZero()
+		}
+
+	default:
+		return fmt.Errorf("%s: %w", v.Type(), fault.ErrUnsupportedCodecType)
+	}
+	return nil
+}
@@ -2,12 +2,12 @@ package store
 
 import (
 	"bytes"
-	"encoding/binary"
-	"errors"
 	"fmt"
+	"iter"
 	"log/slog"
-	"math"
-	"time"
+	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/guyvdb/dstore/fault"
 
@@ -20,6 +20,12 @@ var _ Store = (*BoltStore)(nil)
 type BoltStore struct {
 	db          *bbolt.DB
 	typeManager StoreTypeManager
+	compression atomic.Pointer[CompressionOptions] // store wide compression options
+	keys        atomic.Pointer[KeyProvider]        // provider of encryption and index keys
+	codecs      sync.Map                           // custom codecs by id
+
+	reindexing    sync.Mutex // serializes Reindex
+	shadowIndexes sync.Map   // names of the index buckets Reindex is building a shadow of
 }
 
 // NewBoltStore creates and returns a new BoltStore.
@@ -33,152 +39,60 @@ func NewBoltStore(path string, typeManager StoreTypeManager) (Store, error) {
 		return nil, fmt.Errorf("failed to open bolt db: %w", err)
 	}
 
-	// Buckets for types will be created on demand.
-	return &BoltStore{db: db, typeManager: typeManager}, nil
-}
-
-func (bs *BoltStore) updateIndexes(tx *bbolt.Tx, m Storable) error {
-
-	id := m.GetId()
-
-	// Update any indexes
-	for _, index := range bs.typeManager.Indexes(id.TypeId) {
-		indexBucketNameBytes, err := bs.mkIndexBucketName(id.TypeId, index.PropertyName)
-		if err != nil {
-			return err
-		}
-		slog.Debug("BoltStore.Put() indexing property", "indexBucketName", string(indexBucketNameBytes), "propertyName", index.PropertyName, "dataType", index.DataType.String())
-
-		typeNameForLog, _ := bs.typeManager.GetTypeName(id.TypeId) // Best effort for logging
-
-		idxbucket, err := tx.CreateBucketIfNotExists(indexBucketNameBytes)
-		if err != nil {
-			return fmt.Errorf("failed to create index bucket %s: %w", string(indexBucketNameBytes), fault.ErrBucketCreateFailed)
-		}
-
-		var propertyValueBytes []byte
-		var ok bool
+	bs := &BoltStore{db: db, typeManager: typeManager}
 
-		switch index.DataType {
-		case StringIndex:
-			stringValue, success := GetIndexableStringValue(m, typeNameForLog, index.PropertyName)
-			if success {
-				propertyValueBytes = []byte(stringValue)
-			}
-			ok = success
-		case Int64Index:
-			intValue, success := GetIndexableIntValue(m, typeNameForLog, index.PropertyName)
-			if success {
-				// XOR with (1 << 63) to make signed int64 lexicographically sortable
-				// Negative numbers become 0..., positive numbers become 1...
-				uint64Val := uint64(intValue) ^ (1 << 63)
-				buf := make([]byte, 8)
-				binary.BigEndian.PutUint64(buf, uint64Val)
-				propertyValueBytes = buf
-			}
-			ok = success
-		case Float64Index:
-			floatValue, success := GetIndexableFloatValue(m, typeNameForLog, index.PropertyName)
-			if success {
-				bits := math.Float64bits(floatValue)
-				// For lexicographical sort of IEEE 754 floats:
-				// If positive (sign bit is 0), flip sign bit to 1.
-				// If negative (sign bit is 1), flip all bits.
-				if bits&(1<<63) == 0 { // Positive or +0
-					bits |= (1 << 63)
-				} else { // Negative or -0
-					bits = ^bits
-				}
-				buf := make([]byte, 8)
-				binary.BigEndian.PutUint64(buf, bits)
-				propertyValueBytes = buf
-			}
-			ok = success
-		case BoolIndex:
-			boolValue, success := GetIndexableBoolValue(m, typeNameForLog, index.PropertyName)
-			if success {
-				if boolValue {
-					propertyValueBytes = []byte{1} // True
-				} else {
-					propertyValueBytes = []byte{0} // False
-				}
-			}
-			ok = success
-		case DateTimeIndex:
-			timeValue, success := GetIndexableDateTimeValue(m, typeNameForLog, index.PropertyName)
-			if success {
-				// RFC3339Nano is lexicographically sortable and human-readable.
-				// Pre-allocate buffer for efficiency. Max length of RFC3339Nano is 35.
-				propertyValueBytes = timeValue.AppendFormat(make([]byte, 0, 35), time.RFC3339Nano)
-			}
-			ok = success
-		default:
-			slog.Warn("BoltStore.Put: Unknown or unsupported index data type", "dataType", index.DataType.String(), "typeName", typeNameForLog, "property", index.PropertyName)
-			continue // Skip this index
-		}
-
-		if !ok {
-			// The GetIndexable<Type>Value function already logs the reason.
-			continue
-		}
+	// Databases written before Ids were keyed in binary are upgraded in place.
+	if err := bs.migrateKeys(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate bolt db keys: %w", err)
+	}
+	if err := bs.migrateValueFormat(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate bolt db value format: %w", err)
+	}
+	if err := bs.migrateIndexFormat(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate bolt db index format: %w", err)
+	}
 
-		idBytes := []byte(id.String())
-		indexKey := buildIndexKey(index.Type, propertyValueBytes, id)
+	// Buckets for types will be created on demand.
+	return bs, nil
+}
 
-		if index.Type == UniqueIndex {
-			existingIdBytes := idxbucket.Get(indexKey)
-			if existingIdBytes != nil && !bytes.Equal(existingIdBytes, idBytes) {
-				// Value already exists for a different Storable ID, uniqueness constraint violation.
-				return fmt.Errorf("uniqueness constraint violation for index '%s' on property '%s': value already mapped to ID %s : %w",
-					index.PropertyName, string(indexBucketNameBytes), string(existingIdBytes), fault.ErrUniqueIndexConstraintViolation)
-			}
-		}
+// TypeManager returns the type manager this store was opened with.
+func (bs *BoltStore) TypeManager() StoreTypeManager {
+	return bs.typeManager
+}
 
-		if err := idxbucket.Put(indexKey, idBytes); err != nil {
-			return fmt.Errorf("failed to put index entry for %s: %w", index.PropertyName, err)
+// Update runs fn within a read-write transaction. All operations performed
+// through tx, including index maintenance and id allocation, are committed
+// together if fn returns nil and rolled back if it returns an error.
+func (bs *BoltStore) Update(fn func(tx Tx) error) error {
+	t := &boltTx{bs: bs}
+	err := bs.db.Update(func(tx *bbolt.Tx) error {
+		t.tx = tx
+		return fn(t)
+	})
+	if err != nil {
+		for _, handler := range t.rollbackHandlers {
+			handler()
 		}
 	}
+	return err
+}
 
-	return nil
+// View runs fn within a read-only transaction, giving it a consistent snapshot
+// of the store.
+func (bs *BoltStore) View(fn func(tx Tx) error) error {
+	return bs.db.View(func(tx *bbolt.Tx) error {
+		return fn(&boltTx{bs: bs, tx: tx})
+	})
 }
 
 // Put stores a Storable model.
 func (bs *BoltStore) Put(m Storable) error {
-	if m == nil {
-		return fault.ErrNilStoreable
-	}
-
-	id := m.GetId()
-	if id == nil {
-		return fault.ErrStorableHasNilId
-	}
-
-	bucketNameBytes, err := bs.typeBucketKey(id.TypeId)
-	if err != nil {
-		return err
-	}
-
-	data, err := m.Marshal()
-	if err != nil {
-		return fault.ErrMarshalFailed
-	}
-
-	keyBytes := []byte(id.String())
-
-	return bs.db.Update(func(tx *bbolt.Tx) error {
-
-		// Put the storeable
-		bucket, err := tx.CreateBucketIfNotExists(bucketNameBytes)
-		if err != nil {
-			return fault.ErrBucketCreateFailed
-		}
-
-		err = bucket.Put(keyBytes, data)
-		if err != nil {
-			return fault.ErrPutFailed
-		}
-
-		return bs.updateIndexes(tx, m)
+	return bs.Update(func(tx Tx) error {
+		return tx.Put(m)
 	})
 }
 
@@ -188,214 +102,304 @@ func (bs *BoltStore) PutAll(m []Storable) error {
 		return nil // Nothing to do
 	}
 
-	return bs.db.Update(func(tx *bbolt.Tx) error {
-		for _, item := range m {
-			if item == nil {
-				return fault.ErrNilStoreable
-			}
+	return bs.Update(func(tx Tx) error {
+		return tx.PutAll(m)
+	})
+}
 
-			id := item.GetId()
-			if id == nil {
-				return fault.ErrStorableHasNilId
-			}
+// Exists checks if a model with the given Id exists.
+func (bs *BoltStore) Exists(id *Id) (bool, error) {
+	var exists bool
+	err := bs.View(func(tx Tx) error {
+		var err error
+		exists, err = tx.Exists(id)
+		return err
+	})
+	return exists, err
+}
 
-			bucketNameBytes, err := bs.typeBucketKey(id.TypeId)
-			if err != nil {
-				return err
-			}
+// Get retrieves a Storable model by its key.
+func (bs *BoltStore) Get(id *Id) (Storable, error) {
+	var result Storable
+	err := bs.View(func(tx Tx) error {
+		var err error
+		result, err = tx.Get(id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
 
-			data, err := item.Marshal()
-			if err != nil {
-				return fault.ErrMarshalFailed
-			}
+// GetAllByTypeName retrieves all Storable models of a given typeName.
+func (bs *BoltStore) GetAllByTypeName(typeName string) ([]Storable, error) {
+	return bs.viewItems(func(tx Tx) ([]Storable, error) {
+		return tx.GetAllByTypeName(typeName)
+	})
+}
 
-			bucket, err := tx.CreateBucketIfNotExists(bucketNameBytes)
-			if err != nil {
-				return fault.ErrBucketCreateFailed
-			}
+// GetAll retrieves all Storable models of a given typeId.
+func (bs *BoltStore) GetAll(typeId int64) ([]Storable, error) {
+	return bs.viewItems(func(tx Tx) ([]Storable, error) {
+		return tx.GetAll(typeId)
+	})
+}
 
-			keyBytes := []byte(id.String())
-			if err := bucket.Put(keyBytes, data); err != nil {
-				return fault.ErrPutFailed
-			}
+// Count returns the number of stored objects of a given typeId.
+func (bs *BoltStore) Count(typeId int64) (int, error) {
+	var count int
+	err := bs.View(func(tx Tx) error {
+		var err error
+		count, err = tx.Count(typeId)
+		return err
+	})
+	return count, err
+}
 
-			err = bs.updateIndexes(tx, item)
-			if err != nil {
-				return fault.ErrIndexUpdateFailed
-			}
-		}
-		return nil
+// DeleteAllByTypeName removes every object of a given typeName.
+func (bs *BoltStore) DeleteAllByTypeName(typeName string) (int, error) {
+	var deleted int
+	err := bs.Update(func(tx Tx) error {
+		var err error
+		deleted, err = tx.DeleteAllByTypeName(typeName)
+		return err
 	})
+	return deleted, err
 }
 
-// Exists checks if a model with the given Id exists.
-func (bs *BoltStore) Exists(id *Id) (bool, error) {
-	if id == nil {
-		return false, fault.ErrIdIsNil
-	}
+// Delete removes a model by its key.
+func (bs *BoltStore) Delete(id *Id) error {
+	return bs.Update(func(tx Tx) error {
+		return tx.Delete(id)
+	})
+}
 
-	// typeName, err := bs.typeManager.GetTypeName(id.TypeId)
-	// if err != nil {
-	// 	// If typeId is unknown, we can't determine the bucket.
-	// 	return false, fault.ErrTypeNotFound
-	// }
-	// bucketNameBytes := []byte(typeName)
-	bucketNameBytes, err := bs.typeBucketKey(id.TypeId)
-	if err != nil {
-		return false, err
-	}
+// AllocateId assigns a new Id to item. The type manager decides when the
+// allocation needs to be persisted, so this does not always open a write
+// transaction.
+func (bs *BoltStore) AllocateId(item Storable) error {
+	return bs.typeManager.AllocateId(item)
+}
 
-	keyBytes := []byte(id.String())
-	var exists bool
+// AllocateIds assigns a new Id to every item.
+func (bs *BoltStore) AllocateIds(items []Storable) error {
+	return bs.typeManager.AllocateIds(items)
+}
 
-	err = bs.db.View(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket(bucketNameBytes)
-		if bucket == nil {
-			// Bucket for this type does not exist, so key cannot exist.
-			exists = false
-			return nil // Not an error for Exists operation
-		}
-		val := bucket.Get(keyBytes)
-		exists = (val != nil)
-		return nil
+// Migrate rewrites the objects of typeName that are stored at an older schema
+// version and rebuilds the type's indexes.
+func (bs *BoltStore) Migrate(typeName string) (int, error) {
+	var migrated int
+	err := bs.Update(func(tx Tx) error {
+		var err error
+		migrated, err = tx.Migrate(typeName)
+		return err
 	})
+	return migrated, err
+}
 
-	// err here would be a DB-level error from bs.db.View, not from bucket/key not found.
-	// If err is not nil, 'exists' value is indeterminate, so return error.
-	return exists, err
+// VerifyIndexes checks the indexes of typeName against the stored objects.
+func (bs *BoltStore) VerifyIndexes(typeName string) (*IndexReport, error) {
+	var report *IndexReport
+	err := bs.View(func(tx Tx) error {
+		var err error
+		report, err = tx.VerifyIndexes(typeName)
+		return err
+	})
+	return report, err
 }
 
-// Get retrieves a Storable model by its key.
-func (bs *BoltStore) Get(id *Id) (Storable, error) {
-	var result Storable
+// Match finds storables where an indexed property exactly matches the given value.
+func (bs *BoltStore) Match(indexName string, value interface{}) ([]Storable, error) {
+	return bs.viewItems(func(tx Tx) ([]Storable, error) {
+		return tx.Match(indexName, value)
+	})
+}
 
-	if id == nil {
-		return nil, fault.ErrIdIsNil
-	}
+// WildcardMatch finds storables where an indexed string property matches the given glob pattern.
+func (bs *BoltStore) WildcardMatch(indexName string, pattern string) ([]Storable, error) {
+	return bs.viewItems(func(tx Tx) ([]Storable, error) {
+		return tx.WildcardMatch(indexName, pattern)
+	})
+}
 
-	// typeName, err := bs.typeManager.GetTypeName(id.TypeId)
-	// if err != nil {
-	// 	return nil, fault.ErrTypeNotFound
-	// }
-	// bucketNameBytes := []byte(typeName)
-	bucketNameBytes, err := bs.typeBucketKey(id.TypeId)
-	if err != nil {
-		return nil, err
-	}
+// Range finds storables where an indexed property lies between lo and hi.
+func (bs *BoltStore) Range(indexName string, lo, hi interface{}, opts *RangeOptions) ([]Storable, error) {
+	return bs.viewItems(func(tx Tx) ([]Storable, error) {
+		return tx.Range(indexName, lo, hi, opts)
+	})
+}
 
-	slog.Debug("BoltStore.Get() - get item", "id", id, "bucketName", string(bucketNameBytes))
+// Iterate calls fn for every Storable of the given typeId, one at a time.
+func (bs *BoltStore) Iterate(typeId int64, fn func(Storable) bool) error {
+	return bs.View(func(tx Tx) error {
+		return tx.Iterate(typeId, fn)
+	})
+}
 
-	keyBytes := []byte(id.String())
+// GetAllSeq returns a sequence over all Storable models of a given typeId.
+func (bs *BoltStore) GetAllSeq(typeId int64) iter.Seq2[Storable, error] {
+	return bs.viewSeq(func(tx Tx, fn func(Storable) bool) error {
+		return tx.Iterate(typeId, fn)
+	})
+}
 
-	err = bs.db.View(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket(bucketNameBytes)
-		if bucket == nil {
-			return fault.ErrBucketNotFound
-		}
+// MatchSeq returns a sequence over the storables where an indexed property exactly matches value.
+func (bs *BoltStore) MatchSeq(indexName string, value interface{}) iter.Seq2[Storable, error] {
+	return bs.viewSeq(func(tx Tx, fn func(Storable) bool) error {
+		return tx.IterateMatch(indexName, value, fn)
+	})
+}
 
-		val := bucket.Get(keyBytes)
-		if val == nil {
-			return fault.ErrKeyNotFound
-		}
+// RangeSeq returns a sequence over the storables where an indexed property lies between lo and hi.
+func (bs *BoltStore) RangeSeq(indexName string, lo, hi interface{}, opts *RangeOptions) iter.Seq2[Storable, error] {
+	return bs.viewSeq(func(tx Tx, fn func(Storable) bool) error {
+		return tx.IterateRange(indexName, lo, hi, opts, fn)
+	})
+}
 
-		instance, createErr := bs.typeManager.CreateInstance(id.TypeId)
-		if createErr != nil {
-			return fault.ErrTypeNotCreated
+// viewSeq adapts a callback scan into an iter.Seq2. The read-only transaction
+// stays open until the loop finishes or breaks.
+func (bs *BoltStore) viewSeq(scan func(tx Tx, fn func(Storable) bool) error) iter.Seq2[Storable, error] {
+	return func(yield func(Storable, error) bool) {
+		stopped := false
+		err := bs.View(func(tx Tx) error {
+			return scan(tx, func(item Storable) bool {
+				if !yield(item, nil) {
+					stopped = true
+					return false
+				}
+				return true
+			})
+		})
+		if err != nil && !stopped {
+			yield(nil, err)
 		}
+	}
+}
 
-		if unmarshalErr := instance.Unmarshal(val); unmarshalErr != nil {
-			return fault.ErrUnmarshalFailed
-		}
-		result = instance
-		return nil
+// GetPage returns one page of Storable models of a given typeName.
+func (bs *BoltStore) GetPage(typeName string, after *Id, limit int) (*Page, error) {
+	return bs.viewPage(func(tx Tx) (*Page, error) {
+		return tx.GetPage(typeName, after, limit)
 	})
+}
 
-	if err != nil {
-		// err could be from db.View, bucket not found, key not found, create instance, or unmarshal.
-		return nil, err
-	}
+// MatchPage returns one page of the storables where an indexed property exactly matches value.
+func (bs *BoltStore) MatchPage(indexName string, value interface{}, after string, limit int) (*Page, error) {
+	return bs.viewPage(func(tx Tx) (*Page, error) {
+		return tx.MatchPage(indexName, value, after, limit)
+	})
+}
 
-	return result, nil
+// RangePage returns one page of the storables where an indexed property lies between lo and hi.
+func (bs *BoltStore) RangePage(indexName string, lo, hi interface{}, opts *RangeOptions, after string, limit int) (*Page, error) {
+	return bs.viewPage(func(tx Tx) (*Page, error) {
+		return tx.RangePage(indexName, lo, hi, opts, after, limit)
+	})
 }
 
-// GetAllByTypeName retrieves all Storable models of a given typeName.
-func (bs *BoltStore) GetAllByTypeName(typeName string) ([]Storable, error) {
-	typeId, err := bs.typeManager.GetTypeId(typeName)
+// viewPage runs a paged query in a read-only transaction.
+func (bs *BoltStore) viewPage(query func(tx Tx) (*Page, error)) (*Page, error) {
+	var page *Page
+	err := bs.View(func(tx Tx) error {
+		var err error
+		page, err = query(tx)
+		return err
+	})
 	if err != nil {
-		return nil, fault.ErrTypeNotFound
+		return nil, err
 	}
-	// Use typeName directly as the bucket name. Pass typeId for unmarshalling.
-	return bs.getAllFromBucket(typeId)
-}
-
-// GetAll retrieves all Storable models of a given typeId.
-func (bs *BoltStore) GetAll(typeId int64) ([]Storable, error) {
-	// Use typeName as the bucket name. Pass typeId for unmarshalling.
-	return bs.getAllFromBucket(typeId)
+	return page, nil
 }
 
-// getAllFromBucket is a helper to retrieve all items from a named bucket,
-// unmarshalling them as the given typeId.
-func (bs *BoltStore) getAllFromBucket(typeId int64) ([]Storable, error) {
+// viewItems runs a query returning a list of storables in a read-only transaction.
+func (bs *BoltStore) viewItems(query func(tx Tx) ([]Storable, error)) ([]Storable, error) {
 	var results []Storable
-
-	bucketNameBytes, err := bs.typeBucketKey(typeId)
+	err := bs.View(func(tx Tx) error {
+		var err error
+		results, err = query(tx)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
+	return results, nil
+}
 
-	err = bs.db.View(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket(bucketNameBytes)
-		if bucket == nil {
-			// If the bucket doesn't exist, there are no items of this type.
-			// This is not an error condition for GetAll operations.
-			return nil
-		}
+// indexEntry is a single key that a Storable contributes to an index bucket.
+type indexEntry struct {
+	index      *IndexDefinition
+	bucketName []byte
+	key        []byte
+}
 
-		cursor := bucket.Cursor()
-		for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
-			instance, err := bs.typeManager.CreateInstance(typeId)
-			if err != nil {
-				// This error means the factory doesn't know how to create this typeId.
-				return fault.ErrTypeNotCreated
-			}
+// indexEntries computes the index keys for every index declared on the type of m.
+// Properties whose values cannot be extracted are skipped; indexValueBytes logs why.
+func (bs *BoltStore) indexEntries(m Storable) ([]indexEntry, error) {
+	id := m.GetId()
+	typeNameForLog, _ := bs.typeManager.GetTypeName(id.TypeId) // Best effort for logging
 
-			// Value 'v' is only valid for the lifetime of the transaction.
-			// We must copy it before Unmarshal if Unmarshal might hold onto the slice.
-			// json.Unmarshal typically copies data, but being explicit is safer.
-			valueBytes := make([]byte, len(v))
-			copy(valueBytes, v)
+	indexes := bs.typeManager.Indexes(id.TypeId)
+	entries := make([]indexEntry, 0, len(indexes))
 
-			if err := instance.Unmarshal(valueBytes); err != nil {
-				return fault.ErrUnmarshalFailed
-			}
-			results = append(results, instance)
+	for _, index := range indexes {
+		indexBucketNameBytes, err := bs.mkIndexBucketName(id.TypeId, index.PropertyName)
+		if err != nil {
+			return nil, err
 		}
-		return nil
-	})
 
-	if err != nil {
-		return nil, err
+		propertyValueBytes, ok, err := bs.indexEntryValue(m, typeNameForLog, index)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		entries = append(entries, indexEntry{
+			index:      index,
+			bucketName: indexBucketNameBytes,
+			key:        buildIndexKey(index.Type, propertyValueBytes, id),
+		})
 	}
+	return entries, nil
+}
 
-	// Ensure empty slice instead of nil if no items found and no error.
-	if results == nil {
-		results = make([]Storable, 0)
+// indexEntryValue returns the value part of the key m has in index, hashed for a
+// hashed index. It returns false if the value could not be extracted.
+func (bs *BoltStore) indexEntryValue(m Storable, typeName string, index *IndexDefinition) ([]byte, bool, error) {
+	valueBytes, ok := indexValueBytes(m, typeName, index)
+	if !ok || !index.Hashed {
+		return valueBytes, ok, nil
 	}
-	return results, nil
+	hashed, err := bs.hashIndexValue(valueBytes)
+	return hashed, err == nil, err
+}
+
+// containsIndexEntry reports whether entries holds the same bucket and key as e.
+func containsIndexEntry(entries []indexEntry, e indexEntry) bool {
+	for _, candidate := range entries {
+		if bytes.Equal(candidate.bucketName, e.bucketName) && bytes.Equal(candidate.key, e.key) {
+			return true
+		}
+	}
+	return false
 }
 
 // buildIndexKey creates the key for the index bucket based on index type.
 // For UniqueIndex, the key is the property value.
 // For NonUniqueIndex, the key is propertyValue_objectId to allow multiple items
 // with the same property value while maintaining unique keys in BoltDB. The
-// propertyValueBytes are joined with the ID bytes using a null byte separator.
+// propertyValueBytes are joined with the fixed-width ID bytes using a null byte
+// separator, so entries with equal values are ordered by Id.
 func buildIndexKey(indexType IndexType, propertyValueBytes []byte, id *Id) []byte {
 	switch indexType {
 	case UniqueIndex:
 		return propertyValueBytes
 	case NonUniqueIndex:
-		idBytes := []byte(id.String())
+		idBytes := id.Bytes()
 		// Use a null byte as a separator. This is generally safe as propertyValueBytes
 		// from structured data (like numbers, specific string formats for time) are unlikely
 		// to naturally form sequences that would collide after appending a null byte and an ID.
@@ -408,159 +412,49 @@ func buildIndexKey(indexType IndexType, propertyValueBytes []byte, id *Id) []byt
 	return nil // Should not happen
 }
 
-// Delete removes a model by its key.
-func (bs *BoltStore) Delete(id *Id) error {
-	if id == nil {
-		return fault.ErrIdIsNil
-	}
-
-	// Step 1: Retrieve the storable. We need its actual data to correctly
-	// form the index keys that need to be deleted.
-	itemToDelete, err := bs.Get(id)
-	if err != nil {
-		if errors.Is(err, fault.ErrKeyNotFound) || errors.Is(err, fault.ErrBucketNotFound) {
-			// Item or its containing bucket doesn't exist, so it's effectively already "deleted".
-			slog.Debug("BoltStore.Delete: Item not found, considering delete successful", "id", id.String())
-			return nil
-		}
-		// Another error occurred during Get (e.g., unmarshal failed, type not created).
-		return fmt.Errorf("failed to retrieve item %s for deletion: %w", id.String(), err)
-	}
-
-	// If Get succeeded, itemToDelete should not be nil.
-	// This check is mostly for defensive programming.
-	if itemToDelete == nil {
-		slog.Warn("BoltStore.Delete: Get succeeded but returned nil item, considering delete successful", "id", id.String())
-		return nil
+// indexKeyValue returns the encoded property value part of an index key,
+// stripping the null separator and object id from NonUniqueIndex keys.
+func indexKeyValue(indexType IndexType, key []byte) []byte {
+	if indexType == NonUniqueIndex && len(key) > IdKeyLength {
+		return key[:len(key)-IdKeyLength-1]
 	}
+	return key
+}
 
-	return bs.db.Update(func(tx *bbolt.Tx) error {
-		// Step 2: Delete the item from its primary type bucket.
-		bucketNameBytes, typeErr := bs.typeBucketKey(id.TypeId)
-		if typeErr != nil {
-			// This should ideally not happen if Get(id) succeeded, as Get also calls typeBucketKey.
-			return fmt.Errorf("failed to get type bucket key for deleting item %s: %w", id.String(), typeErr)
+// resolveIndex parses an index name in the form TypeName.PropertyName and
+// returns the typeId and IndexDefinition it refers to. Type names may themselves
+// contain dots, so every split point is tried from left to right.
+func (bs *BoltStore) resolveIndex(indexName string) (int64, *IndexDefinition, error) {
+	found := false
+	for i := 0; i < len(indexName); i++ {
+		if indexName[i] != '.' {
+			continue
 		}
-
-		bucket := tx.Bucket(bucketNameBytes)
-		if bucket == nil {
-			// This is an inconsistent state if Get(id) succeeded, as Get would have returned ErrBucketNotFound.
-			// Log a warning and treat as if the item is already gone.
-			slog.Warn("BoltStore.Delete: Type bucket disappeared during transaction", "id", id.String(), "bucketName", string(bucketNameBytes))
-			return fault.ErrBucketNotFound // Or return nil if we consider it "already deleted"
+		typeName, propertyName := indexName[:i], indexName[i+1:]
+		if typeName == "" || propertyName == "" {
+			continue
 		}
 
-		keyBytes := []byte(id.String())
-		if err := bucket.Delete(keyBytes); err != nil {
-			// bbolt's Delete doesn't return an error if the key is not found.
-			// This would be for other underlying BoltDB errors.
-			return fmt.Errorf("failed to delete item %s from primary bucket %s: %w", id.String(), string(bucketNameBytes), err)
-		}
-		slog.Debug("BoltStore.Delete: Deleted item from primary bucket", "id", id.String(), "bucketName", string(bucketNameBytes))
-
-		// Step 3: Delete entries from all relevant index buckets.
-		// Use itemToDelete (which is 'Storable') to get indexed property values.
-		typeNameForLog, getTypeNameErr := bs.typeManager.GetTypeName(id.TypeId)
-		if getTypeNameErr != nil {
-			slog.Warn("BoltStore.Delete: Could not get type name for logging index cleanup", "typeId", id.TypeId, "error", getTypeNameErr)
-			typeNameForLog = fmt.Sprintf("typeId_%d", id.TypeId) // Fallback for logging context
+		typeId, err := bs.typeManager.GetTypeId(typeName)
+		if err != nil {
+			continue
 		}
+		found = true
 
-		for _, indexDef := range bs.typeManager.Indexes(id.TypeId) {
-			indexBucketNameBytes, err := bs.mkIndexBucketName(id.TypeId, indexDef.PropertyName)
-			if err != nil {
-				return fmt.Errorf("failed to create index bucket name for property '%s' of item %s: %w", indexDef.PropertyName, id.String(), err)
-			}
-
-			idxBucket := tx.Bucket(indexBucketNameBytes)
-			if idxBucket == nil {
-				// Index bucket doesn't exist, so no entry to delete for this index.
-				continue
+		for _, index := range bs.typeManager.Indexes(typeId) {
+			if index.PropertyName == propertyName {
+				return typeId, index, nil
 			}
-
-			var propertyValueBytes []byte
-			var ok bool
-
-			// This switch logic is similar to updateIndexes to get the value of the indexed property.
-			switch indexDef.DataType {
-			case StringIndex:
-				val, success := GetIndexableStringValue(itemToDelete, typeNameForLog, indexDef.PropertyName)
-				if success {
-					propertyValueBytes = []byte(val)
-				}
-				ok = success
-			case Int64Index:
-				val, success := GetIndexableIntValue(itemToDelete, typeNameForLog, indexDef.PropertyName)
-				if success {
-					uint64Val := uint64(val) ^ (1 << 63)
-					buf := make([]byte, 8)
-					binary.BigEndian.PutUint64(buf, uint64Val)
-					propertyValueBytes = buf
-				}
-				ok = success
-			case Float64Index:
-				val, success := GetIndexableFloatValue(itemToDelete, typeNameForLog, indexDef.PropertyName)
-				if success {
-					bits := math.Float64bits(val)
-					if bits&(1<<63) == 0 {
-						bits |= (1 << 63)
-					} else {
-						bits = ^bits
-					}
-					buf := make([]byte, 8)
-					binary.BigEndian.PutUint64(buf, bits)
-					propertyValueBytes = buf
-				}
-				ok = success
-			case BoolIndex:
-				val, success := GetIndexableBoolValue(itemToDelete, typeNameForLog, indexDef.PropertyName)
-				if success {
-					if val {
-						propertyValueBytes = []byte{1}
-					} else {
-						propertyValueBytes = []byte{0}
-					}
-				}
-				ok = success
-			case DateTimeIndex:
-				val, success := GetIndexableDateTimeValue(itemToDelete, typeNameForLog, indexDef.PropertyName)
-				if success {
-					propertyValueBytes = val.AppendFormat(make([]byte, 0, 35), time.RFC3339Nano)
-				}
-				ok = success
-			default:
-				slog.Warn("BoltStore.Delete: Unknown or unsupported index data type during index cleanup", "dataType", indexDef.DataType.String(), "typeName", typeNameForLog, "property", indexDef.PropertyName)
-				continue
-			}
-
-			if !ok {
-				// GetIndexable<Type>Value functions already log specific reasons for failure.
-				// If we couldn't get the value, we can't form the key to delete.
-				slog.Debug("BoltStore.Delete: Skipping index cleanup for property as value was not retrievable", "id", id.String(), "typeName", typeNameForLog, "property", indexDef.PropertyName)
-				continue
-			}
-
-			indexKey := buildIndexKey(indexDef.Type, propertyValueBytes, id)
-			if err := idxBucket.Delete(indexKey); err != nil {
-				// bbolt's Delete doesn't error if key not found. This would be for other DB errors.
-				return fmt.Errorf("failed to delete index entry for property '%s' from bucket '%s' (item %s): %w", indexDef.PropertyName, string(indexBucketNameBytes), id.String(), err)
-			}
-			slog.Debug("BoltStore.Delete: Deleted index entry", "id", id.String(), "property", indexDef.PropertyName, "indexBucketName", string(indexBucketNameBytes))
 		}
-		return nil
-	})
-}
-
-func (bs *BoltStore) AllocateId(item Storable) error {
-	return bs.typeManager.AllocateId(item)
-}
-
-func (bs *BoltStore) Match(indexName string, value interface{}) ([]Storable, error) {
-	panic("not implemented")
-}
+	}
 
-func (bs *BoltStore) WildcardMatch(indexName string, pattern string) ([]Storable, error) {
-	panic("not implemented")
+	if !found {
+		if !strings.Contains(indexName, ".") {
+			return 0, nil, fmt.Errorf("expected <TypeName>.<PropertyName>, got '%s': %w", indexName, fault.ErrInvalidIndexName)
+		}
+		return 0, nil, fmt.Errorf("index '%s': %w", indexName, fault.ErrTypeNotFound)
+	}
+	return 0, nil, fmt.Errorf("index '%s': %w", indexName, fault.ErrIndexNotFound)
 }
 
 func (bs *BoltStore) AllocateBucketIfNeeded(typeName string) error {
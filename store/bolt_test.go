@@ -0,0 +1,52 @@
+package store_test
+
+import (
+	"testing"
+
+	"github.com/guyvdb/dstore/store"
+)
+
+// TestPutRemovesStaleIndexEntries updates and deletes Products and checks that
+// their old index entries go, so that a unique value can be reused.
+func TestPutRemovesStaleIndexEntries(t *testing.T) {
+	s := newProductStore(t)
+	p := put(t, s, &Product{Code: "A", Name: "x", Qty: 1})
+	p.Code, p.Name, p.Qty = "B", "y", 2
+	put(t, s, p)
+
+	for index, value := range map[string]interface{}{"Product.Code": "A", "Product.Name": "x", "Product.Qty": 1} {
+		if found, err := s.Match(index, value); err != nil || len(found) != 0 {
+			t.Errorf("Match(%s, %v) after the update found %d, %v; want none", index, value, len(found), err)
+		}
+	}
+	if found, err := s.Match("Product.Code", "B"); err != nil || len(found) != 1 {
+		t.Errorf("Match of the new Code found %d, %v; want 1", len(found), err)
+	}
+
+	// The old unique value is free again.
+	a := put(t, s, &Product{Code: "A"})
+
+	// A unique value can move to another object in one PutAll.
+	c := put(t, s, &Product{Code: "C"})
+	a.Code, c.Code = "D", "A"
+	if err := s.PutAll([]store.Storable{a, c}); err != nil {
+		t.Fatalf("PutAll moving a unique value: %v", err)
+	}
+	if found, err := s.Match("Product.Code", "A"); err != nil || len(found) != 1 || found[0].GetId().String() != c.Id.String() {
+		t.Errorf("Match(A) after the move = %v, %v; want the former C", found, err)
+	}
+
+	if err := s.Delete(p.Id); err != nil {
+		t.Fatal(err)
+	}
+	if found, err := s.Match("Product.Code", "B"); err != nil || len(found) != 0 {
+		t.Errorf("Match of a deleted Product found %d, %v; want none", len(found), err)
+	}
+	if found, err := s.Range("Product.Qty", nil, nil, nil); err != nil || len(found) != 2 {
+		t.Errorf("Range over every Qty found %d, %v; want 2", len(found), err)
+	}
+
+	if report, err := s.VerifyIndexes("Product"); err != nil || !report.OK() {
+		t.Errorf("VerifyIndexes = %+v, %v", report, err)
+	}
+}
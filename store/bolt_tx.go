@@ -0,0 +1,998 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/guyvdb/dstore/fault"
+
+	"go.etcd.io/bbolt"
+)
+
+// boltTx implements the store.Tx interface on top of a single bbolt transaction.
+var _ Tx = (*boltTx)(nil)
+
+type boltTx struct {
+	bs               *BoltStore
+	tx               *bbolt.Tx
+	rollbackHandlers []func()
+}
+
+// Writable returns true if the transaction can be used to modify the store.
+func (t *boltTx) Writable() bool {
+	return t.tx.Writable()
+}
+
+// OnCommit registers fn to run once the transaction has committed.
+func (t *boltTx) OnCommit(fn func()) {
+	t.tx.OnCommit(fn)
+}
+
+// OnRollback registers fn to run if the transaction rolls back or fails to
+// commit. BoltStore.Update runs these once bbolt has released the transaction.
+func (t *boltTx) OnRollback(fn func()) {
+	t.rollbackHandlers = append(t.rollbackHandlers, fn)
+}
+
+// Meta returns a copy of the value stored under key in the Meta bucket, or nil
+// if there is none.
+func (t *boltTx) Meta(key string) ([]byte, error) {
+	meta := t.tx.Bucket(metaBucketName)
+	if meta == nil {
+		return nil, nil
+	}
+	return bytes.Clone(meta.Get([]byte(key))), nil
+}
+
+// SetMeta stores value under key in the Meta bucket.
+func (t *boltTx) SetMeta(key string, value []byte) error {
+	if !t.tx.Writable() {
+		return fault.ErrTxNotWritable
+	}
+	meta, err := t.tx.CreateBucketIfNotExists(metaBucketName)
+	if err != nil {
+		return fmt.Errorf("failed to create meta bucket: %w", err)
+	}
+	return meta.Put([]byte(key), value)
+}
+
+// Put stores a Storable model.
+func (t *boltTx) Put(m Storable) error {
+	if !t.tx.Writable() {
+		return fault.ErrTxNotWritable
+	}
+	return t.putItem(m)
+}
+
+// PutAll stores multiple Storable models.
+func (t *boltTx) PutAll(m []Storable) error {
+	if !t.tx.Writable() {
+		return fault.ErrTxNotWritable
+	}
+
+	for _, item := range m {
+		if err := t.putItem(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// putItem writes a Storable to its type bucket and reconciles its index entries
+// against the version it replaces.
+func (t *boltTx) putItem(m Storable) error {
+	if m == nil {
+		return fault.ErrNilStoreable
+	}
+
+	id := m.GetId()
+	if id == nil {
+		return fault.ErrStorableHasNilId
+	}
+
+	bucketNameBytes, err := t.bs.typeBucketKey(id.TypeId)
+	if err != nil {
+		return err
+	}
+
+	if err := t.validateItem(id.TypeId, m); err != nil {
+		return err
+	}
+
+	data, err := t.encodeItem(id.TypeId, m)
+	if err != nil {
+		return err
+	}
+
+	bucket, err := t.tx.CreateBucketIfNotExists(bucketNameBytes)
+	if err != nil {
+		return fault.ErrBucketCreateFailed
+	}
+
+	previous, err := t.previousVersion(id)
+	if err != nil {
+		return err
+	}
+
+	if err := bucket.Put(id.Bytes(), data); err != nil {
+		return fault.ErrPutFailed
+	}
+
+	return t.updateIndexes(previous, m)
+}
+
+// Exists checks if a model with the given Id exists.
+func (t *boltTx) Exists(id *Id) (bool, error) {
+	if id == nil {
+		return false, fault.ErrIdIsNil
+	}
+
+	bucketNameBytes, err := t.bs.typeBucketKey(id.TypeId)
+	if err != nil {
+		return false, err
+	}
+
+	bucket := t.tx.Bucket(bucketNameBytes)
+	if bucket == nil {
+		// Bucket for this type does not exist, so key cannot exist.
+		return false, nil
+	}
+	return bucket.Get(id.Bytes()) != nil, nil
+}
+
+// Get retrieves a Storable model by its key.
+func (t *boltTx) Get(id *Id) (Storable, error) {
+	if id == nil {
+		return nil, fault.ErrIdIsNil
+	}
+
+	slog.Debug("BoltStore.Get() - get item", "id", id)
+
+	return t.readItem(id)
+}
+
+// readItem loads the Storable with the given id from its type bucket.
+func (t *boltTx) readItem(id *Id) (Storable, error) {
+	bucketNameBytes, err := t.bs.typeBucketKey(id.TypeId)
+	if err != nil {
+		return nil, err
+	}
+
+	bucket := t.tx.Bucket(bucketNameBytes)
+	if bucket == nil {
+		return nil, fault.ErrBucketNotFound
+	}
+
+	val := bucket.Get(id.Bytes())
+	if val == nil {
+		return nil, fault.ErrKeyNotFound
+	}
+
+	return t.decodeItem(id.TypeId, id.Bytes(), val)
+}
+
+// encodeItem marshals m and prefixes it with the value header for the current
+// schema version of typeId.
+func (t *boltTx) encodeItem(typeId int64, m Storable) ([]byte, error) {
+	codec := t.bs.codecOf(typeId)
+	data, err := codec.Encode(m)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", fault.ErrMarshalFailed, err)
+	}
+
+	header := valueHeader{version: t.bs.typeManager.SchemaVersion(typeId), codec: codec.Id()}
+	value, _, err := t.bs.wrapValue(typeId, m.GetId().Bytes(), header, data)
+	return value, err
+}
+
+// decodeItem creates an instance of typeId and unmarshals a stored value into it.
+// Values written at an older schema version are migrated first; the stored value
+// itself is left as it is. Damaged values are reported with a CorruptionError.
+func (t *boltTx) decodeItem(typeId int64, key, val []byte) (Storable, error) {
+	instance, createErr := t.bs.typeManager.CreateInstance(typeId)
+	if createErr != nil {
+		// This error means the factory doesn't know how to create this typeId.
+		return nil, fault.ErrTypeNotCreated
+	}
+
+	// Value 'val' is only valid for the lifetime of the transaction.
+	// We must copy it before Unmarshal if Unmarshal might hold onto the slice.
+	// json.Unmarshal typically copies data, but being explicit is safer.
+	valueBytes := make([]byte, len(val))
+	copy(valueBytes, val)
+
+	header, payload, err := t.bs.unwrapValue(key, valueBytes)
+	if err != nil {
+		// A payload that does not decompress is damaged whether or not its
+		// checksum matched.
+		return nil, t.corruption(typeId, key, valueHeader{}, err)
+	}
+
+	current := t.bs.typeManager.SchemaVersion(typeId)
+	if header.version > current {
+		return nil, fmt.Errorf("stored at version %d, registered at %d: %w", header.version, current, fault.ErrSchemaVersionTooNew)
+	}
+	if header.version < current {
+		if payload, err = t.bs.typeManager.MigrateValue(typeId, header.version, payload); err != nil {
+			return nil, err
+		}
+	}
+
+	codec, err := t.bs.codecById(typeId, header.codec)
+	if err != nil {
+		return nil, err
+	}
+	if err := codec.Decode(payload, instance); err != nil {
+		return nil, t.corruption(typeId, key, header, fmt.Errorf("%w: %w", fault.ErrUnmarshalFailed, err))
+	}
+	return instance, nil
+}
+
+// corruption wraps an error reading the value stored under key in a
+// CorruptionError if it means the value is damaged. Other errors are returned
+// as they are.
+func (t *boltTx) corruption(typeId int64, key []byte, header valueHeader, err error) error {
+	if !isCorruption(header, err) {
+		return err
+	}
+	bucket := fmt.Sprintf("Type.%d", typeId)
+	if name, nameErr := t.bs.typeBucketKey(typeId); nameErr == nil {
+		bucket = string(name)
+	}
+	return &CorruptionError{Bucket: bucket, Key: bytes.Clone(key), Err: err}
+}
+
+// GetAllByTypeName retrieves all Storable models of a given typeName.
+func (t *boltTx) GetAllByTypeName(typeName string) ([]Storable, error) {
+	typeId, err := t.bs.typeManager.GetTypeId(typeName)
+	if err != nil {
+		return nil, fault.ErrTypeNotFound
+	}
+	return t.GetAll(typeId)
+}
+
+// GetAll retrieves all Storable models of a given typeId.
+func (t *boltTx) GetAll(typeId int64) ([]Storable, error) {
+	return collect(func(fn func(Storable) bool) error {
+		return t.Iterate(typeId, fn)
+	})
+}
+
+// Count returns the number of stored objects of the given typeId.
+func (t *boltTx) Count(typeId int64) (int, error) {
+	bucketNameBytes, err := t.bs.typeBucketKey(typeId)
+	if err != nil {
+		return 0, err
+	}
+
+	bucket := t.tx.Bucket(bucketNameBytes)
+	if bucket == nil {
+		return 0, nil
+	}
+
+	return bucket.Stats().KeyN, nil
+}
+
+// Iterate calls fn for every Storable of the given typeId in key order,
+// unmarshalling one object at a time. Iteration stops when fn returns false.
+func (t *boltTx) Iterate(typeId int64, fn func(Storable) bool) error {
+	bucketNameBytes, err := t.bs.typeBucketKey(typeId)
+	if err != nil {
+		return err
+	}
+
+	bucket := t.tx.Bucket(bucketNameBytes)
+	if bucket == nil {
+		// If the bucket doesn't exist, there are no items of this type.
+		// This is not an error condition for GetAll operations.
+		return nil
+	}
+
+	cursor := bucket.Cursor()
+	for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
+		instance, err := t.decodeItem(typeId, k, v)
+		if err != nil {
+			return err
+		}
+		if !fn(instance) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// collect runs a scan and gathers every Storable it produces into a slice.
+func collect(scan func(fn func(Storable) bool) error) ([]Storable, error) {
+	results := make([]Storable, 0)
+	err := scan(func(item Storable) bool {
+		results = append(results, item)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// Delete removes a model by its key.
+func (t *boltTx) Delete(id *Id) error {
+	if id == nil {
+		return fault.ErrIdIsNil
+	}
+	if !t.tx.Writable() {
+		return fault.ErrTxNotWritable
+	}
+
+	// Step 1: Retrieve the storable within this transaction. We need its actual
+	// data to correctly form the index keys that need to be deleted. A value
+	// that can no longer be read is still deleted; its index entries are then
+	// found by sweeping the indexes of its type.
+	itemToDelete, err := t.readItem(id)
+	if err != nil {
+		if errors.Is(err, fault.ErrKeyNotFound) || errors.Is(err, fault.ErrBucketNotFound) {
+			// Item or its containing bucket doesn't exist, so it's effectively already "deleted".
+			slog.Debug("BoltStore.Delete: Item not found, considering delete successful", "id", id.String())
+			return nil
+		}
+		if !unreadable(err) {
+			// Another error occurred during the read (e.g., type not created, no key provider).
+			return fmt.Errorf("failed to retrieve item %s for deletion: %w", id.String(), err)
+		}
+		slog.Warn("BoltStore.Delete: Item could not be read, sweeping its indexes", "id", id.String(), "error", err)
+	}
+
+	// Step 2: Delete the item from its primary type bucket. readItem found a
+	// value, so both the type and its bucket are known to exist.
+	bucketNameBytes, err := t.bs.typeBucketKey(id.TypeId)
+	if err != nil {
+		return fmt.Errorf("failed to get type bucket key for deleting item %s: %w", id.String(), err)
+	}
+
+	keyBytes := id.Bytes()
+	if err := t.tx.Bucket(bucketNameBytes).Delete(keyBytes); err != nil {
+		// bbolt's Delete doesn't return an error if the key is not found.
+		// This would be for other underlying BoltDB errors.
+		return fmt.Errorf("failed to delete item %s from primary bucket %s: %w", id.String(), string(bucketNameBytes), err)
+	}
+	slog.Debug("BoltStore.Delete: Deleted item from primary bucket", "id", id.String(), "bucketName", string(bucketNameBytes))
+
+	// Step 3: Delete entries from all relevant index buckets.
+	if itemToDelete == nil {
+		return t.sweepIndexes(id)
+	}
+	return t.updateIndexes(itemToDelete, nil)
+}
+
+// DeleteAllByTypeName removes every object of typeName together with the
+// buckets of its declared indexes, and returns the number of objects removed.
+// It costs the same however many objects there are.
+func (t *boltTx) DeleteAllByTypeName(typeName string) (int, error) {
+	if !t.tx.Writable() {
+		return 0, fault.ErrTxNotWritable
+	}
+
+	typeId, err := t.bs.typeManager.GetTypeId(typeName)
+	if err != nil {
+		return 0, fault.ErrTypeNotFound
+	}
+
+	count, err := t.Count(typeId)
+	if err != nil {
+		return 0, err
+	}
+
+	bucketNameBytes, err := t.bs.typeBucketKey(typeId)
+	if err != nil {
+		return 0, err
+	}
+	if t.tx.Bucket(bucketNameBytes) != nil {
+		if err := t.tx.DeleteBucket(bucketNameBytes); err != nil {
+			return 0, fmt.Errorf("failed to delete bucket %s: %w", string(bucketNameBytes), err)
+		}
+	}
+	if _, err := t.tx.CreateBucket(bucketNameBytes); err != nil {
+		return 0, fault.ErrBucketCreateFailed
+	}
+
+	for _, index := range t.bs.typeManager.Indexes(typeId) {
+		if err := t.DropIndex(typeName, index.PropertyName); err != nil {
+			return 0, err
+		}
+	}
+
+	slog.Info("BoltStore.DeleteAllByTypeName: Deleted all objects of type", "typeName", typeName, "objects", count)
+	return count, nil
+}
+
+// AllocateId assigns a new Id to item. The type manager records the allocation
+// in this transaction, so it is only persisted if the transaction commits.
+func (t *boltTx) AllocateId(item Storable) error {
+	if !t.tx.Writable() {
+		return fault.ErrTxNotWritable
+	}
+	return t.bs.typeManager.AllocateIdInTx(t, item)
+}
+
+// AllocateIds assigns a new Id to every item, recording the allocations in this
+// transaction.
+func (t *boltTx) AllocateIds(items []Storable) error {
+	if !t.tx.Writable() {
+		return fault.ErrTxNotWritable
+	}
+	return t.bs.typeManager.AllocateIdsInTx(t, items)
+}
+
+// updateIndexes reconciles the index buckets for a change from previous to
+// current. previous is nil for a new object and current is nil for a delete.
+// Entries of the previous version that the current version no longer produces
+// are removed before the new entries are written, so a unique value can move
+// between objects in the same transaction.
+func (t *boltTx) updateIndexes(previous, current Storable) error {
+	var oldEntries, newEntries []indexEntry
+	var id *Id
+	var err error
+
+	if previous != nil {
+		id = previous.GetId()
+		if oldEntries, err = t.bs.indexEntries(previous); err != nil {
+			return err
+		}
+	}
+	if current != nil {
+		id = current.GetId()
+		if newEntries, err = t.bs.indexEntries(current); err != nil {
+			return err
+		}
+	}
+	if id == nil {
+		return nil
+	}
+
+	idBytes := id.Bytes()
+
+	// Remove stale entries.
+	for _, old := range oldEntries {
+		if containsIndexEntry(newEntries, old) {
+			continue
+		}
+
+		for _, idxBucket := range []*bbolt.Bucket{t.tx.Bucket(old.bucketName), t.shadowIndex(old.bucketName)} {
+			if idxBucket == nil {
+				continue
+			}
+			if err := deleteIndexEntry(idxBucket, old, idBytes); err != nil {
+				return fmt.Errorf("failed to delete index entry for property '%s' from bucket '%s' (item %s): %w", old.index.PropertyName, string(old.bucketName), id.String(), err)
+			}
+		}
+		slog.Debug("BoltStore: Deleted stale index entry", "id", id.String(), "property", old.index.PropertyName, "indexBucketName", string(old.bucketName))
+	}
+
+	// Write current entries.
+	for _, entry := range newEntries {
+		if err := t.writeIndexEntry(entry, idBytes); err != nil {
+			return err
+		}
+		if shadow := t.shadowIndex(entry.bucketName); shadow != nil {
+			if err := putIndexEntry(shadow, entry, idBytes); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// deleteIndexEntry removes a single index entry from idxBucket if it still
+// refers to idBytes; a unique value may have moved to another object.
+func deleteIndexEntry(idxBucket *bbolt.Bucket, entry indexEntry, idBytes []byte) error {
+	if existing := idxBucket.Get(entry.key); existing == nil || !bytes.Equal(existing, idBytes) {
+		return nil
+	}
+	return idxBucket.Delete(entry.key)
+}
+
+// writeIndexEntry puts a single index entry referring to idBytes, enforcing the
+// uniqueness of UniqueIndex values.
+func (t *boltTx) writeIndexEntry(entry indexEntry, idBytes []byte) error {
+	slog.Debug("BoltStore.Put() indexing property", "indexBucketName", string(entry.bucketName), "propertyName", entry.index.PropertyName, "dataType", entry.index.DataType.String())
+
+	idxbucket, err := t.tx.CreateBucketIfNotExists(entry.bucketName)
+	if err != nil {
+		return fmt.Errorf("failed to create index bucket %s: %w", string(entry.bucketName), fault.ErrBucketCreateFailed)
+	}
+	return putIndexEntry(idxbucket, entry, idBytes)
+}
+
+// putIndexEntry puts a single index entry referring to idBytes into idxbucket,
+// the index bucket of the entry or its shadow.
+func putIndexEntry(idxbucket *bbolt.Bucket, entry indexEntry, idBytes []byte) error {
+	if entry.index.Type == UniqueIndex {
+		existingIdBytes := idxbucket.Get(entry.key)
+		if existingIdBytes != nil && !bytes.Equal(existingIdBytes, idBytes) {
+			// Value already exists for a different Storable ID, uniqueness constraint violation.
+			return fmt.Errorf("uniqueness constraint violation for index '%s' on property '%s': value already mapped to ID %s : %w",
+				entry.index.PropertyName, string(entry.bucketName), idBytesString(existingIdBytes), fault.ErrUniqueIndexConstraintViolation)
+		}
+	}
+
+	if err := idxbucket.Put(entry.key, idBytes); err != nil {
+		return fmt.Errorf("failed to put index entry for %s: %w", entry.index.PropertyName, err)
+	}
+	return nil
+}
+
+// previousVersion returns the currently stored version of the object with the
+// given id, or nil if there is none. It is used to find the index entries that
+// a Put replaces. A stored value that can no longer be read is logged and
+// treated as absent so that it can be overwritten, after its index entries are
+// swept.
+func (t *boltTx) previousVersion(id *Id) (Storable, error) {
+	previous, err := t.readItem(id)
+	if err != nil {
+		if errors.Is(err, fault.ErrKeyNotFound) || errors.Is(err, fault.ErrBucketNotFound) {
+			return nil, nil
+		}
+		if unreadable(err) {
+			slog.Warn("BoltStore.Put: Previous version could not be read, sweeping its indexes", "id", id.String(), "error", err)
+			return nil, t.sweepIndexes(id)
+		}
+		return nil, err
+	}
+	return previous, nil
+}
+
+// unreadable reports whether err, returned by readItem, means the stored value
+// is damaged or no longer decodes, rather than that it could not be read now.
+func unreadable(err error) bool {
+	return errors.Is(err, fault.ErrCorruptValue) || errors.Is(err, fault.ErrUnmarshalFailed)
+}
+
+// sweepIndexes removes the entries referring to id from every index of its
+// type, and from their shadows while Reindex builds them. It is used when the stored value cannot be read to work out which
+// entries it produced, and scans the index buckets in full.
+func (t *boltTx) sweepIndexes(id *Id) error {
+	idBytes := id.Bytes()
+	for _, index := range t.bs.typeManager.Indexes(id.TypeId) {
+		bucketNameBytes, err := t.bs.mkIndexBucketName(id.TypeId, index.PropertyName)
+		if err != nil {
+			return err
+		}
+		for _, bucket := range []*bbolt.Bucket{t.tx.Bucket(bucketNameBytes), t.shadowIndex(bucketNameBytes)} {
+			if bucket == nil {
+				continue
+			}
+
+			var keys [][]byte
+			err = bucket.ForEach(func(k, v []byte) error {
+				if bytes.Equal(v, idBytes) {
+					keys = append(keys, bytes.Clone(k))
+				}
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("failed to sweep index bucket %s: %w", string(bucketNameBytes), err)
+			}
+			for _, k := range keys {
+				if err := bucket.Delete(k); err != nil {
+					return fmt.Errorf("failed to delete index entry of %s from bucket %s: %w", id.String(), string(bucketNameBytes), err)
+				}
+			}
+			slog.Debug("BoltStore: Swept index entries", "id", id.String(), "property", index.PropertyName, "entries", len(keys))
+		}
+	}
+	return nil
+}
+
+// Match finds storables where an indexed property exactly matches the given value.
+func (t *boltTx) Match(indexName string, value interface{}) ([]Storable, error) {
+	return collect(func(fn func(Storable) bool) error {
+		return t.IterateMatch(indexName, value, fn)
+	})
+}
+
+// IterateMatch calls fn for every Storable where an indexed property exactly
+// matches the given value. indexName is in the form of TypeName.PropertyName.
+// The value is encoded with the same encoding used by updateIndexes for the
+// IndexDataType of the index. Iteration stops when fn returns false.
+func (t *boltTx) IterateMatch(indexName string, value interface{}, fn func(Storable) bool) error {
+	typeId, index, err := t.bs.resolveIndex(indexName)
+	if err != nil {
+		return err
+	}
+
+	// A compound value may hold only the leading components, which matches a
+	// range of keys rather than a single value.
+	if index.IsCompound() {
+		return t.IterateRange(indexName, value, value, nil, fn)
+	}
+
+	valueBytes, err := t.bs.matchKeyValue(index, value)
+	if err != nil {
+		return fmt.Errorf("failed to encode value for index '%s': %w", indexName, err)
+	}
+
+	indexBucketNameBytes, err := t.bs.mkIndexBucketName(typeId, index.PropertyName)
+	if err != nil {
+		return err
+	}
+
+	slog.Debug("BoltStore.Match() - match index", "indexName", indexName, "indexBucketName", string(indexBucketNameBytes), "type", index.Type.String())
+
+	idxBucket := t.tx.Bucket(indexBucketNameBytes)
+	if idxBucket == nil {
+		// Nothing has been indexed yet, so nothing can match.
+		return nil
+	}
+
+	switch index.Type {
+	case UniqueIndex:
+		idBytes := idxBucket.Get(valueBytes)
+		if idBytes == nil {
+			return nil
+		}
+		_, err := t.visitIndexedItem(indexName, idBytes, fn)
+		return err
+
+	case NonUniqueIndex:
+		// Keys are propertyValue + 0x00 + objectId, so a prefix scan up to and
+		// including the null separator yields every object with this value.
+		// Longer keys under the prefix belong to values that merely start with
+		// this one followed by a 0x00 byte, and are skipped.
+		prefix := make([]byte, 0, len(valueBytes)+1)
+		prefix = append(prefix, valueBytes...)
+		prefix = append(prefix, 0)
+
+		cursor := idxBucket.Cursor()
+		for k, v := cursor.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = cursor.Next() {
+			if len(k) != len(prefix)+IdKeyLength {
+				continue
+			}
+			more, err := t.visitIndexedItem(indexName, v, fn)
+			if err != nil || !more {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// WildcardMatch finds storables where an indexed string property matches the given
+// glob pattern. '*' matches any sequence of characters, '?' matches a single
+// character and '\' escapes the character that follows it. The literal prefix of
+// the pattern is used to seek directly to the first candidate key.
+func (t *boltTx) WildcardMatch(indexName string, pattern string) ([]Storable, error) {
+	return collect(func(fn func(Storable) bool) error {
+		return t.iterateWildcardMatch(indexName, pattern, fn)
+	})
+}
+
+// iterateWildcardMatch calls fn for every Storable matched by WildcardMatch.
+func (t *boltTx) iterateWildcardMatch(indexName string, pattern string, fn func(Storable) bool) error {
+	typeId, index, err := t.bs.resolveIndex(indexName)
+	if err != nil {
+		return err
+	}
+
+	if index.Hashed {
+		return fmt.Errorf("wildcard match on '%s': %w", indexName, fault.ErrHashedIndex)
+	}
+	if index.IsCompound() || index.DataType != StringIndex {
+		return fmt.Errorf("wildcard match requires a %s index, '%s' is a %s index: %w", StringIndex, indexName, index.DataType, fault.ErrUnsupportedIndexDataType)
+	}
+
+	compiled, err := compileWildcard(pattern)
+	if err != nil {
+		return err
+	}
+
+	indexBucketNameBytes, err := t.bs.mkIndexBucketName(typeId, index.PropertyName)
+	if err != nil {
+		return err
+	}
+
+	slog.Debug("BoltStore.WildcardMatch() - match index", "indexName", indexName, "pattern", pattern, "prefix", string(compiled.prefix))
+
+	idxBucket := t.tx.Bucket(indexBucketNameBytes)
+	if idxBucket == nil {
+		return nil
+	}
+
+	cursor := idxBucket.Cursor()
+	for k, v := cursor.Seek(compiled.prefix); k != nil && bytes.HasPrefix(k, compiled.prefix); k, v = cursor.Next() {
+		if !compiled.Match(string(indexKeyValue(index.Type, k))) {
+			continue
+		}
+		more, err := t.visitIndexedItem(indexName, v, fn)
+		if err != nil || !more {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Range finds storables where an indexed property lies between lo and hi.
+func (t *boltTx) Range(indexName string, lo, hi interface{}, opts *RangeOptions) ([]Storable, error) {
+	return collect(func(fn func(Storable) bool) error {
+		return t.IterateRange(indexName, lo, hi, opts, fn)
+	})
+}
+
+// IterateRange calls fn for every Storable where an indexed property lies
+// between lo and hi, in index order. Iteration stops when fn returns false
+// or when opts.Limit objects have been visited.
+func (t *boltTx) IterateRange(indexName string, lo, hi interface{}, opts *RangeOptions, fn func(Storable) bool) error {
+	scan, err := t.openRange(indexName, lo, hi, opts)
+	if err != nil {
+		return err
+	}
+
+	visited := 0
+	return scan.walk(nil, func(k, v []byte) (bool, error) {
+		return t.visitIndexedItem(indexName, v, func(item Storable) bool {
+			visited++
+			return fn(item) && (scan.opts.Limit <= 0 || visited < scan.opts.Limit)
+		})
+	})
+}
+
+// indexScan is a bounded walk over the keys of one index bucket.
+type indexScan struct {
+	index  *IndexDefinition
+	bucket *bbolt.Bucket // nil if nothing has been indexed yet
+	lo, hi []byte        // encoded bounds, nil when open
+	opts   *RangeOptions
+}
+
+// openRange resolves an index and encodes the bounds of a range over it.
+func (t *boltTx) openRange(indexName string, lo, hi interface{}, opts *RangeOptions) (*indexScan, error) {
+	typeId, index, err := t.bs.resolveIndex(indexName)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts == nil {
+		opts = &RangeOptions{}
+	}
+
+	scan := &indexScan{index: index, opts: opts}
+
+	if index.Hashed {
+		// A hashed index can only be scanned for a single value, as Match and
+		// MatchPage do.
+		if lo == nil || hi == nil || opts.ExcludeLower || opts.ExcludeUpper {
+			return nil, fmt.Errorf("range on '%s': %w", indexName, fault.ErrHashedIndex)
+		}
+		if scan.lo, err = t.bs.matchKeyValue(index, lo); err != nil {
+			return nil, fmt.Errorf("failed to encode lower bound for index '%s': %w", indexName, err)
+		}
+		if scan.hi, err = t.bs.matchKeyValue(index, hi); err != nil {
+			return nil, fmt.Errorf("failed to encode upper bound for index '%s': %w", indexName, err)
+		}
+		if !bytes.Equal(scan.lo, scan.hi) {
+			return nil, fmt.Errorf("range on '%s': %w", indexName, fault.ErrHashedIndex)
+		}
+	} else {
+		if lo != nil {
+			if scan.lo, err = encodeIndexKeyValue(index, lo); err != nil {
+				return nil, fmt.Errorf("failed to encode lower bound for index '%s': %w", indexName, err)
+			}
+		}
+		if hi != nil {
+			if scan.hi, err = encodeIndexKeyValue(index, hi); err != nil {
+				return nil, fmt.Errorf("failed to encode upper bound for index '%s': %w", indexName, err)
+			}
+		}
+	}
+
+	indexBucketNameBytes, err := t.bs.mkIndexBucketName(typeId, index.PropertyName)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Debug("BoltStore.Range() - range index", "indexName", indexName, "lo", lo, "hi", hi, "reverse", opts.Reverse)
+
+	scan.bucket = t.tx.Bucket(indexBucketNameBytes)
+	return scan, nil
+}
+
+// belowLower and aboveUpper test an encoded value against the bounds.
+func (s *indexScan) belowLower(value []byte) bool {
+	if s.lo == nil {
+		return false
+	}
+	cmp := s.compare(value, s.lo)
+	return cmp < 0 || (cmp == 0 && s.opts.ExcludeLower)
+}
+
+func (s *indexScan) aboveUpper(value []byte) bool {
+	if s.hi == nil {
+		return false
+	}
+	cmp := s.compare(value, s.hi)
+	return cmp > 0 || (cmp == 0 && s.opts.ExcludeUpper)
+}
+
+// compare orders an encoded value against a bound. A compound bound may hold
+// only the leading components, so the value is compared up to the length of the
+// bound; tuple encodings are prefix free, which keeps this exact for complete
+// bounds as well.
+func (s *indexScan) compare(value, bound []byte) int {
+	if s.index.IsCompound() && len(value) > len(bound) {
+		value = value[:len(bound)]
+	}
+	return bytes.Compare(value, bound)
+}
+
+// interleaved reports whether keys of different values can interleave. Keys of
+// a non-unique index are value + 0x00 + id, so the keys of a value that extends
+// another with a 0x00 byte sort among the keys of the shorter value.
+func (s *indexScan) interleaved() bool {
+	return s.index.Type == NonUniqueIndex && !s.index.IsCompound()
+}
+
+// upperLimit returns the greatest key an entry within the upper bound of an
+// interleaved index can have. That is the last key of hi itself, or of a
+// shorter value that hi extends with a 0x00 byte.
+func (s *indexScan) upperLimit() []byte {
+	var limit []byte
+	for i := 0; i <= len(s.hi); i++ {
+		if i < len(s.hi) && s.hi[i] != 0 {
+			continue
+		}
+		last := make([]byte, 0, i+1+IdKeyLength)
+		last = append(last, s.hi[:i]...)
+		last = append(last, 0)
+		last = append(last, bytes.Repeat([]byte{0xFF}, IdKeyLength)...)
+		if bytes.Compare(last, limit) > 0 {
+			limit = last
+		}
+	}
+	return limit
+}
+
+// walk calls fn with every index key and value within the bounds. The index
+// encodings sort in value order, so the cursor seeks straight to the first
+// bound and stops as soon as it passes the second. If after is set the walk
+// resumes strictly after that key, even if it has since been deleted.
+func (s *indexScan) walk(after []byte, fn func(k, v []byte) (bool, error)) error {
+	if s.bucket == nil {
+		return nil
+	}
+	if s.lo != nil && s.hi != nil && s.compare(s.lo, s.hi) > 0 {
+		return nil
+	}
+
+	var limit []byte
+	if s.hi != nil && s.interleaved() {
+		limit = s.upperLimit()
+	}
+
+	cursor := s.bucket.Cursor()
+
+	if !s.opts.Reverse {
+		var k, v []byte
+		switch {
+		case after != nil:
+			if k, v = cursor.Seek(after); k != nil && bytes.Equal(k, after) {
+				k, v = cursor.Next()
+			}
+		case s.lo != nil:
+			k, v = cursor.Seek(s.lo)
+		default:
+			k, v = cursor.First()
+		}
+		for ; k != nil; k, v = cursor.Next() {
+			value := indexKeyValue(s.index.Type, k)
+			if s.belowLower(value) {
+				continue
+			}
+			if s.aboveUpper(value) {
+				if limit != nil && bytes.Compare(k, limit) <= 0 {
+					continue
+				}
+				break
+			}
+			more, err := fn(k, v)
+			if err != nil || !more {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// In reverse, position the cursor on the last key before the resume point.
+	// Every key holding hi itself (hi, or hi + 0x00 + id) sorts before hi + 0x01.
+	// Keys of a compound index only start with hi, they all sort before the
+	// next prefix after hi. Keys of an interleaved index end at its upper limit.
+	seek := after
+	if seek == nil && s.hi != nil {
+		if s.index.IsCompound() {
+			seek = nextPrefix(s.hi)
+		} else if limit != nil {
+			seek = append(limit, 0)
+		} else {
+			seek = make([]byte, 0, len(s.hi)+1)
+			seek = append(seek, s.hi...)
+			seek = append(seek, 1)
+		}
+	}
+
+	var k, v []byte
+	if seek == nil {
+		k, v = cursor.Last()
+	} else if k, _ = cursor.Seek(seek); k == nil {
+		k, v = cursor.Last()
+	} else {
+		k, v = cursor.Prev()
+	}
+
+	for ; k != nil; k, v = cursor.Prev() {
+		value := indexKeyValue(s.index.Type, k)
+		if s.aboveUpper(value) {
+			continue
+		}
+		if s.belowLower(value) {
+			// Every key of a value within the bounds sorts at or after lo.
+			if s.interleaved() && bytes.Compare(k, s.lo) >= 0 {
+				continue
+			}
+			break
+		}
+		more, err := fn(k, v)
+		if err != nil || !more {
+			return err
+		}
+	}
+	return nil
+}
+
+// nextPrefix returns the smallest key that is greater than every key starting
+// with prefix, or nil if there is none.
+func nextPrefix(prefix []byte) []byte {
+	next := bytes.Clone(prefix)
+	for i := len(next) - 1; i >= 0; i-- {
+		if next[i] < 0xFF {
+			next[i]++
+			return next[:i+1]
+		}
+	}
+	return nil
+}
+
+// visitIndexedItem loads the Storable referenced by an index entry and passes it
+// to fn, returning whether iteration should continue. Entries referring to
+// missing objects are skipped.
+func (t *boltTx) visitIndexedItem(indexName string, idBytes []byte, fn func(Storable) bool) (bool, error) {
+	item, err := t.readIndexedItem(indexName, idBytes)
+	if err != nil {
+		return false, err
+	}
+	if item == nil {
+		return true, nil
+	}
+	return fn(item), nil
+}
+
+// readIndexedItem loads the Storable referenced by an index entry. Index entries
+// that point to objects which no longer exist are logged and skipped by
+// returning a nil Storable and a nil error.
+func (t *boltTx) readIndexedItem(indexName string, idBytes []byte) (Storable, error) {
+	id, err := IdFromBytes(idBytes)
+	if err != nil {
+		return nil, fmt.Errorf("index '%s' holds an invalid id %x: %w", indexName, idBytes, err)
+	}
+
+	item, err := t.readItem(id)
+	if err != nil {
+		if errors.Is(err, fault.ErrKeyNotFound) || errors.Is(err, fault.ErrBucketNotFound) {
+			slog.Warn("BoltStore: Index entry refers to a missing item, skipping", "indexName", indexName, "id", id.String())
+			return nil, nil
+		}
+		return nil, err
+	}
+	return item, nil
+}
@@ -0,0 +1,151 @@
+package store_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/guyvdb/dstore/fault"
+	"github.com/guyvdb/dstore/store"
+)
+
+// TestUpdateRollsBack checks that the writes of an Update that fails, Ids
+// allocated in it included, are rolled back, and that its reads see them.
+func TestUpdateRollsBack(t *testing.T) {
+	s := newProductStore(t)
+	a := put(t, s, &Product{Code: "A", Qty: 10})
+	failure := errors.New("failure")
+
+	var allocated *store.Id
+	err := s.Update(func(tx store.Tx) error {
+		item, err := tx.Get(a.Id)
+		if err != nil {
+			return err
+		}
+		p := item.(*Product)
+		p.Qty--
+		if err := tx.Put(p); err != nil {
+			return err
+		}
+
+		b := &Product{Code: "B"}
+		if err := tx.AllocateId(b); err != nil {
+			return err
+		}
+		allocated = b.Id
+		if err := tx.Put(b); err != nil {
+			return err
+		}
+		if found, err := tx.Match("Product.Code", "B"); err != nil || len(found) != 1 {
+			t.Errorf("Match in the transaction found %d, %v; want 1", len(found), err)
+		}
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("Update returned %v, want %v", err, failure)
+	}
+
+	if item, err := s.Get(a.Id); err != nil || item.(*Product).Qty != 10 {
+		t.Errorf("Get after the rollback = %v, %v; want Qty 10", item, err)
+	}
+	if exists, err := s.Exists(allocated); err != nil || exists {
+		t.Errorf("Exists of an object put in the rolled back transaction = %v, %v", exists, err)
+	}
+	if c := put(t, s, &Product{Code: "C"}); c.Id.ObjectId == allocated.ObjectId {
+		t.Errorf("Id %s was allocated again after a rollback", c.Id)
+	}
+
+	// A unique value freed by a Delete can be taken in the same transaction.
+	err = s.Update(func(tx store.Tx) error {
+		if err := tx.Delete(a.Id); err != nil {
+			return err
+		}
+		p := &Product{Code: "A"}
+		if err := tx.AllocateId(p); err != nil {
+			return err
+		}
+		return tx.Put(p)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestViewIsReadOnly(t *testing.T) {
+	s := newProductStore(t)
+	p := put(t, s, &Product{Code: "A"})
+	err := s.View(func(tx store.Tx) error {
+		return tx.Put(p)
+	})
+	if !errors.Is(err, fault.ErrTxNotWritable) {
+		t.Errorf("Put in View returned %v, want %v", err, fault.ErrTxNotWritable)
+	}
+}
+
+// TestIterators checks that the iterators stop when asked and report errors
+// through the sequence.
+func TestIterators(t *testing.T) {
+	s, r := openStore(t, filepath.Join(t.TempDir(), "db"), registerProduct)
+	for i := 0; i < 20; i++ {
+		put(t, s, &Product{Code: string(rune('a' + i)), Qty: int64(i % 4)})
+	}
+	typeId, err := r.GetTypeId("Product")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := 0
+	err = s.Iterate(typeId, func(store.Storable) bool {
+		n++
+		return n < 5
+	})
+	if err != nil || n != 5 {
+		t.Errorf("Iterate stopping after 5 visited %d, %v", n, err)
+	}
+
+	n = 0
+	for item, err := range s.GetAllSeq(typeId) {
+		if err != nil || item == nil {
+			t.Fatalf("GetAllSeq yielded %v, %v", item, err)
+		}
+		if n++; n == 7 {
+			break
+		}
+	}
+	if n != 7 {
+		t.Errorf("GetAllSeq stopping after 7 yielded %d", n)
+	}
+
+	n = 0
+	for _, err := range s.MatchSeq("Product.Qty", 2) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		n++
+	}
+	if n != 5 {
+		t.Errorf("MatchSeq yielded %d, want 5", n)
+	}
+
+	n = 0
+	for _, err := range s.RangeSeq("Product.Qty", 1, 2, &store.RangeOptions{Limit: 7}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		n++
+	}
+	if n != 7 {
+		t.Errorf("RangeSeq with Limit 7 yielded %d", n)
+	}
+
+	n = 0
+	for item, err := range s.MatchSeq("Product.Nope", 2) {
+		if !errors.Is(err, fault.ErrIndexNotFound) || item != nil {
+			t.Errorf("MatchSeq on a missing index yielded %v, %v", item, err)
+		}
+		n++
+	}
+	if n != 1 {
+		t.Errorf("MatchSeq on a missing index yielded %d times, want once", n)
+	}
+}
@@ -0,0 +1,151 @@
+package store
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+
+	"github.com/guyvdb/dstore/fault"
+)
+
+// A Codec turns Storables into the payload of stored values and back. The type
+// manager chooses the codec of each type; types without one use StorableCodec,
+// which calls the type's own Marshal and Unmarshal. Every value records the id
+// of the codec that wrote it, so a type can switch codec and still read what
+// was written before. Values are decoded by that id: the built-in codecs are
+// always known, and the store remembers the other codecs it writes with or is
+// given with RegisterCodec. Migrate rewrites old values with the current codec.
+//
+// Schema migrations receive the payload as written by the value's codec.
+type Codec interface {
+	// Id identifies the codec in stored values. Ids below 128 are reserved for
+	// the codecs of this package.
+	Id() byte
+	Encode(m Storable) ([]byte, error)
+	Decode(data []byte, m Storable) error
+}
+
+// Ids of the built-in codecs.
+const (
+	StorableCodecId byte = 0
+	JSONCodecId     byte = 1
+	GobCodecId      byte = 2
+	BinaryCodecId   byte = 3
+)
+
+var (
+	// StorableCodec uses the Marshal and Unmarshal methods of the Storable.
+	StorableCodec Codec = storableCodec{}
+
+	// JSONCodec encodes the Storable with encoding/json, ignoring its Marshal
+	// and Unmarshal methods.
+	JSONCodec Codec = jsonCodec{}
+
+	// GobCodec encodes the Storable with encoding/gob. Concrete types held in
+	// interface fields must be registered with gob.Register.
+	GobCodec Codec = gobCodec{}
+
+	// BinaryCodec is a compact positional encoding for structs. Fields may be
+	// appended to a struct, but not removed or reordered without a migration.
+	BinaryCodec Codec = binaryCodec{}
+)
+
+// builtinCodec returns the built-in codec with the given id, or nil.
+func builtinCodec(id byte) Codec {
+	switch id {
+	case StorableCodecId:
+		return StorableCodec
+	case JSONCodecId:
+		return JSONCodec
+	case GobCodecId:
+		return GobCodec
+	case BinaryCodecId:
+		return BinaryCodec
+	}
+	return nil
+}
+
+// RegisterCodec makes the store able to read values written with codec after
+// no type uses it any more. Codecs with the id of a built-in codec are ignored.
+// Register every custom codec the database may hold before the registry is
+// loaded, with types.WithCodecs or by calling it between NewBoltStore and Load.
+func (bs *BoltStore) RegisterCodec(codec Codec) {
+	if codec == nil || builtinCodec(codec.Id()) != nil {
+		return
+	}
+	bs.codecs.Store(codec.Id(), codec)
+}
+
+// codecOf returns the codec that objects of typeId are written with, and
+// registers it so that values written with it stay readable.
+func (bs *BoltStore) codecOf(typeId int64) Codec {
+	codec := bs.typeManager.Codec(typeId)
+	if codec == nil {
+		return StorableCodec
+	}
+	if _, found := bs.codecs.Load(codec.Id()); !found {
+		bs.RegisterCodec(codec)
+	}
+	return codec
+}
+
+// codecById returns the codec a value of typeId was written with.
+func (bs *BoltStore) codecById(typeId int64, id byte) (Codec, error) {
+	if codec := builtinCodec(id); codec != nil {
+		return codec, nil
+	}
+	if codec := bs.typeManager.Codec(typeId); codec != nil && codec.Id() == id {
+		return codec, nil
+	}
+	if codec, found := bs.codecs.Load(id); found {
+		return codec.(Codec), nil
+	}
+	return nil, fmt.Errorf("codec %d: %w", id, fault.ErrUnsupportedValueFormat)
+}
+
+type storableCodec struct{}
+
+func (storableCodec) Id() byte {
+	return StorableCodecId
+}
+
+func (storableCodec) Encode(m Storable) ([]byte, error) {
+	return m.Marshal()
+}
+
+func (storableCodec) Decode(data []byte, m Storable) error {
+	return m.Unmarshal(data)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Id() byte {
+	return JSONCodecId
+}
+
+func (jsonCodec) Encode(m Storable) ([]byte, error) {
+	return json.Marshal(m)
+}
+
+func (jsonCodec) Decode(data []byte, m Storable) error {
+	return json.Unmarshal(data, m)
+}
+
+type gobCodec struct{}
+
+func (gobCodec) Id() byte {
+	return GobCodecId
+}
+
+func (gobCodec) Encode(m Storable) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(m); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Decode(data []byte, m Storable) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(m)
+}
@@ -0,0 +1,165 @@
+package store_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/guyvdb/dstore/fault"
+	"github.com/guyvdb/dstore/store"
+	"github.com/guyvdb/dstore/types"
+)
+
+type Rich struct {
+	Id     *store.Id
+	Name   string
+	N      int32
+	U      uint16
+	F      float32
+	B      []byte
+	L      []string
+	M      map[string]int
+	P      *Inner
+	A      [2]int8
+	T      time.Time
+	Inner  Inner
+	hidden int
+}
+
+type Inner struct{ X, Y int }
+
+func (r *Rich) GetId() *store.Id         { return r.Id }
+func (r *Rich) SetId(id *store.Id)       { r.Id = id }
+func (r *Rich) GetTypeName() string      { return "Rich" }
+func (r *Rich) Marshal() ([]byte, error) { return store.JSONCodec.Encode(r) }
+func (r *Rich) Unmarshal(d []byte) error { return store.JSONCodec.Decode(d, r) }
+
+// reversedCodec is a custom codec: JSON written back to front.
+type reversedCodec struct{}
+
+func (reversedCodec) Id() byte { return 200 }
+
+func (reversedCodec) Encode(m store.Storable) ([]byte, error) {
+	data, err := json.Marshal(m)
+	slices.Reverse(data)
+	return data, err
+}
+
+func (reversedCodec) Decode(data []byte, m store.Storable) error {
+	data = slices.Clone(data)
+	slices.Reverse(data)
+	return json.Unmarshal(data, m)
+}
+
+func TestBinaryCodec(t *testing.T) {
+	in := &Rich{Id: store.NewId(1, 2), Name: "x", N: -5, U: 7, F: 1.5, B: []byte{1, 2}, L: []string{"a"}, M: map[string]int{"k": 3}, P: &Inner{1, 2}, A: [2]int8{-1, 1}, T: time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC), Inner: Inner{3, 4}}
+	data, err := store.BinaryCodec.Encode(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &Rich{}
+	if err := store.BinaryCodec.Decode(data, out); err != nil {
+		t.Fatal(err)
+	}
+	want, _ := store.JSONCodec.Encode(in)
+	got, _ := store.JSONCodec.Encode(out)
+	if !bytes.Equal(got, want) {
+		t.Errorf("decoded %s, want %s", got, want)
+	}
+
+	// Truncated values fail without panicking.
+	for i := 0; i < len(data); i++ {
+		store.BinaryCodec.Decode(data[:i], &Rich{})
+	}
+}
+
+// openCodecStore opens the store at path with Products written with codec.
+func openCodecStore(t *testing.T, path string, codec store.Codec, opts ...types.OpenOption) (store.Store, error) {
+	t.Helper()
+	r := types.NewSystemRegistry()
+	r.Register("Product", func() store.Storable { return &Product{} })
+	r.Index("Product", "Code", store.StringIndex, store.UniqueIndex)
+	r.SetCodec("Product", codec)
+	return types.OpenBoltStore(path, r, opts...)
+}
+
+// TestCodecSwitch writes Products with each built-in codec in turn, checking
+// that values written before a switch are still read, and that Migrate rewrites
+// them with the current codec.
+func TestCodecSwitch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	s, err := openCodecStore(t, path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := put(t, s, &Product{Code: "a", Qty: 1})
+	s.Close()
+
+	for i, codec := range []store.Codec{store.GobCodec, store.BinaryCodec, store.JSONCodec} {
+		if s, err = openCodecStore(t, path, codec); err != nil {
+			t.Fatal(err)
+		}
+		put(t, s, &Product{Code: fmt.Sprint("b", codec.Id()), Qty: int64(codec.Id())})
+		all, err := s.GetAllByTypeName("Product")
+		if err != nil {
+			t.Fatalf("codec %d: %v", codec.Id(), err)
+		}
+		if len(all) != i+2 {
+			t.Errorf("codec %d: GetAll found %d Products, want %d", codec.Id(), len(all), i+2)
+		}
+		if got, err := s.Get(first.Id); err != nil || got.(*Product).Code != "a" {
+			t.Errorf("codec %d: Get of the first Product = %v, %v", codec.Id(), got, err)
+		}
+		s.Close()
+	}
+
+	if s, err = openCodecStore(t, path, store.BinaryCodec); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if n, err := s.Migrate("Product"); err != nil || n != 3 {
+		t.Errorf("Migrate = %d, %v; want 3 objects rewritten", n, err)
+	}
+	if found, err := s.Match("Product.Code", "b2"); err != nil || len(found) != 1 {
+		t.Errorf("Match after Migrate found %d Products, %v; want 1", len(found), err)
+	}
+}
+
+// TestCustomCodecSwitch checks that values written with a custom codec are read
+// after their type switches to a built-in codec, as long as the store knows the
+// custom codec.
+func TestCustomCodecSwitch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	s, err := openCodecStore(t, path, reversedCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := put(t, s, &Product{Code: "old"})
+	s.Close()
+
+	// Without the custom codec the old value cannot be decoded.
+	if s, err = openCodecStore(t, path, store.JSONCodec); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(old.Id); !errors.Is(err, fault.ErrUnsupportedValueFormat) {
+		t.Errorf("Get without the custom codec returned %v, want %v", err, fault.ErrUnsupportedValueFormat)
+	}
+	s.Close()
+
+	if s, err = openCodecStore(t, path, store.JSONCodec, types.WithCodecs(reversedCodec{})); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	put(t, s, &Product{Code: "new"})
+	if got, err := s.Get(old.Id); err != nil || got.(*Product).Code != "old" {
+		t.Fatalf("Get with the custom codec registered = %v, %v; want the old Product", got, err)
+	}
+	if n, err := s.Migrate("Product"); err != nil || n != 1 {
+		t.Errorf("Migrate = %d, %v; want 1 object rewritten", n, err)
+	}
+}
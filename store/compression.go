@@ -0,0 +1,209 @@
+package store
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/guyvdb/dstore/fault"
+
+	"go.etcd.io/bbolt"
+)
+
+// Compression is the algorithm a stored payload is compressed with.
+type Compression byte
+
+const (
+	NoCompression Compression = iota
+	FlateCompression
+	GzipCompression
+)
+
+func (c Compression) String() string {
+	switch c {
+	case NoCompression:
+		return "None"
+	case FlateCompression:
+		return "Flate"
+	case GzipCompression:
+		return "Gzip"
+	}
+	return fmt.Sprintf("Compression(%d)", byte(c))
+}
+
+// CompressionOptions controls how the payloads of stored values are compressed.
+// Options set on a type in the type manager take precedence over the store wide
+// options set with SetCompression.
+type CompressionOptions struct {
+	Algorithm Compression
+	Level     int // flate level from 1 (fastest) to 9 (smallest), 0 for the default
+	MinSize   int // Payloads smaller than this are stored uncompressed
+}
+
+// CompressionStats summarises how the objects of a type are stored.
+type CompressionStats struct {
+	TypeName          string
+	Objects           int
+	Compressed        int   // Objects whose payload is compressed
+	StoredBytes       int64 // Size of the stored values, headers included
+	UncompressedBytes int64 // Size of the payloads before compression
+	SavedBytes        int64 // Bytes saved by compressing payloads
+}
+
+// SetCompression sets the compression options of types that have none of their
+// own. nil turns compression off. Values already stored keep their compression
+// until they are written again or Recompress is run.
+func (bs *BoltStore) SetCompression(opts *CompressionOptions) {
+	bs.compression.Store(opts)
+}
+
+// compressionOf returns the compression options of typeId, or nil.
+func (bs *BoltStore) compressionOf(typeId int64) *CompressionOptions {
+	if opts := bs.typeManager.Compression(typeId); opts != nil {
+		return opts
+	}
+	return bs.compression.Load()
+}
+
+// compressPayload compresses payload according to opts. It returns the payload
+// unchanged with NoCompression if it is below the size threshold or does not
+// get smaller.
+func compressPayload(opts *CompressionOptions, payload []byte) (Compression, []byte, error) {
+	if opts == nil || opts.Algorithm == NoCompression || len(payload) < opts.MinSize {
+		return NoCompression, payload, nil
+	}
+
+	level := opts.Level
+	if level == 0 {
+		level = flate.DefaultCompression
+	}
+
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	var err error
+	switch opts.Algorithm {
+	case FlateCompression:
+		w, err = flate.NewWriter(&buf, level)
+	case GzipCompression:
+		w, err = gzip.NewWriterLevel(&buf, level)
+	default:
+		return NoCompression, nil, fmt.Errorf("%s: %w", opts.Algorithm, fault.ErrUnsupportedCompression)
+	}
+	if err != nil {
+		return NoCompression, nil, err
+	}
+	if _, err := w.Write(payload); err != nil {
+		return NoCompression, nil, err
+	}
+	if err := w.Close(); err != nil {
+		return NoCompression, nil, err
+	}
+
+	if buf.Len() >= len(payload) {
+		return NoCompression, payload, nil
+	}
+	return opts.Algorithm, buf.Bytes(), nil
+}
+
+// decompressPayload reverses compressPayload. size is the uncompressed size
+// recorded in the value header.
+func decompressPayload(algorithm Compression, size int, payload []byte) ([]byte, error) {
+	var r io.Reader
+	switch algorithm {
+	case NoCompression:
+		return payload, nil
+	case FlateCompression:
+		r = flate.NewReader(bytes.NewReader(payload))
+	case GzipCompression:
+		gz, err := gzip.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", fault.ErrUnmarshalFailed, err)
+		}
+		r = gz
+	default:
+		return nil, fmt.Errorf("%s: %w", algorithm, fault.ErrUnsupportedCompression)
+	}
+
+	data := make([]byte, 0, size)
+	buf := bytes.NewBuffer(data)
+	// Never inflate beyond the recorded size, whatever the payload holds.
+	if _, err := io.Copy(buf, io.LimitReader(r, int64(size)+1)); err != nil {
+		return nil, fmt.Errorf("%w: %w", fault.ErrUnmarshalFailed, err)
+	}
+	if buf.Len() != size {
+		return nil, fmt.Errorf("decompressed %d bytes, expected %d: %w", buf.Len(), size, fault.ErrUnmarshalFailed)
+	}
+	return buf.Bytes(), nil
+}
+
+// CompressionStats reports how much space compression saves for typeName. It
+// reads the value headers only.
+func (bs *BoltStore) CompressionStats(typeName string) (*CompressionStats, error) {
+	typeId, err := bs.typeManager.GetTypeId(typeName)
+	if err != nil {
+		return nil, fault.ErrTypeNotFound
+	}
+
+	bucketNameBytes, err := bs.typeBucketKey(typeId)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &CompressionStats{TypeName: typeName}
+	err = bs.db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(bucketNameBytes)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			header, payload, err := decodeValue(v)
+			if err != nil {
+				return fmt.Errorf("object %s: %w", idBytesString(k), err)
+			}
+			stats.Objects++
+			stats.StoredBytes += int64(len(v))
+			if header.compression == NoCompression {
+				stats.UncompressedBytes += int64(len(payload))
+				return nil
+			}
+			stats.Compressed++
+			stats.UncompressedBytes += int64(header.size)
+			stored := len(payload)
+			if header.encrypted {
+				stored -= gcmOverhead
+			}
+			stats.SavedBytes += int64(header.size - stored)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// Recompress rewrites the objects of typeName whose compression algorithm
+// differs from the one the type is now configured with, or that are compressed
+// while below the size threshold. Payloads are rewritten as they are, without
+// decoding them, in batches of write transactions so that other writers are
+// not blocked for the whole pass; it is meant to be run in the background
+// after compression options change. It returns the number of objects
+// rewritten. progress may be nil.
+func (bs *BoltStore) Recompress(typeName string, progress ProgressFunc) (int, error) {
+	return bs.rewriteValues("Recompress", typeName, progress, func(typeId int64) (valueFilter, error) {
+		opts := bs.compressionOf(typeId)
+		want, minSize := NoCompression, 0
+		if opts != nil {
+			want, minSize = opts.Algorithm, opts.MinSize
+		}
+		return func(header valueHeader, payload []byte) bool {
+			small := plainSize(header, payload) < minSize
+			if header.compression == NoCompression {
+				return want != NoCompression && !small
+			}
+			return header.compression != want || small
+		}, nil
+	})
+}
@@ -0,0 +1,76 @@
+package store_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/guyvdb/dstore/store"
+)
+
+func TestRecompress(t *testing.T) {
+	s, r := openStore(t, filepath.Join(t.TempDir(), "db"), registerCodes)
+	const objects = 2500
+	long := strings.Repeat("lorem ipsum ", 50)
+	items := make([]store.Storable, objects)
+	for i := range items {
+		items[i] = &Product{Code: fmt.Sprint("p", i), Name: long}
+	}
+	if err := s.AllocateIds(items); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PutAll(items); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := s.CompressionStats("Product")
+	if err != nil || stats.Objects != objects || stats.Compressed != 0 {
+		t.Fatalf("CompressionStats before compressing = %+v, %v", stats, err)
+	}
+
+	// Store wide options apply to types without their own.
+	s.SetCompression(&store.CompressionOptions{Algorithm: store.FlateCompression, MinSize: 200})
+	batches := 0
+	n, err := s.Recompress("Product", func(done, total int) { batches++ })
+	if err != nil || n != objects || batches != 3 {
+		t.Fatalf("Recompress = %d, %v in %d batches; want %d in 3", n, err, batches, objects)
+	}
+	stats, err = s.CompressionStats("Product")
+	if err != nil || stats.Compressed != objects || stats.SavedBytes < stats.StoredBytes {
+		t.Errorf("CompressionStats after compressing = %+v, %v", stats, err)
+	}
+	if n, err := s.Recompress("Product", nil); err != nil || n != 0 {
+		t.Errorf("second Recompress = %d, %v; want nothing rewritten", n, err)
+	}
+
+	// Short values stay uncompressed.
+	short := put(t, s, &Product{Code: "short"})
+	if stats, err = s.CompressionStats("Product"); err != nil || stats.Compressed != objects {
+		t.Errorf("CompressionStats after a short Put = %+v, %v", stats, err)
+	}
+
+	// Options of the type take precedence.
+	r.SetCompression("Product", &store.CompressionOptions{Algorithm: store.GzipCompression, Level: 9})
+	if n, err := s.Recompress("Product", nil); err != nil || n != objects+1 {
+		t.Errorf("Recompress to gzip = %d, %v; want %d", n, err, objects+1)
+	}
+	all, err := s.GetAllByTypeName("Product")
+	if err != nil || len(all) != objects+1 || all[5].(*Product).Name != long {
+		t.Errorf("GetAll after Recompress to gzip returned %d, %v", len(all), err)
+	}
+	if got, err := s.Get(short.Id); err != nil || got.(*Product).Code != "short" {
+		t.Errorf("Get of the short Product = %v, %v", got, err)
+	}
+
+	r.SetCompression("Product", &store.CompressionOptions{Algorithm: store.NoCompression})
+	if n, err := s.Recompress("Product", nil); err != nil || n != objects+1 {
+		t.Errorf("Recompress to none = %d, %v; want %d", n, err, objects+1)
+	}
+	if stats, err = s.CompressionStats("Product"); err != nil || stats.Compressed != 0 {
+		t.Errorf("CompressionStats after decompressing = %+v, %v", stats, err)
+	}
+	if report, err := s.VerifyIndexes("Product"); err != nil || !report.OK() {
+		t.Errorf("VerifyIndexes = %+v, %v", report, err)
+	}
+}
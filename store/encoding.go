@@ -0,0 +1,238 @@
+package store
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/guyvdb/dstore/fault"
+)
+
+// dateTimeIndexLayout is the layout used to encode DateTimeIndex values.
+const dateTimeIndexLayout = "2006-01-02T15:04:05.000000000Z"
+
+// indexValueBytes extracts the value of the indexed property from a Storable
+// and encodes it for use in an index key. For a compound index the values of all
+// components are encoded as a tuple. It returns false if a value could not be
+// extracted; the GetIndexable<Type>Value functions log the reason.
+func indexValueBytes(m Storable, typeName string, index *IndexDefinition) ([]byte, bool) {
+	if !index.IsCompound() {
+		return propertyValueBytes(m, typeName, index.PropertyName, index.DataType)
+	}
+
+	var tuple []byte
+	for _, component := range index.Components {
+		valueBytes, ok := propertyValueBytes(m, typeName, component.PropertyName, component.DataType)
+		if !ok {
+			return nil, false
+		}
+		tuple = appendTupleComponent(tuple, component.DataType, valueBytes)
+	}
+	return tuple, true
+}
+
+// propertyValueBytes extracts and encodes the value of a single property.
+func propertyValueBytes(m Storable, typeName string, propertyName string, dataType IndexDataType) ([]byte, bool) {
+	var value interface{}
+	var ok bool
+
+	switch dataType {
+	case StringIndex:
+		value, ok = GetIndexableStringValue(m, typeName, propertyName)
+	case Int64Index:
+		value, ok = GetIndexableIntValue(m, typeName, propertyName)
+	case Float64Index:
+		value, ok = GetIndexableFloatValue(m, typeName, propertyName)
+	case BoolIndex:
+		value, ok = GetIndexableBoolValue(m, typeName, propertyName)
+	case DateTimeIndex:
+		value, ok = GetIndexableDateTimeValue(m, typeName, propertyName)
+	default:
+		slog.Warn("indexValueBytes: Unknown or unsupported index data type", "dataType", dataType.String(), "typeName", typeName, "property", propertyName)
+		return nil, false
+	}
+
+	if !ok {
+		return nil, false
+	}
+
+	valueBytes, err := encodeIndexValue(dataType, value)
+	if err != nil {
+		slog.Warn("indexValueBytes: Failed to encode index value", "typeName", typeName, "property", propertyName, "error", err)
+		return nil, false
+	}
+	return valueBytes, true
+}
+
+// encodeIndexKeyValue encodes a value passed to Match or Range for the given
+// index. For a compound index value must be a []interface{} holding the values
+// of the leading components in order. Fewer values than components select every
+// entry that starts with them.
+func encodeIndexKeyValue(index *IndexDefinition, value interface{}) ([]byte, error) {
+	if !index.IsCompound() {
+		return encodeIndexValue(index.DataType, value)
+	}
+
+	values, ok := value.([]interface{})
+	if !ok || len(values) == 0 || len(values) > len(index.Components) {
+		return nil, fmt.Errorf("expected []interface{} with 1 to %d values for compound index '%s', got %T: %w", len(index.Components), index.PropertyName, value, fault.ErrIndexValueTypeMismatch)
+	}
+
+	var tuple []byte
+	for i, v := range values {
+		component := index.Components[i]
+		valueBytes, err := encodeIndexValue(component.DataType, v)
+		if err != nil {
+			return nil, fmt.Errorf("component %s: %w", component.PropertyName, err)
+		}
+		tuple = appendTupleComponent(tuple, component.DataType, valueBytes)
+	}
+	return tuple, nil
+}
+
+// matchKeyValue encodes a value passed to Match as it appears in the keys of
+// index, hashing it for a hashed index. A hashed compound index needs a value
+// for every component.
+func (bs *BoltStore) matchKeyValue(index *IndexDefinition, value interface{}) ([]byte, error) {
+	valueBytes, err := encodeIndexKeyValue(index, value)
+	if err != nil || !index.Hashed {
+		return valueBytes, err
+	}
+	if values, _ := value.([]interface{}); index.IsCompound() && len(values) != len(index.Components) {
+		return nil, fmt.Errorf("partial match on compound index '%s': %w", index.PropertyName, fault.ErrHashedIndex)
+	}
+	return bs.hashIndexValue(valueBytes)
+}
+
+// appendTupleComponent appends an encoded component to a compound index value.
+// Strings are the only variable-width encoding, so they have 0x00 escaped as
+// 0x00 0xFF and are terminated by 0x00 0x01. That keeps the tuple in component
+// order and ensures no complete tuple is a prefix of another.
+func appendTupleComponent(tuple []byte, dataType IndexDataType, valueBytes []byte) []byte {
+	if dataType != StringIndex {
+		return append(tuple, valueBytes...)
+	}
+	for _, b := range valueBytes {
+		if b == 0 {
+			tuple = append(tuple, 0, 0xFF)
+		} else {
+			tuple = append(tuple, b)
+		}
+	}
+	return append(tuple, 0, 1)
+}
+
+// encodeIndexValue converts a value into the byte representation used in the
+// index buckets for the given IndexDataType. The same encoding is used when
+// writing index entries and when searching them, so a value passed to Match
+// must be convertible to the data type of the index.
+func encodeIndexValue(dataType IndexDataType, value interface{}) ([]byte, error) {
+	switch dataType {
+	case StringIndex:
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected string for %s index, got %T: %w", dataType, value, fault.ErrIndexValueTypeMismatch)
+		}
+		return []byte(s), nil
+
+	case Int64Index:
+		i, ok := toInt64(value)
+		if !ok {
+			return nil, fmt.Errorf("expected integer for %s index, got %T: %w", dataType, value, fault.ErrIndexValueTypeMismatch)
+		}
+		// XOR with (1 << 63) to make signed int64 lexicographically sortable
+		// Negative numbers become 0..., positive numbers become 1...
+		buf := make([]byte, 8)
+		binary.BigEndian.PutUint64(buf, uint64(i)^(1<<63))
+		return buf, nil
+
+	case Float64Index:
+		f, ok := toFloat64(value)
+		if !ok {
+			return nil, fmt.Errorf("expected float for %s index, got %T: %w", dataType, value, fault.ErrIndexValueTypeMismatch)
+		}
+		bits := math.Float64bits(f)
+		// For lexicographical sort of IEEE 754 floats:
+		// If positive (sign bit is 0), flip sign bit to 1.
+		// If negative (sign bit is 1), flip all bits.
+		if bits&(1<<63) == 0 { // Positive or +0
+			bits |= (1 << 63)
+		} else { // Negative or -0
+			bits = ^bits
+		}
+		buf := make([]byte, 8)
+		binary.BigEndian.PutUint64(buf, bits)
+		return buf, nil
+
+	case BoolIndex:
+		b, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("expected bool for %s index, got %T: %w", dataType, value, fault.ErrIndexValueTypeMismatch)
+		}
+		if b {
+			return []byte{1}, nil // True
+		}
+		return []byte{0}, nil // False
+
+	case DateTimeIndex:
+		t, ok := value.(time.Time)
+		if !ok {
+			return nil, fmt.Errorf("expected time.Time for %s index, got %T: %w", dataType, value, fault.ErrIndexValueTypeMismatch)
+		}
+		// A fixed-width UTC timestamp is lexicographically sortable and human-readable.
+		// RFC3339Nano is not: it trims trailing zeros and keeps the zone offset, so
+		// equal instants encode differently and ".5Z" sorts before "Z".
+		return t.UTC().AppendFormat(make([]byte, 0, len(dateTimeIndexLayout)), dateTimeIndexLayout), nil
+	}
+
+	return nil, fmt.Errorf("%s: %w", dataType, fault.ErrUnsupportedIndexDataType)
+}
+
+// toInt64 converts any signed or unsigned integer type that fits into an int64.
+func toInt64(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint:
+		if uint64(v) > math.MaxInt64 {
+			return 0, false
+		}
+		return int64(v), true
+	case uint64:
+		if v > math.MaxInt64 {
+			return 0, false
+		}
+		return int64(v), true
+	}
+	return 0, false
+}
+
+// toFloat64 converts floats and integers to a float64.
+func toFloat64(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	}
+	if i, ok := toInt64(value); ok {
+		return float64(i), true
+	}
+	return 0, false
+}
@@ -0,0 +1,206 @@
+package store
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/guyvdb/dstore/fault"
+)
+
+// A KeyProvider supplies the keys that stored values and hashed indexes are
+// protected with. Keys are identified by an id that is recorded with every
+// encrypted value, so that a provider can rotate to a new key while older keys
+// remain available to read what was written with them.
+type KeyProvider interface {
+	// CurrentKey returns the id and AES key (16, 24 or 32 bytes) new values are
+	// encrypted with.
+	CurrentKey() (uint32, []byte, error)
+
+	// Key returns the AES key with the given id.
+	Key(id uint32) ([]byte, error)
+
+	// IndexKey returns the HMAC key of hashed indexes. Hashed indexes must be
+	// rebuilt with Reindex when it changes.
+	IndexKey() ([]byte, error)
+}
+
+// SetKeyProvider sets the provider of encryption keys. It must be set before
+// objects of types the type manager marks as encrypted, or with hashed indexes,
+// are read or written. Loading a registry may already do either, so stores
+// holding such types are given their provider before the registry is loaded,
+// with types.WithKeyProvider or by calling it between NewBoltStore and Load.
+func (bs *BoltStore) SetKeyProvider(kp KeyProvider) {
+	bs.keys.Store(&kp)
+}
+
+// keyProvider returns the key provider or fault.ErrNoKeyProvider.
+func (bs *BoltStore) keyProvider() (KeyProvider, error) {
+	kp := bs.keys.Load()
+	if kp == nil || *kp == nil {
+		return nil, fault.ErrNoKeyProvider
+	}
+	return *kp, nil
+}
+
+// wrapValue compresses and, if the type is encrypted, seals payload according
+// to the current options of typeId, prefixes it with header and appends a
+// checksum. key is the object's key in its type bucket; encrypted values are
+// bound to it and to their header, so they cannot be moved to another object or
+// have their header altered.
+func (bs *BoltStore) wrapValue(typeId int64, key []byte, header valueHeader, payload []byte) ([]byte, valueHeader, error) {
+	var err error
+	header.size = len(payload)
+	if header.compression, payload, err = compressPayload(bs.compressionOf(typeId), payload); err != nil {
+		return nil, header, err
+	}
+
+	header.checksum = true
+	header.encrypted = bs.typeManager.Encrypted(typeId)
+	header.keyId = 0
+	if !header.encrypted {
+		return encodeValue(header, payload), header, nil
+	}
+
+	kp, err := bs.keyProvider()
+	if err != nil {
+		return nil, header, err
+	}
+	keyId, secret, err := kp.CurrentKey()
+	if err != nil {
+		return nil, header, fmt.Errorf("%w: %w", fault.ErrKeyNotAvailable, err)
+	}
+	header.keyId = keyId
+
+	prefix := appendHeader(nil, header)
+	sealed, err := seal(secret, valueAAD(key, prefix), payload)
+	if err != nil {
+		return nil, header, err
+	}
+	return appendChecksum(header, append(prefix, sealed...)), header, nil
+}
+
+// unwrapValue reverses wrapValue, returning the header and the plain payload of
+// a stored value.
+func (bs *BoltStore) unwrapValue(key, value []byte) (valueHeader, []byte, error) {
+	header, payload, err := decodeValue(value)
+	if err != nil {
+		return header, nil, err
+	}
+
+	if header.encrypted {
+		kp, err := bs.keyProvider()
+		if err != nil {
+			return header, nil, err
+		}
+		secret, err := kp.Key(header.keyId)
+		if err != nil {
+			return header, nil, fmt.Errorf("key %d: %w: %w", header.keyId, fault.ErrKeyNotAvailable, err)
+		}
+		prefix := value[:header.length]
+		if payload, err = open(secret, valueAAD(key, prefix), payload); err != nil {
+			return header, nil, err
+		}
+	}
+
+	payload, err = decompressPayload(header.compression, header.size, payload)
+	return header, payload, err
+}
+
+// valueAAD is the additional data authenticated with an encrypted value.
+func valueAAD(key, prefix []byte) []byte {
+	aad := make([]byte, 0, len(key)+len(prefix))
+	aad = append(aad, key...)
+	return append(aad, prefix...)
+}
+
+// gcmOverhead is the number of bytes sealing adds to a payload: the nonce in
+// front and the authentication tag behind.
+const gcmOverhead = 12 + 16
+
+// seal encrypts plaintext with AES-GCM under a random nonce, which is returned
+// in front of the ciphertext.
+func seal(secret, aad, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(secret)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize(), gcm.NonceSize()+len(plaintext)+gcm.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+// open decrypts a payload produced by seal.
+func open(secret, aad, sealed []byte) ([]byte, error) {
+	gcm, err := newGCM(secret)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fault.ErrDecryptionFailed
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, aad)
+	if err != nil {
+		return nil, fault.ErrDecryptionFailed
+	}
+	return plaintext, nil
+}
+
+func newGCM(secret []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(secret)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", fault.ErrKeyNotAvailable, err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// hashIndexValue replaces an encoded index value with its HMAC-SHA256, for
+// indexes declared as hashed.
+func (bs *BoltStore) hashIndexValue(valueBytes []byte) ([]byte, error) {
+	kp, err := bs.keyProvider()
+	if err != nil {
+		return nil, err
+	}
+	secret, err := kp.IndexKey()
+	if err != nil {
+		return nil, fmt.Errorf("index key: %w: %w", fault.ErrKeyNotAvailable, err)
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(valueBytes)
+	return mac.Sum(nil), nil
+}
+
+// Reencrypt rewrites the objects of typeName that are not sealed with the key
+// provider's current key, and encrypts or decrypts objects whose type has been
+// marked or unmarked as encrypted since they were written. Like Recompress it
+// works in batches of write transactions and is meant to be run in the
+// background, here after a key rotation. Old keys must remain available until
+// it completes. It returns the number of objects rewritten. progress may be
+// nil.
+func (bs *BoltStore) Reencrypt(typeName string, progress ProgressFunc) (int, error) {
+	return bs.rewriteValues("Reencrypt", typeName, progress, func(typeId int64) (valueFilter, error) {
+		if !bs.typeManager.Encrypted(typeId) {
+			return func(header valueHeader, _ []byte) bool {
+				return header.encrypted
+			}, nil
+		}
+
+		kp, err := bs.keyProvider()
+		if err != nil {
+			return nil, err
+		}
+		current, _, err := kp.CurrentKey()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", fault.ErrKeyNotAvailable, err)
+		}
+		return func(header valueHeader, _ []byte) bool {
+			return !header.encrypted || header.keyId != current
+		}, nil
+	})
+}
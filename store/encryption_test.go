@@ -0,0 +1,145 @@
+package store_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/guyvdb/dstore/fault"
+	"github.com/guyvdb/dstore/store"
+	"github.com/guyvdb/dstore/types"
+
+	"go.etcd.io/bbolt"
+)
+
+// testKeys is a KeyProvider holding its keys in memory.
+type testKeys struct {
+	current uint32
+	keys    map[uint32][]byte
+}
+
+func (k *testKeys) CurrentKey() (uint32, []byte, error) {
+	return k.current, k.keys[k.current], nil
+}
+
+func (k *testKeys) Key(id uint32) ([]byte, error) {
+	if key, found := k.keys[id]; found {
+		return key, nil
+	}
+	return nil, fmt.Errorf("key %d: %w", id, fault.ErrKeyNotAvailable)
+}
+
+func (k *testKeys) IndexKey() ([]byte, error) {
+	return []byte("index secret"), nil
+}
+
+// openEncrypted opens the store at path with Products encrypted and their Code
+// and Name indexes hashed.
+func openEncrypted(t *testing.T, path string, kp store.KeyProvider) store.Store {
+	t.Helper()
+	r := types.NewSystemRegistry()
+	r.Register("Product", func() store.Storable { return &Product{} })
+	r.Index("Product", "Code", store.StringIndex, store.UniqueIndex)
+	r.Index("Product", "Name", store.StringIndex, store.NonUniqueIndex)
+	r.Index("Product", "Qty", store.Int64Index, store.NonUniqueIndex)
+	r.HashIndex("Product", "Code")
+	r.HashIndex("Product", "Name")
+	r.SetEncrypted("Product", true)
+	s, err := types.OpenBoltStore(path, r, types.WithKeyProvider(kp), types.WithCompression(&store.CompressionOptions{Algorithm: store.FlateCompression}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestEncryption(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	kp := &testKeys{current: 1, keys: map[uint32][]byte{1: bytes.Repeat([]byte{1}, 32)}}
+	s := openEncrypted(t, path, kp)
+	const objects = 300
+	for i := 0; i < objects; i++ {
+		put(t, s, &Product{Code: fmt.Sprint("secret-", i), Name: "alice-wonderland", Qty: int64(i % 7)})
+	}
+
+	if found, err := s.Match("Product.Code", "secret-17"); err != nil || len(found) != 1 {
+		t.Errorf("Match on a hashed unique index found %d, %v; want 1", len(found), err)
+	}
+	if found, err := s.Match("Product.Name", "alice-wonderland"); err != nil || len(found) != objects {
+		t.Errorf("Match on a hashed index found %d, %v; want %d", len(found), err, objects)
+	}
+	if page, err := s.MatchPage("Product.Name", "alice-wonderland", "", 10); err != nil || len(page.Items) != 10 {
+		t.Errorf("MatchPage on a hashed index = %+v, %v", page, err)
+	}
+	if _, err := s.Range("Product.Code", "a", "z", nil); !errors.Is(err, fault.ErrHashedIndex) {
+		t.Errorf("Range on a hashed index returned %v, want %v", err, fault.ErrHashedIndex)
+	}
+	if _, err := s.WildcardMatch("Product.Code", "secret*"); !errors.Is(err, fault.ErrHashedIndex) {
+		t.Errorf("WildcardMatch on a hashed index returned %v, want %v", err, fault.ErrHashedIndex)
+	}
+	if found, err := s.Range("Product.Qty", 2, 2, nil); err != nil || len(found) == 0 {
+		t.Errorf("Range on an index that is not hashed found %d, %v", len(found), err)
+	}
+	if report, err := s.VerifyIndexes("Product"); err != nil || !report.OK() {
+		t.Errorf("VerifyIndexes = %+v, %v", report, err)
+	}
+
+	// Rotate the key.
+	kp.keys[2] = bytes.Repeat([]byte{2}, 16)
+	kp.current = 2
+	if n, err := s.Reencrypt("Product", nil); err != nil || n != objects {
+		t.Fatalf("Reencrypt = %d, %v; want %d", n, err, objects)
+	}
+	if n, err := s.Reencrypt("Product", nil); err != nil || n != 0 {
+		t.Errorf("second Reencrypt = %d, %v; want nothing rewritten", n, err)
+	}
+	delete(kp.keys, 1)
+	if all, err := s.GetAllByTypeName("Product"); err != nil || len(all) != objects {
+		t.Errorf("GetAll without the old key found %d, %v; want %d", len(all), err, objects)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing is stored in the clear, and values cannot be moved between
+	// objects.
+	damage(t, path, func(tx *bbolt.Tx) error {
+		err := tx.ForEach(func(name []byte, bucket *bbolt.Bucket) error {
+			return bucket.ForEach(func(k, v []byte) error {
+				if bytes.Contains(k, []byte("secret")) || bytes.Contains(v, []byte("secret")) || bytes.Contains(v, []byte("alice")) {
+					t.Errorf("bucket %s holds plaintext", name)
+				}
+				return nil
+			})
+		})
+		if err != nil {
+			return err
+		}
+		cursor := tx.Bucket([]byte("Type.Product")).Cursor()
+		_, first := cursor.First()
+		first = bytes.Clone(first)
+		second, _ := cursor.Next()
+		return tx.Bucket([]byte("Type.Product")).Put(bytes.Clone(second), first)
+	})
+
+	s = openEncrypted(t, path, kp)
+	if _, err := s.GetAllByTypeName("Product"); !errors.Is(err, fault.ErrDecryptionFailed) {
+		t.Errorf("GetAll with a moved value returned %v, want %v", err, fault.ErrDecryptionFailed)
+	}
+}
+
+func TestEncryptionWithoutKeys(t *testing.T) {
+	s, _ := openStore(t, filepath.Join(t.TempDir(), "db"), func(r *types.SystemRegistry) {
+		r.Register("Product", func() store.Storable { return &Product{} })
+		r.SetEncrypted("Product", true)
+	})
+	p := &Product{Code: "x"}
+	if err := s.AllocateId(p); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(p); !errors.Is(err, fault.ErrNoKeyProvider) {
+		t.Errorf("Put of an encrypted type without keys returned %v, want %v", err, fault.ErrNoKeyProvider)
+	}
+}
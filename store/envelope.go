@@ -0,0 +1,179 @@
+package store
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"math"
+
+	"github.com/guyvdb/dstore/fault"
+)
+
+// Stored values start with a small header so that the format of the payload can
+// evolve without guessing:
+//
+//	magic (0xDB) | flags (1 byte) | schema version (uvarint) | [codec id (1 byte)]
+//	  | [compression (1 byte) | uncompressed size (uvarint)] | [key id (uvarint)] | payload
+//	  | [checksum (4 bytes)]
+//
+// The codec id is present when flagCodec is set; values without it were
+// written by StorableCodec. The compression fields are present when
+// flagCompressed is set, in which case the payload is compressed. The key id is
+// present when flagEncrypted is set, in which case the payload is compressed
+// first and then sealed with AES-GCM. The checksum is present when
+// flagChecksum is set: the CRC-32C of everything before it, big-endian.
+//
+// Values written before the header was introduced hold the payload alone.
+// Opening such a database wraps them in a header once, see migrateValueFormat,
+// so every value read has one.
+const valueMagic byte = 0xDB
+
+// knownValueFlags holds the flag bits this version of the store understands.
+// Values carrying any other bit were written by a newer version and are refused.
+const knownValueFlags byte = flagCodec | flagCompressed | flagEncrypted | flagChecksum
+
+// Value flags.
+const (
+	flagCodec      byte = 1 << 0 // A codec id follows the schema version
+	flagCompressed byte = 1 << 1 // The payload is compressed
+	flagEncrypted  byte = 1 << 2 // The payload is encrypted
+	flagChecksum   byte = 1 << 3 // A checksum follows the payload
+)
+
+// checksumSize is the size of the checksum at the end of a value.
+const checksumSize = 4
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// valueHeader describes how the payload of a stored value was written.
+type valueHeader struct {
+	flags       byte
+	version     int
+	codec       byte
+	compression Compression
+	size        int // Uncompressed size of a compressed payload
+	encrypted   bool
+	keyId       uint32 // Id of the key an encrypted payload is sealed with
+	checksum    bool
+	length      int // Size of the header in the stored value
+}
+
+// encodeValue prefixes payload with its header and, if the header asks for one,
+// appends the checksum. The flags of optional header fields are set from the
+// fields themselves.
+func encodeValue(header valueHeader, payload []byte) []byte {
+	value := make([]byte, 0, 4+3*binary.MaxVarintLen64+len(payload)+checksumSize)
+	value = appendHeader(value, header)
+	return appendChecksum(header, append(value, payload...))
+}
+
+// appendHeader appends the encoded header to value.
+func appendHeader(value []byte, header valueHeader) []byte {
+	header.flags &^= flagCodec | flagCompressed | flagEncrypted | flagChecksum
+	if header.codec != StorableCodecId {
+		header.flags |= flagCodec
+	}
+	if header.compression != NoCompression {
+		header.flags |= flagCompressed
+	}
+	if header.encrypted {
+		header.flags |= flagEncrypted
+	}
+	if header.checksum {
+		header.flags |= flagChecksum
+	}
+
+	value = append(value, valueMagic, header.flags)
+	value = binary.AppendUvarint(value, uint64(header.version))
+	if header.flags&flagCodec != 0 {
+		value = append(value, header.codec)
+	}
+	if header.flags&flagCompressed != 0 {
+		value = append(value, byte(header.compression))
+		value = binary.AppendUvarint(value, uint64(header.size))
+	}
+	if header.flags&flagEncrypted != 0 {
+		value = binary.AppendUvarint(value, uint64(header.keyId))
+	}
+	return value
+}
+
+// appendChecksum appends the checksum of a complete header and payload if the
+// header asks for one.
+func appendChecksum(header valueHeader, value []byte) []byte {
+	if !header.checksum {
+		return value
+	}
+	return binary.BigEndian.AppendUint32(value, crc32.Checksum(value, castagnoli))
+}
+
+// decodeValue splits a stored value into its header and payload, verifying its
+// checksum if it has one. The payload shares memory with value.
+func decodeValue(value []byte) (valueHeader, []byte, error) {
+	if len(value) == 0 || value[0] != valueMagic {
+		return valueHeader{}, nil, fmt.Errorf("no header: %w", fault.ErrInvalidValueHeader)
+	}
+
+	if len(value) < 3 {
+		return valueHeader{}, nil, fmt.Errorf("value of %d bytes: %w", len(value), fault.ErrInvalidValueHeader)
+	}
+
+	header := valueHeader{flags: value[1]}
+	if header.flags&^knownValueFlags != 0 {
+		return valueHeader{}, nil, fmt.Errorf("flags %08b: %w", header.flags, fault.ErrUnsupportedValueFormat)
+	}
+
+	if header.flags&flagChecksum != 0 {
+		if len(value) < 3+checksumSize {
+			return valueHeader{}, nil, fmt.Errorf("value of %d bytes: %w", len(value), fault.ErrInvalidValueHeader)
+		}
+		end := len(value) - checksumSize
+		stored := binary.BigEndian.Uint32(value[end:])
+		if sum := crc32.Checksum(value[:end], castagnoli); sum != stored {
+			return valueHeader{}, nil, fmt.Errorf("computed %08x, stored %08x: %w", sum, stored, fault.ErrChecksumMismatch)
+		}
+		header.checksum = true
+		value = value[:end]
+	}
+
+	version, n := binary.Uvarint(value[2:])
+	if n <= 0 || version == 0 {
+		return valueHeader{}, nil, fmt.Errorf("schema version: %w", fault.ErrInvalidValueHeader)
+	}
+	header.version = int(version)
+	payload := value[2+n:]
+
+	if header.flags&flagCodec != 0 {
+		if len(payload) == 0 {
+			return valueHeader{}, nil, fmt.Errorf("codec id: %w", fault.ErrInvalidValueHeader)
+		}
+		header.codec = payload[0]
+		payload = payload[1:]
+	}
+
+	if header.flags&flagCompressed != 0 {
+		if len(payload) == 0 {
+			return valueHeader{}, nil, fmt.Errorf("compression: %w", fault.ErrInvalidValueHeader)
+		}
+		header.compression = Compression(payload[0])
+		size, n := binary.Uvarint(payload[1:])
+		if n <= 0 || size > math.MaxInt32 {
+			return valueHeader{}, nil, fmt.Errorf("uncompressed size: %w", fault.ErrInvalidValueHeader)
+		}
+		header.size = int(size)
+		payload = payload[1+n:]
+	}
+
+	if header.flags&flagEncrypted != 0 {
+		keyId, n := binary.Uvarint(payload)
+		if n <= 0 || keyId > math.MaxUint32 {
+			return valueHeader{}, nil, fmt.Errorf("key id: %w", fault.ErrInvalidValueHeader)
+		}
+		header.encrypted = true
+		header.keyId = uint32(keyId)
+		payload = payload[n:]
+	}
+
+	header.length = len(value) - len(payload)
+	return header, payload, nil
+}
@@ -0,0 +1,119 @@
+package store_test
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/guyvdb/dstore/store"
+	"github.com/guyvdb/dstore/types"
+
+	"go.etcd.io/bbolt"
+)
+
+// Blob marshals to its data alone, which may look like a value header.
+type Blob struct {
+	Id   *store.Id
+	Data []byte
+}
+
+func (b *Blob) GetId() *store.Id         { return b.Id }
+func (b *Blob) SetId(id *store.Id)       { b.Id = id }
+func (b *Blob) GetTypeName() string      { return "Blob" }
+func (b *Blob) Marshal() ([]byte, error) { return b.Data, nil }
+func (b *Blob) Unmarshal(d []byte) error { b.Data = bytes.Clone(d); return nil }
+
+func registerBlob(r *types.SystemRegistry) {
+	r.Register("Blob", func() store.Storable { return &Blob{} })
+}
+
+// TestLegacyValuesGetHeaders writes values without a header, as stores did
+// before headers were introduced, and checks that they read back unchanged,
+// including one that starts with what looks like a header.
+func TestLegacyValuesGetHeaders(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	payloads := [][]byte{
+		[]byte("plain"),
+		{0xDB, 0x00, 0x05, 'h', 'i'}, // Magic byte, no flags, schema version 5
+		{},
+	}
+
+	s, _ := openStore(t, path, registerBlob)
+	ids := make([]*store.Id, len(payloads))
+	for i := range payloads {
+		b := &Blob{Data: []byte("placeholder")}
+		if err := s.AllocateId(b); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Put(b); err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = b.Id
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := bbolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		// Strip the headers of every value, the registry's included.
+		err := tx.ForEach(func(name []byte, bucket *bbolt.Bucket) error {
+			if !bytes.HasPrefix(name, []byte("Type.")) || string(name) == "Type.Blob" {
+				return nil
+			}
+			var keys, values [][]byte
+			err := bucket.ForEach(func(k, v []byte) error {
+				keys = append(keys, bytes.Clone(k))
+				values = append(values, bytes.Clone(v[3:len(v)-4])) // Magic, flags, version and checksum
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for i := range keys {
+				if err := bucket.Put(keys[i], values[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		blobs := tx.Bucket([]byte("Type.Blob"))
+		for i, id := range ids {
+			if err := blobs.Put(id.Bytes(), payloads[i]); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket([]byte("Meta")).Delete([]byte("valueFormat"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, _ = openStore(t, path, registerBlob)
+	for i, id := range ids {
+		item, err := s.Get(id)
+		if err != nil {
+			t.Fatalf("Get %s: %v", id, err)
+		}
+		if got := item.(*Blob).Data; !bytes.Equal(got, payloads[i]) {
+			t.Errorf("Get %s = %x, want %x", id, got, payloads[i])
+		}
+	}
+
+	report, err := s.Scrub()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() {
+		t.Errorf("Scrub after migration reported problems: %+v", report.Problems)
+	}
+}
@@ -0,0 +1,125 @@
+package store_test
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/guyvdb/dstore/store"
+	"github.com/guyvdb/dstore/types"
+
+	"go.etcd.io/bbolt"
+)
+
+// Product is the Storable most store tests work with.
+type Product struct {
+	Id      *store.Id `json:"id"`
+	Code    string    `json:"code"`
+	Name    string    `json:"name"`
+	Price   float64   `json:"price"`
+	Qty     int64     `json:"qty"`
+	Active  bool      `json:"active"`
+	Created time.Time `json:"created"`
+}
+
+func (p *Product) GetId() *store.Id         { return p.Id }
+func (p *Product) SetId(id *store.Id)       { p.Id = id }
+func (p *Product) GetTypeName() string      { return "Product" }
+func (p *Product) Marshal() ([]byte, error) { return json.Marshal(p) }
+func (p *Product) Unmarshal(d []byte) error { return json.Unmarshal(d, p) }
+
+// registerProduct registers Product with an index on every property.
+func registerProduct(r *types.SystemRegistry) {
+	r.Register("Product", func() store.Storable { return &Product{} })
+	r.Index("Product", "Code", store.StringIndex, store.UniqueIndex)
+	r.Index("Product", "Name", store.StringIndex, store.NonUniqueIndex)
+	r.Index("Product", "Price", store.Float64Index, store.NonUniqueIndex)
+	r.Index("Product", "Qty", store.Int64Index, store.NonUniqueIndex)
+	r.Index("Product", "Active", store.BoolIndex, store.NonUniqueIndex)
+	r.Index("Product", "Created", store.DateTimeIndex, store.NonUniqueIndex)
+}
+
+// registerCodes registers Product with only its unique Code index.
+func registerCodes(r *types.SystemRegistry) {
+	r.Register("Product", func() store.Storable { return &Product{} })
+	r.Index("Product", "Code", store.StringIndex, store.UniqueIndex)
+}
+
+// openStore opens the store at path with a registry prepared by register and
+// closes it when the test ends.
+func openStore(t *testing.T, path string, register func(r *types.SystemRegistry)) (store.Store, *types.SystemRegistry) {
+	t.Helper()
+	r := types.NewSystemRegistry()
+	register(r)
+	s, err := store.NewBoltStore(path, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Load(s); err != nil {
+		s.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s, r
+}
+
+// newProductStore opens a new store holding Products.
+func newProductStore(t *testing.T) store.Store {
+	t.Helper()
+	s, _ := openStore(t, filepath.Join(t.TempDir(), "db"), registerProduct)
+	return s
+}
+
+// put allocates an Id for p if it has none and stores it.
+func put(t *testing.T, s store.Store, p *Product) *Product {
+	t.Helper()
+	if p.Id == nil {
+		if err := s.AllocateId(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Put(p); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// damage edits the raw buckets of the closed database at path.
+func damage(t *testing.T, path string, fn func(tx *bbolt.Tx) error) {
+	t.Helper()
+	db, err := bbolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Update(fn); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// codes returns the codes of a list of Products, in order.
+func codes(t *testing.T, items []store.Storable) []string {
+	t.Helper()
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		p, ok := item.(*Product)
+		if !ok {
+			t.Fatalf("got %T, want *Product", item)
+		}
+		result = append(result, p.Code)
+	}
+	return result
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -1,6 +1,7 @@
 package store
 
 import (
+	"encoding/binary"
 	"fmt"
 	"strconv"
 	"strings"
@@ -46,3 +47,34 @@ func IdFromString(s string) (*Id, error) {
 func (id *Id) String() string {
 	return fmt.Sprintf("%x-%x", id.TypeId, id.ObjectId)
 }
+
+// IdKeyLength is the length in bytes of the binary key encoding of an Id.
+const IdKeyLength = 16
+
+// Bytes returns the binary key encoding of the Id used for primary keys and
+// index references: TypeId followed by ObjectId, each as a fixed-width
+// big-endian integer. Keys therefore sort by type and then by allocation order.
+func (id *Id) Bytes() []byte {
+	buf := make([]byte, IdKeyLength)
+	binary.BigEndian.PutUint64(buf[0:8], uint64(id.TypeId))
+	binary.BigEndian.PutUint64(buf[8:16], uint64(id.ObjectId))
+	return buf
+}
+
+// IdFromBytes decodes an Id from the binary key encoding produced by Bytes.
+func IdFromBytes(b []byte) (*Id, error) {
+	if len(b) != IdKeyLength {
+		return nil, fmt.Errorf("%w: expected %d bytes, got %d", fault.ErrInvalidIdFormat, IdKeyLength, len(b))
+	}
+	return NewId(int64(binary.BigEndian.Uint64(b[0:8])), int64(binary.BigEndian.Uint64(b[8:16]))), nil
+}
+
+// idBytesString formats a binary Id for messages, falling back to hex if the
+// bytes are not a valid Id.
+func idBytesString(b []byte) string {
+	id, err := IdFromBytes(b)
+	if err != nil {
+		return fmt.Sprintf("%x", b)
+	}
+	return id.String()
+}
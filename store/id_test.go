@@ -0,0 +1,34 @@
+package store_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/guyvdb/dstore/fault"
+	"github.com/guyvdb/dstore/store"
+)
+
+func TestIdBytesOrder(t *testing.T) {
+	ids := []*store.Id{
+		store.NewId(1, 1),
+		store.NewId(1, 0xf),
+		store.NewId(1, 0x10),
+		store.NewId(1, 0x100),
+		store.NewId(2, 1),
+		store.NewId(0x10, 0),
+	}
+	for i, id := range ids {
+		back, err := store.IdFromBytes(id.Bytes())
+		if err != nil || *back != *id {
+			t.Errorf("IdFromBytes(%s.Bytes()) = %v, %v", id, back, err)
+		}
+		if i > 0 && bytes.Compare(ids[i-1].Bytes(), id.Bytes()) >= 0 {
+			t.Errorf("%s does not sort before %s", ids[i-1], id)
+		}
+	}
+
+	if _, err := store.IdFromBytes([]byte("3e9-1")); !errors.Is(err, fault.ErrInvalidIdFormat) {
+		t.Errorf("IdFromBytes of a hex string returned %v, want %v", err, fault.ErrInvalidIdFormat)
+	}
+}
@@ -17,14 +17,65 @@ const (
 	DateTimeIndex
 )
 
+// RangeOptions controls the bounds and ordering of a Range query.
+// The zero value gives an inclusive range in ascending order.
+type RangeOptions struct {
+	ExcludeLower bool // Exclude values equal to the lower bound
+	ExcludeUpper bool // Exclude values equal to the upper bound
+	Reverse      bool // Return results from the upper bound down to the lower bound
+	Limit        int  // Maximum number of results, 0 for no limit
+}
+
+// ProgressFunc is called periodically while a long running operation works
+// through the objects of a type, with the number of objects done so far and the
+// total number of objects.
+type ProgressFunc func(done, total int)
+
 //var _ Index = (*IndexDefinition)(nil)
 
+// IndexDefinition describes an index on a type. A simple index covers the
+// single property PropertyName. A compound index covers the ordered list of
+// Components, PropertyName then only names the index, and DataType is unused.
+//
+// A hashed index keys entries by the HMAC of their value instead of the value
+// itself, so that the values of encrypted types do not appear in plaintext. It
+// only supports equality matches; on a compound index every component must be
+// given.
 type IndexDefinition struct {
+	PropertyName string           `json:"propertyName"`
+	Type         IndexType        `json:"type"`
+	DataType     IndexDataType    `json:"dataType"`
+	Components   []IndexComponent `json:"components,omitempty"`
+	Hashed       bool             `json:"hashed,omitempty"`
+}
+
+// IndexComponent is one property of a compound index.
+type IndexComponent struct {
 	PropertyName string        `json:"propertyName"`
-	Type         IndexType     `json:"type"`
 	DataType     IndexDataType `json:"dataType"`
 }
 
+// IsCompound reports whether the index covers a list of properties.
+func (id *IndexDefinition) IsCompound() bool {
+	return len(id.Components) > 0
+}
+
+// Equal reports whether two definitions describe the same index.
+func (id *IndexDefinition) Equal(other *IndexDefinition) bool {
+	if id.PropertyName != other.PropertyName || id.Type != other.Type || id.Hashed != other.Hashed || len(id.Components) != len(other.Components) {
+		return false
+	}
+	if !id.IsCompound() {
+		return id.DataType == other.DataType
+	}
+	for i, component := range id.Components {
+		if component != other.Components[i] {
+			return false
+		}
+	}
+	return true
+}
+
 func (it IndexType) String() string {
 	return [...]string{"Unique", "NonUnique"}[it]
 }
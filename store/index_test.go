@@ -0,0 +1,89 @@
+package store_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/guyvdb/dstore/fault"
+	"github.com/guyvdb/dstore/store"
+	"github.com/guyvdb/dstore/types"
+)
+
+func TestCompoundIndexes(t *testing.T) {
+	s, _ := openStore(t, filepath.Join(t.TempDir(), "db"), func(r *types.SystemRegistry) {
+		r.Register("Product", func() store.Storable { return &Product{} })
+		r.CompoundIndex("Product", "NameCreated", store.NonUniqueIndex,
+			store.IndexComponent{PropertyName: "Name", DataType: store.StringIndex},
+			store.IndexComponent{PropertyName: "Created", DataType: store.DateTimeIndex})
+		r.CompoundIndex("Product", "NameCode", store.UniqueIndex,
+			store.IndexComponent{PropertyName: "Name", DataType: store.StringIndex},
+			store.IndexComponent{PropertyName: "Code", DataType: store.StringIndex})
+	})
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	// Names that share a prefix, or hold the component separator, must not
+	// match each other.
+	for i, name := range []string{"a", "a\x00b", "ab", "b"} {
+		for day := 0; day < 5; day++ {
+			put(t, s, &Product{Name: name, Code: string(rune('a' + day)), Created: base.AddDate(0, 0, day+i)})
+		}
+	}
+
+	if found, err := s.Match("Product.NameCreated", []interface{}{"a"}); err != nil || len(found) != 5 {
+		t.Errorf("Match on the first component found %d, %v; want 5", len(found), err)
+	}
+	if found, err := s.Match("Product.NameCreated", []interface{}{"a", base.AddDate(0, 0, 2)}); err != nil || len(found) != 1 {
+		t.Errorf("Match on both components found %d, %v; want 1", len(found), err)
+	}
+
+	tests := []struct {
+		name   string
+		lo, hi []interface{}
+		opts   *store.RangeOptions
+		want   int
+	}{
+		{"within a prefix", []interface{}{"ab", base.AddDate(0, 0, 3)}, []interface{}{"ab", base.AddDate(0, 0, 5)}, nil, 3},
+		{"to the end of a prefix", []interface{}{"ab", base.AddDate(0, 0, 3)}, []interface{}{"ab"}, &store.RangeOptions{Reverse: true}, 4},
+		{"between prefixes", []interface{}{"a"}, []interface{}{"ab"}, &store.RangeOptions{ExcludeLower: true}, 10},
+	}
+	for _, tt := range tests {
+		if found, err := s.Range("Product.NameCreated", tt.lo, tt.hi, tt.opts); err != nil || len(found) != tt.want {
+			t.Errorf("%s: Range found %d, %v; want %d", tt.name, len(found), err, tt.want)
+		}
+	}
+
+	typeId, err := s.TypeManager().GetTypeId("Product")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Put(&Product{Id: store.NewId(typeId, 99999), Name: "a", Code: "a"})
+	if !errors.Is(err, fault.ErrUniqueIndexConstraintViolation) {
+		t.Errorf("Put of a duplicate unique pair returned %v, want %v", err, fault.ErrUniqueIndexConstraintViolation)
+	}
+	if found, err := s.Match("Product.NameCode", []interface{}{"b", "c"}); err != nil || len(found) != 1 {
+		t.Errorf("Match on a unique pair found %d, %v; want 1", len(found), err)
+	}
+	if _, err := s.Match("Product.NameCode", "b"); !errors.Is(err, fault.ErrIndexValueTypeMismatch) {
+		t.Errorf("Match with a scalar returned %v, want %v", err, fault.ErrIndexValueTypeMismatch)
+	}
+	if _, err := s.WildcardMatch("Product.NameCode", "b*"); !errors.Is(err, fault.ErrUnsupportedIndexDataType) {
+		t.Errorf("WildcardMatch on a compound index returned %v, want %v", err, fault.ErrUnsupportedIndexDataType)
+	}
+
+	first, err := s.MatchPage("Product.NameCreated", []interface{}{"a"}, "", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := s.MatchPage("Product.NameCreated", []interface{}{"a"}, first.Next, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first.Items) != 3 || len(second.Items) != 2 || second.Next != "" {
+		t.Errorf("MatchPage returned pages of %d and %d, want 3 and 2", len(first.Items), len(second.Items))
+	}
+
+	if report, err := s.VerifyIndexes("Product"); err != nil || !report.OK() {
+		t.Errorf("VerifyIndexes = %+v, %v", report, err)
+	}
+}
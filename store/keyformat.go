@@ -0,0 +1,289 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/guyvdb/dstore/fault"
+
+	"go.etcd.io/bbolt"
+)
+
+// The Meta bucket holds store level settings such as the key format version.
+var metaBucketName = []byte("Meta")
+var keyFormatKey = []byte("keyFormat")
+
+const (
+	keyFormatHex    byte = 0 // Ids are keyed as "<typeid>-<objectid>" hex strings
+	keyFormatBinary byte = 1 // Ids are keyed with Id.Bytes()
+)
+
+// The index format is the encoding of the values in index keys. Index buckets
+// written in an older format are listed in the Meta bucket under
+// staleIndexPrefix until UpgradeIndexes has rebuilt them.
+var indexFormatKey = []byte("indexFormat")
+var staleIndexPrefix = []byte("staleIndex.")
+
+const (
+	indexFormatRFC3339 byte = 0 // DateTimeIndex values are RFC 3339 strings in their own zone
+	indexFormatFixed   byte = 1 // DateTimeIndex values are fixed-width UTC timestamps
+)
+
+// The value format records whether stored values have a header. Values written
+// before headers were introduced hold the payload alone.
+var valueFormatKey = []byte("valueFormat")
+
+const (
+	valueFormatRaw      byte = 0 // Values hold the payload alone
+	valueFormatEnvelope byte = 1 // Every value has a header
+)
+
+// kv is a copied key/value pair, safe to use after the cursor moves on.
+type kv struct {
+	k, v []byte
+}
+
+// migrateKeys upgrades a database written with hex string Id keys to the
+// binary key format. Type buckets are rekeyed with Id.Bytes(), index entries
+// have their Id references and NonUniqueIndex key suffixes rewritten. The whole
+// migration runs in one transaction and is recorded in the Meta bucket, so it
+// only ever runs once per database.
+func (bs *BoltStore) migrateKeys() error {
+	return bs.db.Update(func(tx *bbolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists(metaBucketName)
+		if err != nil {
+			return fmt.Errorf("failed to create meta bucket: %w", err)
+		}
+
+		if v := meta.Get(keyFormatKey); len(v) == 1 && v[0] >= keyFormatBinary {
+			return nil
+		}
+
+		var names [][]byte
+		err = tx.ForEach(func(name []byte, _ *bbolt.Bucket) error {
+			names = append(names, bytes.Clone(name))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, name := range names {
+			switch {
+			case bytes.HasPrefix(name, []byte("Type.")):
+				err = rewriteBucket(tx, name, migrateTypeEntry)
+			case bytes.HasPrefix(name, []byte("Index.")):
+				err = rewriteBucket(tx, name, migrateIndexEntry)
+			default:
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("failed to migrate keys of bucket %s: %w", string(name), err)
+			}
+		}
+
+		return meta.Put(keyFormatKey, []byte{keyFormatBinary})
+	})
+}
+
+// migrateValueFormat wraps every value of a database written before values had
+// a header in a header at schema version 1, written by StorableCodec. Values are
+// not inspected: a payload may well start with the magic byte. The whole
+// migration runs in one transaction and is recorded in the Meta bucket, so it
+// only ever runs once per database.
+func (bs *BoltStore) migrateValueFormat() error {
+	return bs.db.Update(func(tx *bbolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists(metaBucketName)
+		if err != nil {
+			return fmt.Errorf("failed to create meta bucket: %w", err)
+		}
+
+		if v := meta.Get(valueFormatKey); len(v) == 1 && v[0] >= valueFormatEnvelope {
+			return nil
+		}
+
+		err = tx.ForEach(func(name []byte, bucket *bbolt.Bucket) error {
+			if !bytes.HasPrefix(name, []byte("Type.")) {
+				return nil
+			}
+
+			// Collect the values first, a bucket must not be written while it is walked.
+			var legacy []kv
+			err := bucket.ForEach(func(k, v []byte) error {
+				legacy = append(legacy, kv{k: bytes.Clone(k), v: encodeValue(valueHeader{version: 1, checksum: true}, v)})
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			for _, e := range legacy {
+				if err := bucket.Put(e.k, e.v); err != nil {
+					return err
+				}
+			}
+			if len(legacy) > 0 {
+				slog.Info("BoltStore: Added headers to values written without one", "bucket", string(name), "values", len(legacy))
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to migrate values: %w", err)
+		}
+
+		return meta.Put(valueFormatKey, []byte{valueFormatEnvelope})
+	})
+}
+
+// migrateIndexFormat records the index buckets of a database written before the
+// current index format as stale. They can only be rebuilt once the type manager
+// knows their types, which UpgradeIndexes does.
+func (bs *BoltStore) migrateIndexFormat() error {
+	return bs.db.Update(func(tx *bbolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists(metaBucketName)
+		if err != nil {
+			return fmt.Errorf("failed to create meta bucket: %w", err)
+		}
+
+		if v := meta.Get(indexFormatKey); len(v) == 1 && v[0] >= indexFormatFixed {
+			return nil
+		}
+
+		stale := 0
+		err = tx.ForEach(func(name []byte, _ *bbolt.Bucket) error {
+			if !bytes.HasPrefix(name, []byte("Index.")) {
+				return nil
+			}
+			stale++
+			return meta.Put(append(bytes.Clone(staleIndexPrefix), name...), []byte{})
+		})
+		if err != nil {
+			return err
+		}
+
+		if stale > 0 {
+			slog.Info("BoltStore: Index buckets were written in an older format and will be rebuilt when their types load", "buckets", stale)
+		}
+		return meta.Put(indexFormatKey, []byte{indexFormatFixed})
+	})
+}
+
+// UpgradeIndexes rebuilds the index buckets written in an older index format
+// whose types the type manager knows. Buckets of types it does not know yet are
+// left for a later call, so type managers call it whenever they load types.
+func (t *boltTx) UpgradeIndexes() error {
+	if !t.tx.Writable() {
+		return fault.ErrTxNotWritable
+	}
+
+	meta := t.tx.Bucket(metaBucketName)
+	if meta == nil {
+		return nil
+	}
+
+	// Collect the markers first, a bucket must not be written while a cursor walks it.
+	var markers [][]byte
+	c := meta.Cursor()
+	for k, _ := c.Seek(staleIndexPrefix); k != nil && bytes.HasPrefix(k, staleIndexPrefix); k, _ = c.Next() {
+		markers = append(markers, bytes.Clone(k))
+	}
+
+	for _, marker := range markers {
+		bucketName := marker[len(staleIndexPrefix):]
+		if t.tx.Bucket(bucketName) != nil {
+			typeId, index, err := t.bs.resolveIndex(string(bucketName[len("Index."):]))
+			switch {
+			case errors.Is(err, fault.ErrTypeNotFound), errors.Is(err, fault.ErrInvalidIndexName):
+				continue
+			case errors.Is(err, fault.ErrIndexNotFound):
+				// The index is no longer declared, its bucket is dropped on load.
+			case err != nil:
+				return err
+			case usesDateTime(index):
+				slog.Info("BoltStore.UpgradeIndexes: Rebuilding index written in an older format", "bucket", string(bucketName))
+				if err := t.rebuildIndexes(typeId, []*IndexDefinition{index}, nil); err != nil {
+					return err
+				}
+			}
+		}
+		if err := meta.Delete(marker); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// usesDateTime reports whether index encodes a DateTimeIndex value, the only
+// encoding that changed between index formats.
+func usesDateTime(index *IndexDefinition) bool {
+	if !index.IsCompound() {
+		return index.DataType == DateTimeIndex
+	}
+	for _, component := range index.Components {
+		if component.DataType == DateTimeIndex {
+			return true
+		}
+	}
+	return false
+}
+
+// rewriteBucket replaces the contents of a bucket with the result of applying
+// convert to every entry.
+func rewriteBucket(tx *bbolt.Tx, name []byte, convert func(name []byte, e kv) kv) error {
+	var entries []kv
+	err := tx.Bucket(name).ForEach(func(k, v []byte) error {
+		entries = append(entries, convert(name, kv{k: bytes.Clone(k), v: bytes.Clone(v)}))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tx.DeleteBucket(name); err != nil {
+		return err
+	}
+	bucket, err := tx.CreateBucket(name)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if err := bucket.Put(e.k, e.v); err != nil {
+			return err
+		}
+	}
+
+	slog.Info("BoltStore: Migrated keys to binary format", "bucket", string(name), "entries", len(entries))
+	return nil
+}
+
+// migrateTypeEntry rekeys an object stored under its hex Id string.
+func migrateTypeEntry(name []byte, e kv) kv {
+	id, err := IdFromString(string(e.k))
+	if err != nil {
+		slog.Warn("BoltStore: Key is not a hex id, leaving it unchanged", "bucket", string(name), "key", fmt.Sprintf("%x", e.k))
+		return e
+	}
+	return kv{k: id.Bytes(), v: e.v}
+}
+
+// migrateIndexEntry rewrites an index entry whose value is a hex Id string.
+// NonUniqueIndex keys end with a null separator followed by that same string.
+func migrateIndexEntry(name []byte, e kv) kv {
+	id, err := IdFromString(string(e.v))
+	if err != nil {
+		slog.Warn("BoltStore: Index entry does not refer to a hex id, leaving it unchanged", "bucket", string(name), "key", fmt.Sprintf("%x", e.k))
+		return e
+	}
+
+	key := e.k
+	suffix := append([]byte{0}, e.v...)
+	if bytes.HasSuffix(e.k, suffix) {
+		key = make([]byte, 0, len(e.k)-len(e.v)+IdKeyLength)
+		key = append(key, e.k[:len(e.k)-len(e.v)]...)
+		key = append(key, id.Bytes()...)
+	}
+	return kv{k: key, v: id.Bytes()}
+}
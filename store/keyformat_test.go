@@ -0,0 +1,179 @@
+package store_test
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/guyvdb/dstore/store"
+
+	"go.etcd.io/bbolt"
+)
+
+// TestUpgradeIndexesRebuildsDateTimeIndex rewrites a DateTime index in the
+// RFC 3339 format used before index format 1 and checks that opening the store
+// rebuilds it.
+func TestUpgradeIndexesRebuildsDateTimeIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	s, _ := openStore(t, path, registerProduct)
+	for i := 0; i < 5; i++ {
+		created := base.Add(time.Duration(i) * time.Hour).In(time.FixedZone("", 3600*(i+1)))
+		put(t, s, &Product{Code: string(rune('a' + i)), Created: created})
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := bbolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("Index.Product.Created"))
+		var keys, values [][]byte
+		err := bucket.ForEach(func(k, v []byte) error {
+			keys = append(keys, bytes.Clone(k))
+			values = append(values, bytes.Clone(v))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for i, k := range keys {
+			id, err := store.IdFromBytes(values[i])
+			if err != nil {
+				return err
+			}
+			created, err := time.Parse("2006-01-02T15:04:05.000000000Z", string(k[:bytes.IndexByte(k, 0)]))
+			if err != nil {
+				return err
+			}
+			zone := time.FixedZone("", 3600*int(id.ObjectId))
+			old := append([]byte(created.In(zone).Format(time.RFC3339Nano)), 0)
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+			if err := bucket.Put(append(old, values[i]...), values[i]); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket([]byte("Meta")).Delete([]byte("indexFormat"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, _ = openStore(t, path, registerProduct)
+	found, err := s.Range("Product.Created", base, base.Add(4*time.Hour), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := codes(t, found), []string{"a", "b", "c", "d", "e"}; !equalStrings(got, want) {
+		t.Errorf("Range after upgrade = %v, want %v", got, want)
+	}
+
+	report, err := s.VerifyIndexes("Product")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() {
+		t.Errorf("VerifyIndexes after upgrade reported problems: %+v", report)
+	}
+}
+
+// TestMigrateKeys rewrites a database in the hex string key format used before
+// binary keys and checks that opening the store migrates it.
+func TestMigrateKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	s, _ := openStore(t, path, registerProduct)
+	for i := 0; i < 20; i++ {
+		put(t, s, &Product{Code: fmt.Sprintf("p%02d", i), Name: "same", Qty: int64(i % 3)})
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := bbolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		err := tx.ForEach(func(name []byte, bucket *bbolt.Bucket) error {
+			var entries [][2][]byte
+			err := bucket.ForEach(func(k, v []byte) error {
+				entries = append(entries, [2][]byte{bytes.Clone(k), bytes.Clone(v)})
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for _, e := range entries {
+				k, v := e[0], e[1]
+				switch {
+				case bytes.HasPrefix(name, []byte("Type.")):
+					id, err := store.IdFromBytes(k)
+					if err != nil {
+						return err
+					}
+					if err := bucket.Delete(k); err != nil {
+						return err
+					}
+					if err := bucket.Put([]byte(id.String()), v); err != nil {
+						return err
+					}
+				case bytes.HasPrefix(name, []byte("Index.")):
+					id, err := store.IdFromBytes(v)
+					if err != nil {
+						return err
+					}
+					key := k
+					if bytes.HasSuffix(k, v) {
+						key = append(bytes.Clone(k[:len(k)-len(v)]), id.String()...)
+					}
+					if err := bucket.Delete(k); err != nil {
+						return err
+					}
+					if err := bucket.Put(key, []byte(id.String())); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return tx.Bucket([]byte("Meta")).Delete([]byte("keyFormat"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, _ = openStore(t, path, registerProduct)
+	all, err := s.GetAllByTypeName("Product")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 20 || all[10].(*Product).Code != "p10" {
+		t.Fatalf("GetAll after migration = %v, want the 20 Products in allocation order", codes(t, all))
+	}
+	if found, err := s.Match("Product.Qty", 1); err != nil || len(found) != 7 {
+		t.Errorf("Match on a NonUniqueIndex after migration found %d, %v; want 7", len(found), err)
+	}
+	if found, err := s.Match("Product.Code", "p13"); err != nil || len(found) != 1 {
+		t.Errorf("Match on a UniqueIndex after migration found %d, %v; want 1", len(found), err)
+	}
+	if report, err := s.VerifyIndexes("Product"); err != nil || !report.OK() {
+		t.Errorf("VerifyIndexes after migration = %+v, %v", report, err)
+	}
+}
@@ -0,0 +1,108 @@
+package store_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/guyvdb/dstore/fault"
+	"github.com/guyvdb/dstore/store"
+)
+
+func TestMatch(t *testing.T) {
+	s := newProductStore(t)
+	now := time.Now()
+	put(t, s, &Product{Code: "A1", Name: "apple", Price: 1.5, Qty: 3, Active: true, Created: now})
+	put(t, s, &Product{Code: "A2", Name: "apple", Price: -2, Qty: -3, Created: now})
+	put(t, s, &Product{Code: "B1", Name: "apples", Price: 1.5, Qty: 3})
+
+	tests := []struct {
+		index string
+		value interface{}
+		want  []string
+	}{
+		{"Product.Code", "A2", []string{"A2"}},
+		{"Product.Code", "A", []string{}},
+		{"Product.Name", "apple", []string{"A1", "A2"}},
+		{"Product.Price", 1.5, []string{"A1", "B1"}},
+		{"Product.Qty", 3, []string{"A1", "B1"}},
+		{"Product.Qty", int32(-3), []string{"A2"}},
+		{"Product.Active", true, []string{"A1"}},
+		{"Product.Created", now, []string{"A1", "A2"}},
+	}
+	for _, tt := range tests {
+		found, err := s.Match(tt.index, tt.value)
+		if err != nil {
+			t.Errorf("Match(%s, %v): %v", tt.index, tt.value, err)
+			continue
+		}
+		if got := codes(t, found); !equalStrings(got, tt.want) {
+			t.Errorf("Match(%s, %v) = %v, want %v", tt.index, tt.value, got, tt.want)
+		}
+	}
+
+	errorTests := []struct {
+		index string
+		value interface{}
+		want  error
+	}{
+		{"Product.Nope", 1, fault.ErrIndexNotFound},
+		{"Product.Qty", "x", fault.ErrIndexValueTypeMismatch},
+		{"Nope", 1, fault.ErrInvalidIndexName},
+	}
+	for _, tt := range errorTests {
+		if _, err := s.Match(tt.index, tt.value); !errors.Is(err, tt.want) {
+			t.Errorf("Match(%s, %v) returned %v, want %v", tt.index, tt.value, err, tt.want)
+		}
+	}
+}
+
+// TestMatchValueWithNullByte checks that a lookup on a non-unique index does not
+// return objects whose value only starts with the one looked up, followed by a
+// 0x00 byte.
+func TestMatchValueWithNullByte(t *testing.T) {
+	s := newProductStore(t)
+	put(t, s, &Product{Code: "A", Name: "a"})
+	put(t, s, &Product{Code: "B", Name: "a\x00b"})
+	put(t, s, &Product{Code: "C", Name: "a\x00"})
+
+	for name, want := range map[string][]string{"a": {"A"}, "a\x00b": {"B"}, "a\x00": {"C"}} {
+		found, err := s.Match("Product.Name", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := codes(t, found); !equalStrings(got, want) {
+			t.Errorf("Match(%q) = %v, want %v", name, got, want)
+		}
+		page, err := s.MatchPage("Product.Name", name, "", 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := codes(t, page.Items); !equalStrings(got, want) {
+			t.Errorf("MatchPage(%q) = %v, want %v", name, got, want)
+		}
+		for _, reverse := range []bool{false, true} {
+			found, err = s.Range("Product.Name", name, name, &store.RangeOptions{Reverse: reverse})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := codes(t, found); !equalStrings(got, want) {
+				t.Errorf("Range(%q, %q, reverse %v) = %v, want %v", name, name, reverse, got, want)
+			}
+		}
+	}
+
+	// Keys of "a\x00" sort among those of "a", so only the set is checked.
+	for _, reverse := range []bool{false, true} {
+		found, err := s.Range("Product.Name", "a", "a\x00", &store.RangeOptions{Reverse: reverse})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := codes(t, found)
+		slices.Sort(got)
+		if !equalStrings(got, []string{"A", "C"}) {
+			t.Errorf("Range(\"a\", \"a\\x00\", reverse %v) = %v, want [A C]", reverse, got)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+
+	"github.com/guyvdb/dstore/fault"
+)
+
+// Migrate rewrites every object of typeName that is stored at an older schema
+// version at the current one, running the type manager's migrations, or that
+// was written with another codec than the current one. It then
+// rebuilds all indexes of the type from the rewritten objects. It returns the
+// number of objects that were rewritten.
+func (t *boltTx) Migrate(typeName string) (int, error) {
+	if !t.tx.Writable() {
+		return 0, fault.ErrTxNotWritable
+	}
+
+	typeId, err := t.bs.typeManager.GetTypeId(typeName)
+	if err != nil {
+		return 0, fault.ErrTypeNotFound
+	}
+
+	bucketNameBytes, err := t.bs.typeBucketKey(typeId)
+	if err != nil {
+		return 0, err
+	}
+
+	bucket := t.tx.Bucket(bucketNameBytes)
+	if bucket == nil {
+		return 0, nil
+	}
+
+	current := t.bs.typeManager.SchemaVersion(typeId)
+	codec := t.bs.codecOf(typeId).Id()
+
+	// Collect the keys first, a bucket must not be written while a cursor walks it.
+	var stale [][]byte
+	err = bucket.ForEach(func(k, v []byte) error {
+		header, _, err := decodeValue(v)
+		if err != nil {
+			return fmt.Errorf("object %s: %w", idBytesString(k), err)
+		}
+		if header.version < current || header.codec != codec {
+			stale = append(stale, bytes.Clone(k))
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if len(stale) == 0 {
+		return 0, nil
+	}
+
+	for _, k := range stale {
+		item, err := t.decodeItem(typeId, k, bucket.Get(k))
+		if err != nil {
+			return 0, fmt.Errorf("object %s: %w", idBytesString(k), err)
+		}
+
+		value, err := t.encodeItem(typeId, item)
+		if err != nil {
+			return 0, err
+		}
+
+		if err := bucket.Put(k, value); err != nil {
+			return 0, fault.ErrPutFailed
+		}
+	}
+
+	slog.Info("BoltStore.Migrate: Migrated objects to the current schema version and codec", "typeName", typeName, "version", current, "codec", codec, "objects", len(stale))
+
+	if err := t.rebuildIndexes(typeId, t.bs.typeManager.Indexes(typeId), nil); err != nil {
+		return 0, err
+	}
+
+	return len(stale), nil
+}
@@ -0,0 +1,151 @@
+package store
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/guyvdb/dstore/fault"
+)
+
+// Page is one page of results from GetPage, MatchPage or RangePage.
+type Page struct {
+	Items []Storable `json:"items"`
+	// Next is an opaque continuation token for the following page. It is empty
+	// when there are no more results. Tokens hold the last key read rather than
+	// an offset, so pages stay stable while other objects are written.
+	Next string `json:"next,omitempty"`
+}
+
+// encodePageToken turns the last key read into a continuation token.
+func encodePageToken(key []byte) string {
+	return base64.RawURLEncoding.EncodeToString(key)
+}
+
+// decodePageToken turns a continuation token back into the key to resume after.
+// An empty token starts from the beginning.
+func decodePageToken(token string) ([]byte, error) {
+	if token == "" {
+		return nil, nil
+	}
+	key, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(key) == 0 {
+		return nil, fmt.Errorf("page token '%s': %w", token, fault.ErrInvalidPageToken)
+	}
+	return key, nil
+}
+
+// ParsePageToken returns the Id to pass as 'after' to GetPage for a token taken
+// from Page.Next of a previous GetPage call.
+func ParsePageToken(token string) (*Id, error) {
+	key, err := decodePageToken(token)
+	if err != nil || key == nil {
+		return nil, err
+	}
+	id, err := IdFromBytes(key)
+	if err != nil {
+		return nil, fmt.Errorf("page token '%s': %w", token, fault.ErrInvalidPageToken)
+	}
+	return id, nil
+}
+
+// GetPage returns up to limit Storable models of the given typeName in key
+// order, starting after the given Id. A nil after starts from the beginning.
+func (t *boltTx) GetPage(typeName string, after *Id, limit int) (*Page, error) {
+	if limit <= 0 {
+		return nil, fmt.Errorf("limit %d: %w", limit, fault.ErrInvalidPageLimit)
+	}
+
+	typeId, err := t.bs.typeManager.GetTypeId(typeName)
+	if err != nil {
+		return nil, fault.ErrTypeNotFound
+	}
+
+	bucketNameBytes, err := t.bs.typeBucketKey(typeId)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &Page{Items: make([]Storable, 0, limit)}
+
+	bucket := t.tx.Bucket(bucketNameBytes)
+	if bucket == nil {
+		return page, nil
+	}
+
+	cursor := bucket.Cursor()
+
+	var k, v []byte
+	if after == nil {
+		k, v = cursor.First()
+	} else {
+		afterKey := after.Bytes()
+		if k, v = cursor.Seek(afterKey); k != nil && bytes.Equal(k, afterKey) {
+			k, v = cursor.Next()
+		}
+	}
+
+	var lastKey []byte
+	for ; k != nil; k, v = cursor.Next() {
+		if len(page.Items) == limit {
+			page.Next = encodePageToken(lastKey)
+			break
+		}
+		instance, err := t.decodeItem(typeId, k, v)
+		if err != nil {
+			return nil, err
+		}
+		page.Items = append(page.Items, instance)
+		lastKey = k
+	}
+
+	return page, nil
+}
+
+// MatchPage returns up to limit storables where an indexed property exactly
+// matches value, resuming after the continuation token 'after'.
+func (t *boltTx) MatchPage(indexName string, value interface{}, after string, limit int) (*Page, error) {
+	return t.RangePage(indexName, value, value, nil, after, limit)
+}
+
+// RangePage returns up to limit storables where an indexed property lies between
+// lo and hi, resuming after the continuation token 'after'. opts.Limit is ignored.
+func (t *boltTx) RangePage(indexName string, lo, hi interface{}, opts *RangeOptions, after string, limit int) (*Page, error) {
+	if limit <= 0 {
+		return nil, fmt.Errorf("limit %d: %w", limit, fault.ErrInvalidPageLimit)
+	}
+
+	afterKey, err := decodePageToken(after)
+	if err != nil {
+		return nil, err
+	}
+
+	scan, err := t.openRange(indexName, lo, hi, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &Page{Items: make([]Storable, 0, limit)}
+
+	var lastKey []byte
+	err = scan.walk(afterKey, func(k, v []byte) (bool, error) {
+		if len(page.Items) == limit {
+			page.Next = encodePageToken(lastKey)
+			return false, nil
+		}
+		item, err := t.readIndexedItem(indexName, v)
+		if err != nil {
+			return false, err
+		}
+		if item != nil {
+			page.Items = append(page.Items, item)
+		}
+		lastKey = k
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
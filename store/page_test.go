@@ -0,0 +1,94 @@
+package store_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/guyvdb/dstore/fault"
+	"github.com/guyvdb/dstore/store"
+)
+
+// TestPages reads Products page by page, adding one between pages, and checks
+// that every Product is returned once.
+func TestPages(t *testing.T) {
+	s := newProductStore(t)
+	for i := 0; i < 25; i++ {
+		put(t, s, &Product{Code: string(rune('A' + i)), Qty: int64(i % 2)})
+	}
+
+	seen := make(map[string]int)
+	var after *store.Id
+	pages := 0
+	for {
+		page, err := s.GetPage("Product", after, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages++
+		for _, code := range codes(t, page.Items) {
+			seen[code]++
+		}
+		if page.Next == "" {
+			break
+		}
+		if after, err = store.ParsePageToken(page.Next); err != nil {
+			t.Fatal(err)
+		}
+		if pages == 1 {
+			put(t, s, &Product{Code: "zz", Qty: 1})
+		}
+	}
+	if len(seen) != 26 || pages != 3 {
+		t.Errorf("GetPage returned %d Products in %d pages, want 26 in 3", len(seen), pages)
+	}
+	for code, n := range seen {
+		if n != 1 {
+			t.Errorf("GetPage returned %s %d times", code, n)
+		}
+	}
+
+	n := 0
+	for token := ""; ; {
+		page, err := s.MatchPage("Product.Qty", 1, token, 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n += len(page.Items)
+		if token = page.Next; token == "" {
+			break
+		}
+	}
+	if n != 13 {
+		t.Errorf("MatchPage returned %d Products, want 13", n)
+	}
+
+	var got []string
+	for token := ""; ; {
+		page, err := s.RangePage("Product.Code", "C", "J", &store.RangeOptions{Reverse: true}, token, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, codes(t, page.Items)...)
+		if token = page.Next; token == "" {
+			break
+		}
+	}
+	if want := []string{"J", "I", "H", "G", "F", "E", "D", "C"}; !equalStrings(got, want) {
+		t.Errorf("RangePage returned %v, want %v", got, want)
+	}
+
+	// A page that holds every result has no next token.
+	if page, err := s.MatchPage("Product.Code", "C", "", 5); err != nil || len(page.Items) != 1 || page.Next != "" {
+		t.Errorf("MatchPage of one Product = %+v, %v", page, err)
+	}
+}
+
+func TestPageErrors(t *testing.T) {
+	s := newProductStore(t)
+	if _, err := s.MatchPage("Product.Code", "C", "not a token", 5); !errors.Is(err, fault.ErrInvalidPageToken) {
+		t.Errorf("MatchPage with a bad token returned %v, want %v", err, fault.ErrInvalidPageToken)
+	}
+	if _, err := s.GetPage("Product", nil, 0); !errors.Is(err, fault.ErrInvalidPageLimit) {
+		t.Errorf("GetPage with limit 0 returned %v, want %v", err, fault.ErrInvalidPageLimit)
+	}
+}
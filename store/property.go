@@ -0,0 +1,108 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"time"
+)
+
+// PropertySource is implemented by Storables that keep their data outside of
+// struct fields, such as a map of properties. The GetIndexable<Type>Value
+// functions use it instead of reflection, coercing the values found to the data
+// type of the index the way they would appear after a round trip through JSON.
+type PropertySource interface {
+	// IndexableProperty returns the value of the named property. It returns false
+	// if the property does not apply to this object, in which case the object is
+	// simply left out of the index.
+	IndexableProperty(name string) (interface{}, bool)
+}
+
+// sourceValue reads a property from a PropertySource and coerces it to the Go
+// type used by dataType.
+func sourceValue(source PropertySource, typeName, propertyName string, dataType IndexDataType) (interface{}, bool) {
+	value, found := source.IndexableProperty(propertyName)
+	if !found {
+		slog.Debug("sourceValue: Property not present, skipping indexable property", "typeName", typeName, "property", propertyName)
+		return nil, false
+	}
+
+	coerced, ok := CoerceIndexValue(dataType, value)
+	if !ok {
+		slog.Warn("sourceValue: Property value cannot be coerced to the index data type", "typeName", typeName, "property", propertyName, "dataType", dataType.String(), "valueType", fmt.Sprintf("%T", value))
+		return nil, false
+	}
+	return coerced, true
+}
+
+// CoerceIndexValue converts a property value to the Go type used for dataType:
+// string, int64, float64, bool or time.Time. Besides the native types it accepts
+// what encoding/json decodes into an interface{}: float64 for integers as long
+// as they are whole numbers, json.Number, and RFC 3339 strings for date/times.
+func CoerceIndexValue(dataType IndexDataType, value interface{}) (interface{}, bool) {
+	if n, ok := value.(json.Number); ok {
+		if i, err := n.Int64(); err == nil && dataType == Int64Index {
+			return i, true
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return nil, false
+		}
+		value = f
+	}
+
+	switch dataType {
+	case StringIndex:
+		s, ok := value.(string)
+		return s, ok
+
+	case Int64Index:
+		if f, ok := value.(float64); ok {
+			if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+				return nil, false
+			}
+			return int64(f), true
+		}
+		return toInt64(value)
+
+	case Float64Index:
+		return toFloat64(value)
+
+	case BoolIndex:
+		b, ok := value.(bool)
+		return b, ok
+
+	case DateTimeIndex:
+		switch v := value.(type) {
+		case time.Time:
+			return v, true
+		case string:
+			t, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				return nil, false
+			}
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// indexApplies reports whether m is expected to have an entry in index. Objects
+// that are a PropertySource without the indexed properties are not.
+func indexApplies(m Storable, index *IndexDefinition) bool {
+	source, ok := m.(PropertySource)
+	if !ok {
+		return true
+	}
+	if !index.IsCompound() {
+		_, found := source.IndexableProperty(index.PropertyName)
+		return found
+	}
+	for _, component := range index.Components {
+		if _, found := source.IndexableProperty(component.PropertyName); !found {
+			return false
+		}
+	}
+	return true
+}
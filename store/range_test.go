@@ -0,0 +1,60 @@
+package store_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/guyvdb/dstore/store"
+)
+
+// quantities returns the Qty of a list of Products, in order.
+func quantities(items []store.Storable) []int64 {
+	result := make([]int64, 0, len(items))
+	for _, item := range items {
+		result = append(result, item.(*Product).Qty)
+	}
+	return result
+}
+
+func TestRange(t *testing.T) {
+	s := newProductStore(t)
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := -5; i <= 5; i++ {
+		// Times in different zones order by instant.
+		created := base.Add(time.Duration(i) * 500 * time.Millisecond).In(time.FixedZone("", 3600*i))
+		put(t, s, &Product{Code: string(rune('a' + i + 5)), Qty: int64(i), Price: float64(i) / 2, Created: created})
+	}
+	put(t, s, &Product{Code: "zz", Qty: 2, Price: 1})
+
+	tests := []struct {
+		name   string
+		index  string
+		lo, hi interface{}
+		opts   *store.RangeOptions
+		want   []int64
+	}{
+		{"inclusive", "Product.Qty", -2, 2, nil, []int64{-2, -1, 0, 1, 2, 2}},
+		{"exclusive", "Product.Qty", -2, 2, &store.RangeOptions{ExcludeLower: true, ExcludeUpper: true}, []int64{-1, 0, 1}},
+		{"open lower bound", "Product.Qty", nil, -3, nil, []int64{-5, -4, -3}},
+		{"open upper bound", "Product.Qty", 4, nil, nil, []int64{4, 5}},
+		{"reverse", "Product.Qty", 1, 3, &store.RangeOptions{Reverse: true}, []int64{3, 2, 2, 1}},
+		{"reverse exclusive", "Product.Qty", 1, 3, &store.RangeOptions{Reverse: true, ExcludeLower: true, ExcludeUpper: true}, []int64{2, 2}},
+		{"reverse limit", "Product.Qty", nil, nil, &store.RangeOptions{Reverse: true, Limit: 2}, []int64{5, 4}},
+		{"empty", "Product.Qty", 10, nil, &store.RangeOptions{Reverse: true}, []int64{}},
+		{"float", "Product.Price", nil, -1.5, nil, []int64{-5, -4, -3}},
+		{"datetime", "Product.Created", base.Add(-time.Second), base.Add(time.Second), &store.RangeOptions{ExcludeUpper: true}, []int64{-2, -1, 0, 1}},
+		{"string", "Product.Code", "b", "d", nil, []int64{-4, -3, -2}},
+		{"string reverse", "Product.Code", "b", "d", &store.RangeOptions{Reverse: true}, []int64{-2, -3, -4}},
+	}
+	for _, tt := range tests {
+		found, err := s.Range(tt.index, tt.lo, tt.hi, tt.opts)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := quantities(found); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: Range = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -7,7 +7,9 @@ import (
 )
 
 // GetIndexableStringValue uses reflection to extract the string value of a specified property
-// from a Storable item. It's intended for use in indexing.
+// from a Storable item. It's intended for use in indexing. Items that implement
+// PropertySource are asked for the property instead; the same holds for the other
+// GetIndexable<Type>Value functions.
 //
 // Parameters:
 //   - item: The Storable item from which to extract the value.
@@ -22,6 +24,14 @@ import (
 //     false otherwise. If false, a warning will be logged.
 func GetIndexableStringValue(item Storable, typeName, propertyName string) (string, bool) {
 
+	if source, ok := item.(PropertySource); ok {
+		value, ok := sourceValue(source, typeName, propertyName, StringIndex)
+		if !ok {
+			return "", false
+		}
+		return value.(string), true
+	}
+
 	v := reflect.ValueOf(item)
 	if v.Kind() == reflect.Ptr {
 		v = v.Elem()
@@ -60,10 +70,19 @@ func GetIndexableStringValue(item Storable, typeName, propertyName string) (stri
 //   - propertyName: The name of the property (struct field) to extract.
 //
 // Returns:
-//   - int64: The int64 value of the property if found, accessible, and of int64 type.
+//   - int64: The int64 value of the property if found, accessible, and of a signed
+//     integer type or an unsigned type no wider than uint32.
 //   - bool: True if the property was successfully extracted and is suitable for integer indexing,
 //     false otherwise. If false, a warning will be logged.
 func GetIndexableIntValue(item Storable, typeName, propertyName string) (int64, bool) {
+	if source, ok := item.(PropertySource); ok {
+		value, ok := sourceValue(source, typeName, propertyName, Int64Index)
+		if !ok {
+			return 0, false
+		}
+		return value.(int64), true
+	}
+
 	v := reflect.ValueOf(item)
 	if v.Kind() == reflect.Ptr {
 		v = v.Elem()
@@ -76,11 +95,20 @@ func GetIndexableIntValue(item Storable, typeName, propertyName string) (int64,
 
 	field := v.FieldByName(propertyName)
 
-	if !field.IsValid() || !field.CanInterface() || field.Kind() != reflect.Int64 {
-		slog.Warn("GetIndexableIntValue: Property not found, not exportable, or not an int64", "typeName", typeName, "property", propertyName, "kind", field.Kind().String())
+	if !field.IsValid() || !field.CanInterface() {
+		slog.Warn("GetIndexableIntValue: Property not found or not exportable", "typeName", typeName, "property", propertyName)
 		return 0, false
 	}
-	return field.Int(), true
+
+	switch field.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return field.Int(), true
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return int64(field.Uint()), true
+	}
+
+	slog.Warn("GetIndexableIntValue: Property is not an integer that fits an int64", "typeName", typeName, "property", propertyName, "kind", field.Kind().String())
+	return 0, false
 }
 
 // GetIndexableFloatValue uses reflection to extract the float64 value of a specified property
@@ -92,10 +120,18 @@ func GetIndexableIntValue(item Storable, typeName, propertyName string) (int64,
 //   - propertyName: The name of the property (struct field) to extract.
 //
 // Returns:
-//   - float64: The float64 value of the property if found, accessible, and of float64 type.
+//   - float64: The float64 value of the property if found, accessible, and of float32 or float64 type.
 //   - bool: True if the property was successfully extracted and is suitable for float indexing,
 //     false otherwise. If false, a warning will be logged.
 func GetIndexableFloatValue(item Storable, typeName, propertyName string) (float64, bool) {
+	if source, ok := item.(PropertySource); ok {
+		value, ok := sourceValue(source, typeName, propertyName, Float64Index)
+		if !ok {
+			return 0.0, false
+		}
+		return value.(float64), true
+	}
+
 	v := reflect.ValueOf(item)
 	if v.Kind() == reflect.Ptr {
 		v = v.Elem()
@@ -108,8 +144,8 @@ func GetIndexableFloatValue(item Storable, typeName, propertyName string) (float
 
 	field := v.FieldByName(propertyName)
 
-	if !field.IsValid() || !field.CanInterface() || field.Kind() != reflect.Float64 {
-		slog.Warn("GetIndexableFloatValue: Property not found, not exportable, or not a float64", "typeName", typeName, "property", propertyName, "kind", field.Kind().String())
+	if !field.IsValid() || !field.CanInterface() || (field.Kind() != reflect.Float64 && field.Kind() != reflect.Float32) {
+		slog.Warn("GetIndexableFloatValue: Property not found, not exportable, or not a float", "typeName", typeName, "property", propertyName, "kind", field.Kind().String())
 		return 0.0, false
 	}
 	return field.Float(), true
@@ -128,6 +164,14 @@ func GetIndexableFloatValue(item Storable, typeName, propertyName string) (float
 //   - bool: True if the property was successfully extracted and is suitable for boolean indexing,
 //     false otherwise. If false, a warning will be logged.
 func GetIndexableBoolValue(item Storable, typeName, propertyName string) (bool, bool) {
+	if source, ok := item.(PropertySource); ok {
+		value, ok := sourceValue(source, typeName, propertyName, BoolIndex)
+		if !ok {
+			return false, false
+		}
+		return value.(bool), true
+	}
+
 	v := reflect.ValueOf(item)
 	if v.Kind() == reflect.Ptr {
 		v = v.Elem()
@@ -160,6 +204,14 @@ func GetIndexableBoolValue(item Storable, typeName, propertyName string) (bool,
 //   - bool: True if the property was successfully extracted and is suitable for date/time indexing,
 //     false otherwise. If false, a warning will be logged.
 func GetIndexableDateTimeValue(item Storable, typeName, propertyName string) (time.Time, bool) {
+	if source, ok := item.(PropertySource); ok {
+		value, ok := sourceValue(source, typeName, propertyName, DateTimeIndex)
+		if !ok {
+			return time.Time{}, false
+		}
+		return value.(time.Time), true
+	}
+
 	v := reflect.ValueOf(item)
 	if v.Kind() == reflect.Ptr {
 		v = v.Elem()
@@ -172,9 +224,14 @@ func GetIndexableDateTimeValue(item Storable, typeName, propertyName string) (ti
 
 	field := v.FieldByName(propertyName)
 
+	if !field.IsValid() {
+		slog.Warn("GetIndexableDateTimeValue: Property not found", "typeName", typeName, "property", propertyName)
+		return time.Time{}, false
+	}
+
 	// Check if the field is of type time.Time
-	if !field.IsValid() || !field.CanInterface() || field.Type() != reflect.TypeOf(time.Time{}) {
-		slog.Warn("GetIndexableDateTimeValue: Property not found, not exportable, or not a time.Time", "typeName", typeName, "property", propertyName, "kind", field.Kind().String(), "actualType", field.Type().String())
+	if !field.CanInterface() || field.Type() != reflect.TypeOf(time.Time{}) {
+		slog.Warn("GetIndexableDateTimeValue: Property not exportable, or not a time.Time", "typeName", typeName, "property", propertyName, "kind", field.Kind().String(), "actualType", field.Type().String())
 		return time.Time{}, false
 	}
 
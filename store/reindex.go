@@ -0,0 +1,372 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+
+	"github.com/guyvdb/dstore/fault"
+
+	"go.etcd.io/bbolt"
+)
+
+// progressInterval is the number of objects between calls to a ProgressFunc.
+const progressInterval = 1000
+
+// Reindex drops the index on property of typeName and builds it again from the
+// objects in the type bucket.
+func (t *boltTx) Reindex(typeName, property string, progress ProgressFunc) error {
+	if !t.tx.Writable() {
+		return fault.ErrTxNotWritable
+	}
+
+	typeId, index, err := t.bs.resolveIndex(typeName + "." + property)
+	if err != nil {
+		return err
+	}
+
+	return t.rebuildIndexes(typeId, []*IndexDefinition{index}, progress)
+}
+
+// DropIndex deletes the bucket of the index on property of typeName. The index
+// does not need to be declared, so buckets of removed indexes can be dropped.
+func (t *boltTx) DropIndex(typeName, property string) error {
+	if !t.tx.Writable() {
+		return fault.ErrTxNotWritable
+	}
+
+	typeId, err := t.bs.typeManager.GetTypeId(typeName)
+	if err != nil {
+		return fault.ErrTypeNotFound
+	}
+
+	indexBucketNameBytes, err := t.bs.mkIndexBucketName(typeId, property)
+	if err != nil {
+		return err
+	}
+
+	// Empty the shadow of an index being rebuilt too, so that Reindex does not
+	// bring back the entries of objects DeleteAllByTypeName removes.
+	if t.shadowIndex(indexBucketNameBytes) != nil {
+		if err := t.resetShadowIndex(indexBucketNameBytes); err != nil {
+			return err
+		}
+	}
+
+	if t.tx.Bucket(indexBucketNameBytes) == nil {
+		return nil
+	}
+	if err := t.tx.DeleteBucket(indexBucketNameBytes); err != nil {
+		return fmt.Errorf("failed to drop index bucket %s: %w", string(indexBucketNameBytes), err)
+	}
+
+	slog.Info("BoltStore.DropIndex: Dropped index", "typeName", typeName, "property", property)
+	return nil
+}
+
+// Reindex rebuilds the index on property of typeName from the stored objects in
+// batches of write transactions, like Recompress, so that other writers are not
+// blocked for the whole pass. The new entries go into a shadow bucket that a
+// last transaction swaps in for the index, so queries see the old index until
+// then and a failed pass leaves it as it was. Writers keep the
+// shadow bucket in step with the objects the pass has already reached, and
+// uniqueness is enforced in it as in the index. Calls are serialized.
+func (bs *BoltStore) Reindex(typeName, property string, progress ProgressFunc) error {
+	typeId, index, err := bs.resolveIndex(typeName + "." + property)
+	if err != nil {
+		return err
+	}
+	name, err := bs.mkIndexBucketName(typeId, index.PropertyName)
+	if err != nil {
+		return err
+	}
+
+	bs.reindexing.Lock()
+	defer bs.reindexing.Unlock()
+
+	// Writers only update the shadow bucket once it is registered, changes made
+	// before that are in the objects the batches read.
+	bs.shadowIndexes.Store(string(name), true)
+	defer bs.shadowIndexes.Delete(string(name))
+
+	var total int
+	err = bs.db.Update(func(tx *bbolt.Tx) error {
+		t := &boltTx{bs: bs, tx: tx}
+		if err := t.resetShadowIndex(name); err != nil {
+			return err
+		}
+		var err error
+		total, err = t.Count(typeId)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	slog.Info("BoltStore.Reindex: Building index", "typeName", typeName, "property", property, "objects", total)
+
+	done := 0
+	var after []byte
+	for more := true; more; {
+		var batchDone int
+		err := bs.db.Update(func(tx *bbolt.Tx) error {
+			t := &boltTx{bs: bs, tx: tx}
+			var err error
+			after, batchDone, more, err = t.indexBatch(typeId, name, after, rewriteBatchSize)
+			return err
+		})
+		if err != nil {
+			bs.dropShadowIndex(name)
+			return err
+		}
+		done += batchDone
+		if progress != nil {
+			progress(done, total)
+		}
+	}
+
+	err = bs.db.Update(func(tx *bbolt.Tx) error {
+		t := &boltTx{bs: bs, tx: tx}
+		return t.swapShadowIndex(name)
+	})
+	if err != nil {
+		bs.dropShadowIndex(name)
+		return err
+	}
+
+	slog.Info("BoltStore.Reindex: Built index", "typeName", typeName, "property", property, "objects", done)
+	return nil
+}
+
+// shadowBucketName returns the name of the bucket that holds the shadow of the
+// index bucket name while Reindex builds it. The shadow is a nested bucket of
+// that name, so it can be moved into place under the name of the index.
+func shadowBucketName(name []byte) []byte {
+	return append([]byte("Reindex."), name[len("Index."):]...)
+}
+
+// shadowIndex returns the shadow of the index bucket name that Reindex is
+// building, or nil if the index is not being rebuilt.
+func (t *boltTx) shadowIndex(name []byte) *bbolt.Bucket {
+	if _, rebuilding := t.bs.shadowIndexes.Load(string(name)); !rebuilding {
+		return nil
+	}
+	holder := t.tx.Bucket(shadowBucketName(name))
+	if holder == nil {
+		return nil
+	}
+	return holder.Bucket(name)
+}
+
+// resetShadowIndex replaces the shadow of the index bucket name, or what is left
+// of one from an interrupted Reindex, with an empty one.
+func (t *boltTx) resetShadowIndex(name []byte) error {
+	holderName := shadowBucketName(name)
+	if t.tx.Bucket(holderName) != nil {
+		if err := t.tx.DeleteBucket(holderName); err != nil {
+			return fmt.Errorf("failed to drop shadow index bucket %s: %w", string(holderName), err)
+		}
+	}
+	holder, err := t.tx.CreateBucket(holderName)
+	if err != nil {
+		return fmt.Errorf("failed to create shadow index bucket %s: %w", string(holderName), fault.ErrBucketCreateFailed)
+	}
+	if _, err := holder.CreateBucket(name); err != nil {
+		return fmt.Errorf("failed to create shadow index bucket %s: %w", string(holderName), fault.ErrBucketCreateFailed)
+	}
+	return nil
+}
+
+// swapShadowIndex replaces the index bucket name with its shadow. MoveBucket
+// moves the committed state of a bucket, so the shadow must not have been
+// written in t.
+func (t *boltTx) swapShadowIndex(name []byte) error {
+	holderName := shadowBucketName(name)
+	holder := t.tx.Bucket(holderName)
+	if holder == nil || holder.Bucket(name) == nil {
+		return fmt.Errorf("shadow index bucket %s: %w", string(holderName), fault.ErrBucketNotFound)
+	}
+
+	if t.tx.Bucket(name) != nil {
+		if err := t.tx.DeleteBucket(name); err != nil {
+			return fmt.Errorf("failed to drop index bucket %s: %w", string(name), err)
+		}
+	}
+	if err := t.tx.MoveBucket(name, holder, nil); err != nil {
+		return fmt.Errorf("failed to move shadow index bucket %s into place: %w", string(holderName), err)
+	}
+	return t.tx.DeleteBucket(holderName)
+}
+
+// dropShadowIndex deletes the shadow of the index bucket name after a failed
+// Reindex. A shadow that cannot be deleted is only logged, the next Reindex of
+// the index replaces it.
+func (bs *BoltStore) dropShadowIndex(name []byte) {
+	holderName := shadowBucketName(name)
+	err := bs.db.Update(func(tx *bbolt.Tx) error {
+		if tx.Bucket(holderName) == nil {
+			return nil
+		}
+		return tx.DeleteBucket(holderName)
+	})
+	if err != nil {
+		slog.Warn("BoltStore.Reindex: Failed to drop shadow index bucket", "bucketName", string(holderName), "error", err)
+	}
+}
+
+// indexBatch writes the entries of up to limit objects of typeId that follow
+// the key after, or the first ones if after is nil, into the shadow of the index
+// bucket name. It returns the key of the last object written and whether more
+// follow.
+func (t *boltTx) indexBatch(typeId int64, name []byte, after []byte, limit int) ([]byte, int, bool, error) {
+	bucketNameBytes, err := t.bs.typeBucketKey(typeId)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	shadow := t.shadowIndex(name)
+	if shadow == nil {
+		return nil, 0, false, fmt.Errorf("shadow index bucket %s: %w", string(shadowBucketName(name)), fault.ErrBucketNotFound)
+	}
+	bucket := t.tx.Bucket(bucketNameBytes)
+	if bucket == nil {
+		return after, 0, false, nil
+	}
+
+	c := bucket.Cursor()
+	k, v := c.First()
+	if after != nil {
+		k, v = c.Seek(after)
+		if bytes.Equal(k, after) {
+			k, v = c.Next()
+		}
+	}
+
+	done := 0
+	for ; k != nil && done < limit; k, v = c.Next() {
+		item, err := t.decodeItem(typeId, k, v)
+		if err != nil {
+			return nil, 0, false, err
+		}
+		entries, err := t.bs.indexEntries(item)
+		if err != nil {
+			return nil, 0, false, err
+		}
+		for _, entry := range entries {
+			if !bytes.Equal(entry.bucketName, name) {
+				continue
+			}
+			if err := putIndexEntry(shadow, entry, item.GetId().Bytes()); err != nil {
+				return nil, 0, false, err
+			}
+		}
+		after = bytes.Clone(k)
+		done++
+	}
+	return after, done, k != nil, nil
+}
+
+// resetIndexBuckets replaces the buckets of the given indexes of typeId with
+// empty ones and returns their names.
+func (t *boltTx) resetIndexBuckets(typeId int64, indexes []*IndexDefinition) ([][]byte, error) {
+	bucketNames := make([][]byte, 0, len(indexes))
+	for _, index := range indexes {
+		indexBucketNameBytes, err := t.bs.mkIndexBucketName(typeId, index.PropertyName)
+		if err != nil {
+			return nil, err
+		}
+		bucketNames = append(bucketNames, indexBucketNameBytes)
+
+		if t.tx.Bucket(indexBucketNameBytes) != nil {
+			if err := t.tx.DeleteBucket(indexBucketNameBytes); err != nil {
+				return nil, fmt.Errorf("failed to drop index bucket %s: %w", string(indexBucketNameBytes), err)
+			}
+		}
+		// Create the bucket even if no object has a value for it, so that it
+		// shows the index has been built.
+		if _, err := t.tx.CreateBucket(indexBucketNameBytes); err != nil {
+			return nil, fmt.Errorf("failed to create index bucket %s: %w", string(indexBucketNameBytes), fault.ErrBucketCreateFailed)
+		}
+	}
+	return bucketNames, nil
+}
+
+// writeIndexEntries writes the entries of item that belong to the index buckets
+// names.
+func (t *boltTx) writeIndexEntries(item Storable, names [][]byte) error {
+	entries, err := t.bs.indexEntries(item)
+	if err != nil {
+		return err
+	}
+
+	idBytes := item.GetId().Bytes()
+	for _, entry := range entries {
+		if !containsBucketName(names, entry.bucketName) {
+			continue
+		}
+		if err := t.writeIndexEntry(entry, idBytes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rebuildIndexes drops the buckets of the given indexes of typeId and writes them
+// again in a single pass over the stored objects.
+func (t *boltTx) rebuildIndexes(typeId int64, indexes []*IndexDefinition, progress ProgressFunc) error {
+	if len(indexes) == 0 {
+		return nil
+	}
+
+	typeName, err := t.bs.typeManager.GetTypeName(typeId)
+	if err != nil {
+		return fault.ErrTypeNotFound
+	}
+
+	bucketNames, err := t.resetIndexBuckets(typeId, indexes)
+	if err != nil {
+		return err
+	}
+
+	total, err := t.Count(typeId)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("BoltStore: Building indexes", "typeName", typeName, "indexes", len(indexes), "objects", total)
+
+	done := 0
+	var indexErr error
+	err = t.Iterate(typeId, func(item Storable) bool {
+		if indexErr = t.writeIndexEntries(item, bucketNames); indexErr != nil {
+			return false
+		}
+
+		done++
+		if progress != nil && done%progressInterval == 0 {
+			progress(done, total)
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if indexErr != nil {
+		return indexErr
+	}
+
+	if progress != nil {
+		progress(done, total)
+	}
+	slog.Info("BoltStore: Built indexes", "typeName", typeName, "indexes", len(indexes), "objects", done)
+	return nil
+}
+
+// containsBucketName reports whether names holds name.
+func containsBucketName(names [][]byte, name []byte) bool {
+	for _, candidate := range names {
+		if bytes.Equal(candidate, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,181 @@
+package store_test
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/guyvdb/dstore/fault"
+	"github.com/guyvdb/dstore/store"
+	"github.com/guyvdb/dstore/types"
+
+	"go.etcd.io/bbolt"
+)
+
+// TestVerifyIndexesMissingProperty checks that indexes over a property the type
+// does not have report SkippedValue for every object, whatever their data type.
+func TestVerifyIndexesMissingProperty(t *testing.T) {
+	s, _ := openStore(t, filepath.Join(t.TempDir(), "db"), func(r *types.SystemRegistry) {
+		registerProduct(r)
+		r.Index("Product", "Due", store.DateTimeIndex, store.NonUniqueIndex)
+		r.Index("Product", "Weight", store.Float64Index, store.NonUniqueIndex)
+	})
+	for i := 0; i < 3; i++ {
+		put(t, s, &Product{Code: fmt.Sprint(i)})
+	}
+
+	for _, property := range []string{"Due", "Weight"} {
+		if err := s.Reindex("Product", property, nil); err != nil {
+			t.Fatalf("Reindex %s: %v", property, err)
+		}
+	}
+
+	report, err := s.VerifyIndexes("Product")
+	if err != nil {
+		t.Fatal(err)
+	}
+	skipped := make(map[string]int)
+	for _, problem := range report.Problems {
+		if problem.Kind != store.SkippedValue {
+			t.Errorf("unexpected problem %+v", problem)
+		}
+		skipped[problem.Property]++
+	}
+	if skipped["Due"] != 3 || skipped["Weight"] != 3 {
+		t.Errorf("SkippedValue per property = %v, want 3 for Due and Weight", skipped)
+	}
+}
+
+// TestReindexInBatches rebuilds an index over more objects than fit in one
+// batch and checks that progress is reported per batch and that the index is
+// complete.
+func TestReindexInBatches(t *testing.T) {
+	s := newProductStore(t)
+	const objects = 2500
+	items := make([]store.Storable, objects)
+	for i := range items {
+		items[i] = &Product{Code: fmt.Sprintf("p%04d", i), Qty: int64(i % 10)}
+	}
+	if err := s.AllocateIds(items); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PutAll(items); err != nil {
+		t.Fatal(err)
+	}
+
+	var reports []int
+	err := s.Reindex("Product", "Qty", func(done, total int) {
+		if total != objects {
+			t.Errorf("progress total = %d, want %d", total, objects)
+		}
+		reports = append(reports, done)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{1000, 2000, 2500}; fmt.Sprint(reports) != fmt.Sprint(want) {
+		t.Errorf("progress = %v, want %v", reports, want)
+	}
+
+	found, err := s.Match("Product.Qty", int64(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != objects/10 {
+		t.Errorf("Match found %d objects, want %d", len(found), objects/10)
+	}
+
+	report, err := s.VerifyIndexes("Product")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() {
+		t.Errorf("VerifyIndexes after Reindex reported problems: %+v", report.Problems)
+	}
+}
+
+// TestReindexWhileWriting writes objects between the batches of a Reindex and
+// checks that queries see the whole old index until the new one is swapped in,
+// and that the new one has the changes.
+func TestReindexWhileWriting(t *testing.T) {
+	s := newProductStore(t)
+	const objects = 2500
+	items := make([]store.Storable, objects)
+	for i := range items {
+		items[i] = &Product{Code: fmt.Sprintf("p%04d", i), Qty: int64(i % 10)}
+	}
+	if err := s.AllocateIds(items); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PutAll(items); err != nil {
+		t.Fatal(err)
+	}
+
+	err := s.Reindex("Product", "Qty", func(done, total int) {
+		if done != 1000 {
+			return
+		}
+		if found, err := s.Match("Product.Qty", int64(3)); err != nil || len(found) != objects/10 {
+			t.Errorf("Match during Reindex found %d, %v; want the %d of the old index", len(found), err, objects/10)
+		}
+		// The first Product has been reached, the last one has not.
+		first, last := items[0].(*Product), items[objects-1].(*Product)
+		first.Qty, last.Qty = 42, 42
+		put(t, s, first)
+		put(t, s, last)
+		if err := s.Delete(items[3].GetId()); err != nil {
+			t.Fatal(err)
+		}
+		put(t, s, &Product{Code: "new", Qty: 42})
+		if found, err := s.Match("Product.Qty", int64(42)); err != nil || len(found) != 3 {
+			t.Errorf("Match during Reindex found %d, %v; want the 3 objects just written", len(found), err)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if found, err := s.Match("Product.Qty", int64(42)); err != nil || len(found) != 3 {
+		t.Errorf("Match on the values written during Reindex found %d, %v; want 3", len(found), err)
+	}
+	if found, err := s.Match("Product.Qty", int64(3)); err != nil || len(found) != objects/10-1 {
+		t.Errorf("Match after a delete during Reindex found %d, %v; want %d", len(found), err, objects/10-1)
+	}
+	if report, err := s.VerifyIndexes("Product"); err != nil || !report.OK() {
+		t.Errorf("VerifyIndexes after Reindex = %+v, %v", report, err)
+	}
+}
+
+// TestReindexFailureKeepsIndex checks that a Reindex that fails part way leaves
+// the index as it was and no shadow bucket behind.
+func TestReindexFailureKeepsIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	products := createProducts(t, path, 5)
+	damage(t, path, func(tx *bbolt.Tx) error {
+		return flipByte(tx, products[3].Id)
+	})
+
+	s, _ := openStore(t, path, registerCodes)
+	if err := s.Reindex("Product", "Code", nil); !errors.Is(err, fault.ErrCorruptValue) {
+		t.Fatalf("Reindex over a damaged value returned %v, want %v", err, fault.ErrCorruptValue)
+	}
+	for _, p := range products[:3] {
+		if found, err := s.Match("Product.Code", p.Code); err != nil || len(found) != 1 {
+			t.Errorf("Match(%s) after a failed Reindex found %d, %v; want 1", p.Code, len(found), err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	damage(t, path, func(tx *bbolt.Tx) error {
+		if tx.Bucket([]byte("Reindex.Product.Code")) != nil {
+			t.Error("a failed Reindex left its shadow bucket behind")
+		}
+		if n := tx.Bucket([]byte("Index.Product.Code")).Stats().KeyN; n != len(products) {
+			t.Errorf("index has %d entries after a failed Reindex, want %d", n, len(products))
+		}
+		return nil
+	})
+}
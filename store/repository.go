@@ -0,0 +1,140 @@
+package store
+
+import (
+	"fmt"
+
+	"github.com/guyvdb/dstore/fault"
+)
+
+// Repository gives typed access to the objects of one registered struct type T.
+// It is bound to the type name returned by GetTypeName on a new *T, and every
+// result is checked to be a *T before it is returned.
+//
+//	products, err := store.NewRepository[Product](s)
+//	p, err := products.Get(id)
+type Repository[T any, PT interface {
+	*T
+	Storable
+}] struct {
+	store    Store
+	typeName string
+	typeId   int64
+}
+
+// NewRepository returns a Repository for T backed by s. T must be registered
+// with the type manager of s.
+func NewRepository[T any, PT interface {
+	*T
+	Storable
+}](s Store) (*Repository[T, PT], error) {
+	typeName := PT(new(T)).GetTypeName()
+
+	typeId, err := s.TypeManager().GetTypeId(typeName)
+	if err != nil {
+		return nil, fmt.Errorf("repository for %s: %w", typeName, err)
+	}
+
+	return &Repository[T, PT]{store: s, typeName: typeName, typeId: typeId}, nil
+}
+
+// TypeName returns the registered type name of T.
+func (r *Repository[T, PT]) TypeName() string {
+	return r.typeName
+}
+
+// Get retrieves the object with the given id. It returns fault.ErrTypeMismatch if
+// the id belongs to another type.
+func (r *Repository[T, PT]) Get(id *Id) (*T, error) {
+	if err := r.checkId(id); err != nil {
+		return nil, err
+	}
+
+	item, err := r.store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	return r.cast(item)
+}
+
+// Put stores item, allocating an Id first if it does not have one yet.
+func (r *Repository[T, PT]) Put(item *T) error {
+	if item == nil {
+		return fault.ErrNilStoreable
+	}
+	m := PT(item)
+
+	return r.store.Update(func(tx Tx) error {
+		if m.GetId() == nil {
+			if err := tx.AllocateId(m); err != nil {
+				return err
+			}
+		}
+		return tx.Put(m)
+	})
+}
+
+// All retrieves every stored object of type T.
+func (r *Repository[T, PT]) All() ([]*T, error) {
+	items, err := r.store.GetAll(r.typeId)
+	if err != nil {
+		return nil, err
+	}
+	return r.castAll(items)
+}
+
+// Match finds the objects whose indexed property exactly matches value.
+// property is the field name alone, e.g. "BarCode" rather than "Product.BarCode".
+func (r *Repository[T, PT]) Match(property string, value interface{}) ([]*T, error) {
+	items, err := r.store.Match(r.typeName+"."+property, value)
+	if err != nil {
+		return nil, err
+	}
+	return r.castAll(items)
+}
+
+// Delete removes the object with the given id. It returns fault.ErrTypeMismatch
+// if the id belongs to another type.
+func (r *Repository[T, PT]) Delete(id *Id) error {
+	if err := r.checkId(id); err != nil {
+		return err
+	}
+	return r.store.Delete(id)
+}
+
+// Count returns the number of stored objects of type T.
+func (r *Repository[T, PT]) Count() (int, error) {
+	return r.store.Count(r.typeId)
+}
+
+// checkId verifies that id refers to an object of type T.
+func (r *Repository[T, PT]) checkId(id *Id) error {
+	if id == nil {
+		return fault.ErrIdIsNil
+	}
+	if id.TypeId != r.typeId {
+		return fmt.Errorf("id %s is not a %s: %w", id.String(), r.typeName, fault.ErrTypeMismatch)
+	}
+	return nil
+}
+
+// cast converts a Storable returned by the store into a *T.
+func (r *Repository[T, PT]) cast(item Storable) (*T, error) {
+	typed, ok := item.(PT)
+	if !ok || typed == nil {
+		return nil, fmt.Errorf("%T is not a %s: %w", item, r.typeName, fault.ErrTypeMismatch)
+	}
+	return (*T)(typed), nil
+}
+
+// castAll converts a slice of Storables into a slice of *T.
+func (r *Repository[T, PT]) castAll(items []Storable) ([]*T, error) {
+	results := make([]*T, 0, len(items))
+	for _, item := range items {
+		typed, err := r.cast(item)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, typed)
+	}
+	return results, nil
+}
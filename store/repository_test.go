@@ -0,0 +1,82 @@
+package store_test
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/guyvdb/dstore/fault"
+	"github.com/guyvdb/dstore/store"
+	"github.com/guyvdb/dstore/types"
+)
+
+type Supplier struct {
+	Id   *store.Id `json:"id"`
+	Name string    `json:"name"`
+}
+
+func (s *Supplier) GetId() *store.Id         { return s.Id }
+func (s *Supplier) SetId(id *store.Id)       { s.Id = id }
+func (s *Supplier) GetTypeName() string      { return "Supplier" }
+func (s *Supplier) Marshal() ([]byte, error) { return json.Marshal(s) }
+func (s *Supplier) Unmarshal(d []byte) error { return json.Unmarshal(d, s) }
+
+func TestRepository(t *testing.T) {
+	s, _ := openStore(t, filepath.Join(t.TempDir(), "db"), func(r *types.SystemRegistry) {
+		registerProduct(r)
+		r.Register("Supplier", func() store.Storable { return &Supplier{} })
+	})
+	products, err := store.NewRepository[Product](s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if products.TypeName() != "Product" {
+		t.Errorf("TypeName = %s, want Product", products.TypeName())
+	}
+
+	for _, code := range []string{"a", "b", "c"} {
+		if err := products.Put(&Product{Code: code, Qty: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n, err := products.Count(); err != nil || n != 3 {
+		t.Errorf("Count = %d, %v; want 3", n, err)
+	}
+	if all, err := products.All(); err != nil || len(all) != 3 {
+		t.Errorf("All returned %d, %v; want 3", len(all), err)
+	}
+	found, err := products.Match("Code", "b")
+	if err != nil || len(found) != 1 || found[0].Code != "b" {
+		t.Fatalf("Match(Code, b) = %v, %v", found, err)
+	}
+	got, err := products.Get(found[0].Id)
+	if err != nil || got.Code != "b" {
+		t.Fatalf("Get = %v, %v", got, err)
+	}
+
+	supplier := &Supplier{}
+	if err := s.AllocateId(supplier); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(supplier); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := products.Get(supplier.Id); !errors.Is(err, fault.ErrTypeMismatch) {
+		t.Errorf("Get of another type's Id returned %v, want %v", err, fault.ErrTypeMismatch)
+	}
+	if err := products.Delete(supplier.Id); !errors.Is(err, fault.ErrTypeMismatch) {
+		t.Errorf("Delete of another type's Id returned %v, want %v", err, fault.ErrTypeMismatch)
+	}
+
+	if err := products.Delete(got.Id); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := products.Count(); err != nil || n != 2 {
+		t.Errorf("Count after Delete = %d, %v; want 2", n, err)
+	}
+
+	if _, err := store.NewRepository[Supplier](newProductStore(t)); !errors.Is(err, fault.ErrTypeNotFound) {
+		t.Errorf("NewRepository of an unregistered type returned %v, want %v", err, fault.ErrTypeNotFound)
+	}
+}
@@ -0,0 +1,152 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+
+	"github.com/guyvdb/dstore/fault"
+
+	"go.etcd.io/bbolt"
+)
+
+// rewriteBatchSize is the number of objects rewriteValues rewrites, and Reindex
+// indexes, per write transaction, so that writers are never held up for long.
+const rewriteBatchSize = 1000
+
+// valueFilter reports whether a stored value needs to be rewritten, given its
+// header and its stored payload.
+type valueFilter func(header valueHeader, payload []byte) bool
+
+// rewriteValues rewraps the stored values of typeName that filter selects with
+// the compression and encryption options now in force, leaving their payloads
+// as they are. The filter is created for each batch, so options that change
+// during the pass are picked up. Values whose compression and key come out
+// unchanged, such as incompressible ones, are not written unless they lack a
+// checksum. It returns the
+// number of values rewritten.
+func (bs *BoltStore) rewriteValues(op, typeName string, progress ProgressFunc, newFilter func(typeId int64) (valueFilter, error)) (int, error) {
+	typeId, err := bs.typeManager.GetTypeId(typeName)
+	if err != nil {
+		return 0, fault.ErrTypeNotFound
+	}
+
+	bucketNameBytes, err := bs.typeBucketKey(typeId)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int
+	err = bs.db.View(func(tx *bbolt.Tx) error {
+		if bucket := tx.Bucket(bucketNameBytes); bucket != nil {
+			total = bucket.Stats().KeyN
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	rewritten, done := 0, 0
+	var after []byte
+	for {
+		var more bool
+		var batchDone, batchRewritten int
+		err := bs.db.Update(func(tx *bbolt.Tx) error {
+			bucket := tx.Bucket(bucketNameBytes)
+			if bucket == nil {
+				return nil
+			}
+
+			filter, err := newFilter(typeId)
+			if err != nil {
+				return err
+			}
+
+			// Collect the batch first, a bucket must not be written while a
+			// cursor walks it.
+			var batch []kv
+			c := bucket.Cursor()
+			k, v := c.First()
+			if after != nil {
+				k, v = c.Seek(after)
+				if bytes.Equal(k, after) {
+					k, v = c.Next()
+				}
+			}
+			for ; k != nil && len(batch) < rewriteBatchSize; k, v = c.Next() {
+				batch = append(batch, kv{k: bytes.Clone(k), v: bytes.Clone(v)})
+			}
+			more = k != nil
+
+			for _, e := range batch {
+				value, changed, err := bs.rewrapValue(typeId, e, filter)
+				if err != nil {
+					return fmt.Errorf("object %s: %w", idBytesString(e.k), err)
+				}
+				if changed {
+					if err := bucket.Put(e.k, value); err != nil {
+						return fault.ErrPutFailed
+					}
+					batchRewritten++
+				}
+			}
+
+			batchDone = len(batch)
+			if len(batch) > 0 {
+				after = batch[len(batch)-1].k
+			}
+			return nil
+		})
+		if err != nil {
+			return rewritten, err
+		}
+		done += batchDone
+		rewritten += batchRewritten
+		if progress != nil {
+			progress(done, total)
+		}
+		if !more {
+			break
+		}
+	}
+
+	slog.Info("BoltStore."+op+": Rewrote stored values", "typeName", typeName, "objects", done, "rewritten", rewritten)
+	return rewritten, nil
+}
+
+// rewrapValue rewraps a stored value if filter selects it. It reports false if
+// the value does not need to be written.
+func (bs *BoltStore) rewrapValue(typeId int64, e kv, filter valueFilter) ([]byte, bool, error) {
+	header, payload, err := decodeValue(e.v)
+	if err != nil {
+		return nil, false, err
+	}
+	if !filter(header, payload) {
+		return nil, false, nil
+	}
+
+	header, plain, err := bs.unwrapValue(e.k, e.v)
+	if err != nil {
+		return nil, false, err
+	}
+	value, rewrapped, err := bs.wrapValue(typeId, e.k, header, plain)
+	if err != nil {
+		return nil, false, err
+	}
+
+	changed := rewrapped.compression != header.compression || rewrapped.encrypted != header.encrypted || rewrapped.keyId != header.keyId || !header.checksum
+	return value, changed, nil
+}
+
+// plainSize returns the size of a stored payload before compression and
+// encryption.
+func plainSize(header valueHeader, payload []byte) int {
+	if header.compression != NoCompression {
+		return header.size
+	}
+	if header.encrypted {
+		return len(payload) - gcmOverhead
+	}
+	return len(payload)
+}
@@ -0,0 +1,180 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/guyvdb/dstore/fault"
+
+	"go.etcd.io/bbolt"
+)
+
+// CorruptionError reports a stored value that is damaged: its checksum does not
+// match, its header cannot be read, it fails to decrypt or decompress, or it
+// has no checksum and its payload cannot be decoded. It matches
+// fault.ErrCorruptValue with errors.Is.
+type CorruptionError struct {
+	Bucket string
+	Key    []byte
+	Err    error
+}
+
+func (e *CorruptionError) Error() string {
+	return fmt.Sprintf("%s: object %s in bucket %s: %v", fault.ErrCorruptValue, idBytesString(e.Key), e.Bucket, e.Err)
+}
+
+// Id returns the Id of the damaged object, or nil if its key is not an Id.
+func (e *CorruptionError) Id() *Id {
+	id, err := IdFromBytes(e.Key)
+	if err != nil {
+		return nil
+	}
+	return id
+}
+
+func (e *CorruptionError) Is(target error) bool {
+	return target == fault.ErrCorruptValue
+}
+
+func (e *CorruptionError) Unwrap() error {
+	return e.Err
+}
+
+// isCorruption reports whether err, returned while reading a stored value,
+// means the value is damaged. A payload that fails to decode only counts if the
+// value has no checksum, as one that passed its checksum is intact.
+func isCorruption(header valueHeader, err error) bool {
+	switch {
+	case errors.Is(err, fault.ErrChecksumMismatch), errors.Is(err, fault.ErrInvalidValueHeader), errors.Is(err, fault.ErrDecryptionFailed):
+		return true
+	case errors.Is(err, fault.ErrUnmarshalFailed):
+		return !header.checksum
+	}
+	return false
+}
+
+// ScrubProblemKind classifies a problem found by Scrub.
+type ScrubProblemKind int
+
+const (
+	// DamagedRecord is a record whose stored bytes are damaged, as reported by
+	// a CorruptionError, or an index entry that does not refer to an Id.
+	DamagedRecord ScrubProblemKind = iota
+	// UnreadableRecord is an object that is intact but cannot be decoded by this
+	// store, for example because a schema migration, a codec or an encryption
+	// key is missing.
+	UnreadableRecord
+)
+
+func (k ScrubProblemKind) String() string {
+	return [...]string{"DamagedRecord", "UnreadableRecord"}[k]
+}
+
+// ScrubProblem is a damaged or unreadable record found by Scrub.
+type ScrubProblem struct {
+	Kind   ScrubProblemKind `json:"kind"`
+	Bucket string           `json:"bucket"`
+	Key    string           `json:"key"` // The object's Id, or the index entry's key in hex
+	Error  string           `json:"error"`
+}
+
+// ScrubReport is the result of Scrub.
+type ScrubReport struct {
+	Buckets  int            `json:"buckets"`
+	Records  int            `json:"records"`
+	Problems []ScrubProblem `json:"problems"`
+}
+
+// OK reports whether no problems were found.
+func (r *ScrubReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// scrubCheck checks a record. It returns what is wrong with a damaged record as
+// damage, and why an intact record cannot be read as err.
+type scrubCheck func(k, v []byte) (damage error, err error)
+
+// Scrub reads every record in the store in one read-only transaction and
+// reports the damaged ones. Objects of types the type manager knows are fully
+// decoded; objects of other types only have their header and checksum checked.
+// Index entries are checked to refer to an Id, VerifyIndexes checks that they
+// agree with the objects. Objects that are intact but cannot be decoded, for
+// example because an encryption key is missing, are reported as
+// UnreadableRecord and the scrub goes on.
+func (bs *BoltStore) Scrub() (*ScrubReport, error) {
+	report := &ScrubReport{Problems: make([]ScrubProblem, 0)}
+	err := bs.db.View(func(tx *bbolt.Tx) error {
+		t := &boltTx{bs: bs, tx: tx}
+		return tx.ForEach(func(name []byte, bucket *bbolt.Bucket) error {
+			var check scrubCheck
+			describe := idBytesString
+			switch {
+			case bytes.HasPrefix(name, []byte("Type.")):
+				check = t.scrubObject(string(name))
+			case bytes.HasPrefix(name, []byte("Index.")):
+				check = scrubIndexEntry
+				describe = func(k []byte) string { return fmt.Sprintf("%x", k) }
+			default:
+				return nil
+			}
+
+			report.Buckets++
+			return bucket.ForEach(func(k, v []byte) error {
+				report.Records++
+				damage, err := check(k, v)
+				switch {
+				case damage != nil:
+					report.Problems = append(report.Problems, ScrubProblem{Kind: DamagedRecord, Bucket: string(name), Key: describe(k), Error: damage.Error()})
+				case err != nil:
+					report.Problems = append(report.Problems, ScrubProblem{Kind: UnreadableRecord, Bucket: string(name), Key: describe(k), Error: err.Error()})
+				}
+				return nil
+			})
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !report.OK() {
+		slog.Warn("BoltStore.Scrub: Found damaged or unreadable records", "buckets", report.Buckets, "records", report.Records, "problems", len(report.Problems))
+	}
+	return report, nil
+}
+
+// scrubObject returns the check of the objects in the type bucket name.
+func (t *boltTx) scrubObject(name string) scrubCheck {
+	typeId, err := t.bs.typeManager.GetTypeId(name[len("Type."):])
+	known := err == nil
+	if known {
+		_, err := t.bs.typeManager.CreateInstance(typeId)
+		known = err == nil
+	}
+
+	return func(k, v []byte) (error, error) {
+		if !known {
+			header, _, err := decodeValue(v)
+			if err != nil && isCorruption(header, err) {
+				return err, nil
+			}
+			return nil, err
+		}
+
+		_, err := t.decodeItem(typeId, k, v)
+		var corrupt *CorruptionError
+		if errors.As(err, &corrupt) {
+			return corrupt.Err, nil
+		}
+		return nil, err
+	}
+}
+
+// scrubIndexEntry checks that an index entry refers to an Id.
+func scrubIndexEntry(_, v []byte) (error, error) {
+	if _, err := IdFromBytes(v); err != nil {
+		return err, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,179 @@
+package store_test
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/guyvdb/dstore/fault"
+	"github.com/guyvdb/dstore/store"
+
+	"go.etcd.io/bbolt"
+)
+
+// flipByte corrupts the stored value of id in the Product bucket.
+func flipByte(tx *bbolt.Tx, id *store.Id) error {
+	bucket := tx.Bucket([]byte("Type.Product"))
+	value := append([]byte{}, bucket.Get(id.Bytes())...)
+	value[len(value)/2] ^= 0x10
+	return bucket.Put(id.Bytes(), value)
+}
+
+// createProducts stores n compressed Products in a new store at path, closes it
+// and returns them.
+func createProducts(t *testing.T, path string, n int) []*Product {
+	t.Helper()
+	s, _ := openStore(t, path, registerCodes)
+	s.SetCompression(&store.CompressionOptions{Algorithm: store.GzipCompression})
+	products := make([]*Product, n)
+	for i := range products {
+		products[i] = put(t, s, &Product{Code: fmt.Sprint("p", i), Name: "a name that is long enough to be worth compressing, compressing"})
+	}
+	if report, err := s.Scrub(); err != nil || !report.OK() {
+		t.Fatalf("Scrub of an intact store = %+v, %v", report, err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return products
+}
+
+func TestScrub(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	products := createProducts(t, path, 5)
+
+	damage(t, path, func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("Type.Product"))
+		if err := flipByte(tx, products[1].Id); err != nil {
+			return err
+		}
+		// A value without a header.
+		if err := bucket.Put(products[2].Id.Bytes(), []byte("{not json")); err != nil {
+			return err
+		}
+		// A truncated value.
+		value := bucket.Get(products[3].Id.Bytes())
+		if err := bucket.Put(products[3].Id.Bytes(), append([]byte{}, value[:len(value)-3]...)); err != nil {
+			return err
+		}
+		// An index entry that does not refer to an Id.
+		return tx.Bucket([]byte("Index.Product.Code")).Put([]byte("zzz"), []byte("short"))
+	})
+
+	s, _ := openStore(t, path, registerCodes)
+	if _, err := s.Get(products[0].Id); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range products[1:4] {
+		_, err := s.Get(p.Id)
+		var ce *store.CorruptionError
+		if !errors.Is(err, fault.ErrCorruptValue) || !errors.As(err, &ce) {
+			t.Errorf("Get of damaged %s returned %v, want a CorruptionError", p.Code, err)
+			continue
+		}
+		if ce.Bucket != "Type.Product" || ce.Id().String() != p.Id.String() {
+			t.Errorf("CorruptionError names %s in %s, want %s in Type.Product", ce.Id(), ce.Bucket, p.Id)
+		}
+	}
+	if _, err := s.GetAll(products[0].Id.TypeId); !errors.Is(err, fault.ErrCorruptValue) {
+		t.Errorf("GetAll returned %v, want %v", err, fault.ErrCorruptValue)
+	}
+
+	report, err := s.Scrub()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Problems) != 4 {
+		t.Errorf("Scrub found %+v, want 4 problems", report.Problems)
+	}
+	for _, problem := range report.Problems {
+		if problem.Kind != store.DamagedRecord {
+			t.Errorf("problem %+v is not a DamagedRecord", problem)
+		}
+	}
+}
+
+// TestScrubUnreadableObjects checks that objects which are intact but cannot be
+// decoded are reported apart from damaged ones, without stopping the scrub.
+func TestScrubUnreadableObjects(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	s, err := openCodecStore(t, path, reversedCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unreadable := put(t, s, &Product{Code: "reversed"})
+	damaged := put(t, s, &Product{Code: "damaged"})
+	s.Close()
+	damage(t, path, func(tx *bbolt.Tx) error {
+		return flipByte(tx, damaged.Id)
+	})
+
+	// Without the custom codec its values cannot be decoded.
+	if s, err = openCodecStore(t, path, store.JSONCodec); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	put(t, s, &Product{Code: "json"})
+
+	report, err := s.Scrub()
+	if err != nil {
+		t.Fatalf("Scrub stopped at an unreadable object: %v", err)
+	}
+	kinds := make(map[string]store.ScrubProblemKind)
+	for _, problem := range report.Problems {
+		kinds[problem.Key] = problem.Kind
+	}
+	want := map[string]store.ScrubProblemKind{unreadable.Id.String(): store.UnreadableRecord, damaged.Id.String(): store.DamagedRecord}
+	if fmt.Sprint(kinds) != fmt.Sprint(want) {
+		t.Errorf("Scrub found %+v, want %v", report.Problems, want)
+	}
+}
+
+// TestCorruptValueCanBeReplaced checks that an object whose value is damaged
+// can be overwritten and deleted, and that its index entries go with it.
+func TestCorruptValueCanBeReplaced(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	products := createProducts(t, path, 3)
+	damage(t, path, func(tx *bbolt.Tx) error {
+		if err := flipByte(tx, products[0].Id); err != nil {
+			return err
+		}
+		return flipByte(tx, products[1].Id)
+	})
+
+	s, _ := openStore(t, path, registerCodes)
+	report, err := s.Scrub()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Problems) != 2 {
+		t.Fatalf("Scrub found %+v, want the 2 damaged objects", report.Problems)
+	}
+
+	replaced := put(t, s, &Product{Id: products[0].Id, Code: "replaced"})
+	if err := s.Delete(products[1].Id); err != nil {
+		t.Fatalf("Delete of a damaged object: %v", err)
+	}
+
+	if got, err := s.Get(replaced.Id); err != nil || got.(*Product).Code != "replaced" {
+		t.Errorf("Get of the replaced object = %v, %v", got, err)
+	}
+	if exists, err := s.Exists(products[1].Id); err != nil || exists {
+		t.Errorf("Exists of the deleted object = %v, %v; want false", exists, err)
+	}
+	for _, code := range []string{"p0", "p1"} {
+		if found, err := s.Match("Product.Code", code); err != nil || len(found) != 0 {
+			t.Errorf("Match(%s) found %d objects, %v; want none", code, len(found), err)
+		}
+	}
+	// The codes of the damaged objects are free again.
+	put(t, s, &Product{Code: "p1"})
+
+	if report, err := s.Scrub(); err != nil || !report.OK() {
+		t.Errorf("Scrub after the repairs = %+v, %v", report, err)
+	}
+	if report, err := s.VerifyIndexes("Product"); err != nil || !report.OK() {
+		t.Errorf("VerifyIndexes after the repairs = %+v, %v", report, err)
+	}
+}
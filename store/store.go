@@ -1,5 +1,7 @@
 package store
 
+import "iter"
+
 type Storable interface {
 	GetId() *Id
 	SetId(id *Id)
@@ -13,7 +15,90 @@ type StoreTypeManager interface {
 	GetTypeId(typeName string) (int64, error)
 	GetTypeName(typeId int64) (string, error)
 	AllocateId(item Storable) error
+	// AllocateIds allocates an Id for every item in one go.
+	AllocateIds(items []Storable) error
+	// AllocateIdInTx allocates an Id for item and records the allocation using tx,
+	// so that it commits or rolls back together with the rest of the transaction.
+	AllocateIdInTx(tx Tx, item Storable) error
+	AllocateIdsInTx(tx Tx, items []Storable) error
 	Indexes(typeId int64) []*IndexDefinition
+	// SchemaVersion returns the schema version that objects of typeId are written
+	// with. Versions start at 1.
+	SchemaVersion(typeId int64) int
+	// MigrateValue upgrades a marshalled object of typeId written at schema
+	// version 'from' to the current schema version.
+	MigrateValue(typeId int64, from int, data []byte) ([]byte, error)
+	// Schema returns the schema that Validatable objects of typeId are checked
+	// against on Put, or nil if the type has none.
+	Schema(typeId int64) []byte
+	// Codec returns the codec objects of typeId are written with, or nil for
+	// StorableCodec.
+	Codec(typeId int64) Codec
+	// Compression returns the compression options of typeId, or nil to use the
+	// store wide options.
+	Compression(typeId int64) *CompressionOptions
+	// Encrypted reports whether objects of typeId are encrypted at rest.
+	Encrypted(typeId int64) bool
+}
+
+// Tx is a set of store operations bound to a single transaction. A Tx is only
+// valid inside the function passed to Store.Update or Store.View and must not
+// be retained or used from other goroutines.
+type Tx interface {
+	Put(m Storable) error
+	PutAll(m []Storable) error
+	Exists(id *Id) (bool, error)
+	Get(id *Id) (Storable, error)
+	GetAll(typeId int64) ([]Storable, error)
+	GetAllByTypeName(typeName string) ([]Storable, error)
+	Count(typeId int64) (int, error)
+	Delete(id *Id) error
+	DeleteAllByTypeName(typeName string) (int, error)
+	AllocateId(item Storable) error
+	AllocateIds(items []Storable) error
+	Migrate(typeName string) (int, error)
+
+	// Reindex drops the index on property of typeName and builds it again from
+	// the stored objects. progress may be nil.
+	Reindex(typeName, property string, progress ProgressFunc) error
+	// DropIndex deletes the bucket of an index that is no longer declared.
+	DropIndex(typeName, property string) error
+	// UpgradeIndexes rebuilds index buckets written in an older index format
+	// once their types are known. Type managers call it when they load types.
+	UpgradeIndexes() error
+	VerifyIndexes(typeName string) (*IndexReport, error)
+
+	Match(indexName string, value interface{}) ([]Storable, error)
+	WildcardMatch(indexName string, pattern string) ([]Storable, error)
+	Range(indexName string, lo, hi interface{}, opts *RangeOptions) ([]Storable, error)
+
+	// Iterate, IterateMatch and IterateRange visit results one at a time instead
+	// of collecting them into a slice. Iteration stops when fn returns false.
+	Iterate(typeId int64, fn func(Storable) bool) error
+	IterateMatch(indexName string, value interface{}, fn func(Storable) bool) error
+	IterateRange(indexName string, lo, hi interface{}, opts *RangeOptions, fn func(Storable) bool) error
+
+	GetPage(typeName string, after *Id, limit int) (*Page, error)
+	MatchPage(indexName string, value interface{}, after string, limit int) (*Page, error)
+	RangePage(indexName string, lo, hi interface{}, opts *RangeOptions, after string, limit int) (*Page, error)
+
+	// Writable returns false for transactions started with Store.View.
+	Writable() bool
+
+	// Meta and SetMeta read and write store level settings, such as records
+	// that stored data has been upgraded. Meta returns nil for a key that has
+	// not been set. Keys used outside this package start with the name of the
+	// package that uses them.
+	Meta(key string) ([]byte, error)
+	SetMeta(key string, value []byte) error
+
+	// OnCommit registers fn to run after the transaction has committed. It is not
+	// called if the transaction rolls back.
+	OnCommit(fn func())
+
+	// OnRollback registers fn to run if the transaction rolls back or fails to
+	// commit, so in memory state changed inside it can be undone.
+	OnRollback(fn func())
 }
 
 type Store interface {
@@ -23,22 +108,123 @@ type Store interface {
 	Get(id *Id) (Storable, error)
 	GetAll(typeId int64) ([]Storable, error)
 	GetAllByTypeName(typeName string) ([]Storable, error)
+	// Count returns the number of stored objects of typeId without decoding them.
+	Count(typeId int64) (int, error)
 	Delete(id *Id) error
+	// DeleteAllByTypeName removes every object of typeName and its index entries
+	// without visiting the objects, returning how many were removed.
+	DeleteAllByTypeName(typeName string) (int, error)
 	AllocateId(item Storable) error
+	// AllocateIds assigns Ids to a batch of items, for example before a bulk import.
+	AllocateIds(items []Storable) error
 	AllocateBucketIfNeeded(typeName string) error
 
+	// Migrate rewrites every object of typeName stored at an older schema version
+	// or with another codec than the type's current one, and rebuilds the type's
+	// indexes, returning the number of objects rewritten. Objects that are not
+	// migrated are upgraded in memory whenever they are read.
+	Migrate(typeName string) (int, error)
+
+	// Reindex builds the index on property of typeName again from the stored
+	// objects in batches of write transactions, so that writers are not blocked
+	// for the whole pass, and swaps it in for the old index once it is
+	// complete. progress may be nil.
+	Reindex(typeName, property string, progress ProgressFunc) error
+
+	// VerifyIndexes compares the indexes of typeName with the stored objects and
+	// reports orphan and missing entries, unique violations and values that could
+	// not be indexed. Properties with problems can be repaired with Reindex.
+	VerifyIndexes(typeName string) (*IndexReport, error)
+
+	// RegisterCodec makes values written with a custom codec readable whichever
+	// codec their type uses now.
+	RegisterCodec(codec Codec)
+
+	// SetCompression sets the compression options of types that have none of
+	// their own in the type manager. nil turns compression off.
+	SetCompression(opts *CompressionOptions)
+
+	// CompressionStats reports how many objects of typeName are compressed and
+	// how much space that saves.
+	CompressionStats(typeName string) (*CompressionStats, error)
+
+	// Recompress rewrites the objects of typeName whose compression no longer
+	// matches the options in force, in batches of short write transactions. It
+	// is meant to be run in the background after the options change and returns
+	// the number of objects rewritten. progress may be nil.
+	Recompress(typeName string, progress ProgressFunc) (int, error)
+
+	// SetKeyProvider sets the provider of the keys that encrypted types and
+	// hashed indexes are protected with.
+	SetKeyProvider(kp KeyProvider)
+
+	// Reencrypt rewrites the objects of typeName that are not encrypted with the
+	// key provider's current key, or whose encryption no longer matches the type.
+	// It runs in batches like Recompress and is meant to be run in the background
+	// after a key rotation. progress may be nil.
+	Reencrypt(typeName string, progress ProgressFunc) (int, error)
+
+	// Scrub reads every object and index entry in the store and reports the
+	// records that are damaged, such as values whose checksum does not match,
+	// and the objects that cannot be decoded.
+	Scrub() (*ScrubReport, error)
+
+	// Update runs fn in a read-write transaction. The transaction commits if fn
+	// returns nil and rolls back otherwise. Store methods must not be called from
+	// inside fn; use tx instead.
+	Update(fn func(tx Tx) error) error
+
+	// View runs fn in a read-only transaction.
+	View(fn func(tx Tx) error) error
+
+	// Iterate calls fn for every Storable of typeId without loading the whole
+	// type into memory. Iteration stops when fn returns false.
+	Iterate(typeId int64, fn func(Storable) bool) error
+
+	// GetAllSeq, MatchSeq and RangeSeq are streaming variants of GetAll, Match and
+	// Range for use with range-over-func. A failure is yielded once as a nil
+	// Storable with a non-nil error, after which the sequence ends. The loop body
+	// runs inside a read-only transaction, so it must not write to the store.
+	GetAllSeq(typeId int64) iter.Seq2[Storable, error]
+	MatchSeq(indexName string, value interface{}) iter.Seq2[Storable, error]
+	RangeSeq(indexName string, lo, hi interface{}, opts *RangeOptions) iter.Seq2[Storable, error]
+
+	// GetPage returns up to limit objects of typeName in key order, starting after
+	// the given Id (nil for the first page). Page.Next can be turned back into the
+	// Id for the following page with ParsePageToken.
+	GetPage(typeName string, after *Id, limit int) (*Page, error)
+
+	// MatchPage and RangePage page through index lookups. 'after' is the Page.Next
+	// token of the previous page, or empty for the first page.
+	MatchPage(indexName string, value interface{}, after string, limit int) (*Page, error)
+	RangePage(indexName string, lo, hi interface{}, opts *RangeOptions, after string, limit int) (*Page, error)
+
+	// TypeManager returns the type manager this store was opened with.
+	TypeManager() StoreTypeManager
+
 	// Indexed Searches
 	// indexName is in the form of TypeName.PropertyName (e.g., "Product.BarCode").
 
 	// Match finds storables where an indexed property exactly matches the given value.
 	// The type of 'value' should correspond to the IndexDefinition.DataType of the indexed property.
+	// For a compound index 'value' is a []interface{} with values for the leading
+	// components; fewer values than components match every entry starting with them.
 	// indexName is in the form of TypeName.PropertyName.
 	Match(indexName string, value interface{}) ([]Storable, error)
 
 	// WildcardMatch finds storables where an indexed string property matches the given wildcard pattern.
 	// indexName is in the form of TypeName.PropertyName.
-	// The property must be indexed and of type StringIndex.
+	// The property must be indexed and of type StringIndex. The pattern supports
+	// '*' (any sequence), '?' (any single character) and '\' to escape either.
 	WildcardMatch(indexName string, pattern string) ([]Storable, error)
 
+	// Range finds storables where an indexed property lies between lo and hi, in
+	// index order. A nil bound leaves that end of the range open. The types of lo
+	// and hi follow the same rules as Match, so on a compound index the leading
+	// components can be fixed and the range applied to the next one. opts may be
+	// nil for an inclusive, ascending range.
+	// indexName is in the form of TypeName.PropertyName.
+	Range(indexName string, lo, hi interface{}, opts *RangeOptions) ([]Storable, error)
+
 	Close() error
 }
@@ -0,0 +1,24 @@
+package store
+
+// Validatable is implemented by Storables whose type can carry a schema in the
+// type manager. Put calls Validate with that schema before the object is
+// written and stores nothing if it returns an error. Types without a schema are
+// not validated.
+type Validatable interface {
+	// Validate checks the object against schema, filling in defaults for
+	// properties it does not hold.
+	Validate(schema []byte) error
+}
+
+// validateItem checks m against the schema of typeId, if it has one.
+func (t *boltTx) validateItem(typeId int64, m Storable) error {
+	v, ok := m.(Validatable)
+	if !ok {
+		return nil
+	}
+	schema := t.bs.typeManager.Schema(typeId)
+	if len(schema) == 0 {
+		return nil
+	}
+	return v.Validate(schema)
+}
@@ -0,0 +1,159 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/guyvdb/dstore/fault"
+)
+
+// IndexProblemKind classifies a problem found by VerifyIndexes.
+type IndexProblemKind int
+
+const (
+	// OrphanEntry is an index entry that no stored object produces, for example
+	// one that refers to a deleted object or to an old property value.
+	OrphanEntry IndexProblemKind = iota
+	// MissingEntry is an entry that a stored object produces but that is not in
+	// the index.
+	MissingEntry
+	// UniqueViolation is a value of a UniqueIndex that more than one object has.
+	// Only one of those objects can be found through the index.
+	UniqueViolation
+	// SkippedValue is an object whose property value could not be extracted for
+	// indexing, so the object cannot be found through the index.
+	SkippedValue
+)
+
+func (k IndexProblemKind) String() string {
+	return [...]string{"OrphanEntry", "MissingEntry", "UniqueViolation", "SkippedValue"}[k]
+}
+
+// IndexProblem is a single inconsistency between an index and the stored objects.
+type IndexProblem struct {
+	Kind     IndexProblemKind `json:"kind"`
+	Property string           `json:"property"`
+	Id       string           `json:"id"`                // The object the problem concerns
+	OtherId  string           `json:"otherId,omitempty"` // The object a UniqueViolation clashes with
+}
+
+// IndexReport is the result of VerifyIndexes for one type.
+type IndexReport struct {
+	TypeName string         `json:"typeName"`
+	Objects  int            `json:"objects"`
+	Indexes  int            `json:"indexes"`
+	Problems []IndexProblem `json:"problems"`
+}
+
+// OK reports whether no problems were found.
+func (r *IndexReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// Properties returns the properties whose indexes have problems, in the order
+// they were first reported. These are the properties to pass to Reindex.
+func (r *IndexReport) Properties() []string {
+	properties := make([]string, 0)
+	for _, problem := range r.Problems {
+		found := false
+		for _, property := range properties {
+			if property == problem.Property {
+				found = true
+				break
+			}
+		}
+		if !found {
+			properties = append(properties, problem.Property)
+		}
+	}
+	return properties
+}
+
+// VerifyIndexes compares every index declared on typeName with the index
+// entries that the stored objects produce. It does not modify the store.
+func (t *boltTx) VerifyIndexes(typeName string) (*IndexReport, error) {
+	typeId, err := t.bs.typeManager.GetTypeId(typeName)
+	if err != nil {
+		return nil, fault.ErrTypeNotFound
+	}
+
+	indexes := t.bs.typeManager.Indexes(typeId)
+	report := &IndexReport{TypeName: typeName, Indexes: len(indexes), Problems: make([]IndexProblem, 0)}
+
+	// expected holds, per index, the entries the stored objects produce. clashed
+	// holds the keys of unique values that more than one object produces.
+	expected := make([]map[string][]byte, len(indexes))
+	clashed := make([]map[string]bool, len(indexes))
+	for i := range indexes {
+		expected[i] = make(map[string][]byte)
+		clashed[i] = make(map[string]bool)
+	}
+
+	var hashErr error
+	err = t.Iterate(typeId, func(item Storable) bool {
+		report.Objects++
+		id := item.GetId()
+		idBytes := id.Bytes()
+
+		for i, index := range indexes {
+			valueBytes, ok, err := t.bs.indexEntryValue(item, typeName, index)
+			if err != nil {
+				hashErr = err
+				return false
+			}
+			if !ok {
+				if !indexApplies(item, index) {
+					continue
+				}
+				report.Problems = append(report.Problems, IndexProblem{Kind: SkippedValue, Property: index.PropertyName, Id: id.String()})
+				continue
+			}
+
+			key := string(buildIndexKey(index.Type, valueBytes, id))
+			if other, clash := expected[i][key]; clash {
+				clashed[i][key] = true
+				report.Problems = append(report.Problems, IndexProblem{Kind: UniqueViolation, Property: index.PropertyName, Id: id.String(), OtherId: idBytesString(other)})
+				continue
+			}
+			expected[i][key] = idBytes
+		}
+		return true
+	})
+	if err == nil {
+		err = hashErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i, index := range indexes {
+		indexBucketNameBytes, err := t.bs.mkIndexBucketName(typeId, index.PropertyName)
+		if err != nil {
+			return nil, err
+		}
+
+		// Entries in the bucket that no object produces are orphans. Matched
+		// entries are removed from expected, whatever is left is missing.
+		if bucket := t.tx.Bucket(indexBucketNameBytes); bucket != nil {
+			err = bucket.ForEach(func(k, v []byte) error {
+				idBytes, found := expected[i][string(k)]
+				// A clashing unique value may refer to any of the objects that have it.
+				if found && (bytes.Equal(idBytes, v) || clashed[i][string(k)]) {
+					delete(expected[i], string(k))
+					return nil
+				}
+				report.Problems = append(report.Problems, IndexProblem{Kind: OrphanEntry, Property: index.PropertyName, Id: idBytesString(v)})
+				return nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to read index bucket %s: %w", string(indexBucketNameBytes), err)
+			}
+		}
+
+		for _, idBytes := range expected[i] {
+			report.Problems = append(report.Problems, IndexProblem{Kind: MissingEntry, Property: index.PropertyName, Id: idBytesString(idBytes)})
+		}
+	}
+
+	return report, nil
+}
@@ -0,0 +1,59 @@
+package store_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/guyvdb/dstore/store"
+
+	"go.etcd.io/bbolt"
+)
+
+// TestVerifyIndexes damages an index and checks that VerifyIndexes reports the
+// damage and that Reindex repairs it.
+func TestVerifyIndexes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	s, _ := openStore(t, path, registerProduct)
+	for i := 0; i < 3; i++ {
+		put(t, s, &Product{Code: string(rune('a' + i)), Qty: int64(i)})
+	}
+	if report, err := s.VerifyIndexes("Product"); err != nil || !report.OK() {
+		t.Fatalf("VerifyIndexes of intact indexes = %+v, %v", report, err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	damage(t, path, func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("Index.Product.Code"))
+		k, v := bucket.Cursor().First()
+		k, v = append([]byte{}, k...), append([]byte{}, v...)
+		if err := bucket.Put([]byte("zzz"), v); err != nil {
+			return err
+		}
+		return bucket.Delete(k)
+	})
+
+	s, _ = openStore(t, path, registerProduct)
+	report, err := s.VerifyIndexes("Product")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kinds := make(map[store.IndexProblemKind]int)
+	for _, problem := range report.Problems {
+		if problem.Property != "Code" {
+			t.Errorf("problem reported on %s, want only Code: %+v", problem.Property, problem)
+		}
+		kinds[problem.Kind]++
+	}
+	if len(report.Problems) != 2 || kinds[store.OrphanEntry] != 1 || kinds[store.MissingEntry] != 1 {
+		t.Errorf("VerifyIndexes found %+v, want one orphan and one missing entry", report.Problems)
+	}
+
+	if err := s.Reindex("Product", "Code", nil); err != nil {
+		t.Fatal(err)
+	}
+	if report, err := s.VerifyIndexes("Product"); err != nil || !report.OK() {
+		t.Errorf("VerifyIndexes after Reindex = %+v, %v", report, err)
+	}
+}
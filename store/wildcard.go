@@ -0,0 +1,120 @@
+package store
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/guyvdb/dstore/fault"
+)
+
+type wildcardTokenKind int
+
+const (
+	wildcardLiteral wildcardTokenKind = iota // a single literal rune
+	wildcardAny                              // '?' matches exactly one rune
+	wildcardStar                             // '*' matches any sequence of runes, including none
+)
+
+type wildcardToken struct {
+	kind wildcardTokenKind
+	r    rune
+}
+
+// wildcardPattern is a compiled glob pattern supporting '*', '?' and '\' as
+// an escape character for the next rune (e.g. "50\%" or "what\?").
+type wildcardPattern struct {
+	tokens []wildcardToken
+	prefix []byte // the literal runes before the first wildcard
+}
+
+// compileWildcard parses a glob pattern. A trailing unescaped '\' is an error.
+func compileWildcard(pattern string) (*wildcardPattern, error) {
+	p := &wildcardPattern{tokens: make([]wildcardToken, 0, len(pattern))}
+	inPrefix := true
+
+	for i := 0; i < len(pattern); {
+		r, size := utf8.DecodeRuneInString(pattern[i:])
+		i += size
+
+		switch r {
+		case '*':
+			inPrefix = false
+			// Consecutive stars are equivalent to a single star.
+			if n := len(p.tokens); n > 0 && p.tokens[n-1].kind == wildcardStar {
+				continue
+			}
+			p.tokens = append(p.tokens, wildcardToken{kind: wildcardStar})
+			continue
+		case '?':
+			inPrefix = false
+			p.tokens = append(p.tokens, wildcardToken{kind: wildcardAny})
+			continue
+		case '\\':
+			if i >= len(pattern) {
+				return nil, fmt.Errorf("pattern '%s' ends with an escape character: %w", pattern, fault.ErrInvalidWildcardPattern)
+			}
+			r, size = utf8.DecodeRuneInString(pattern[i:])
+			i += size
+		}
+
+		p.tokens = append(p.tokens, wildcardToken{kind: wildcardLiteral, r: r})
+		if inPrefix {
+			p.prefix = utf8.AppendRune(p.prefix, r)
+		}
+	}
+
+	return p, nil
+}
+
+// Match reports whether s matches the whole pattern.
+func (p *wildcardPattern) Match(s string) bool {
+	t := 0 // position in tokens
+	i := 0 // byte position in s
+
+	// Backtracking state for the most recent star: the token after it and the
+	// position in s that the star currently extends to.
+	starToken := -1
+	starPos := 0
+
+	for i < len(s) {
+		if t < len(p.tokens) {
+			tok := p.tokens[t]
+			switch tok.kind {
+			case wildcardStar:
+				starToken = t
+				starPos = i
+				t++
+				continue
+			case wildcardAny:
+				_, size := utf8.DecodeRuneInString(s[i:])
+				i += size
+				t++
+				continue
+			case wildcardLiteral:
+				r, size := utf8.DecodeRuneInString(s[i:])
+				if r == tok.r {
+					i += size
+					t++
+					continue
+				}
+			}
+		}
+
+		// Mismatch: let the last star absorb one more rune and retry.
+		if starToken < 0 {
+			return false
+		}
+		_, size := utf8.DecodeRuneInString(s[starPos:])
+		starPos += size
+		i = starPos
+		t = starToken + 1
+	}
+
+	// Only trailing stars may remain.
+	for ; t < len(p.tokens); t++ {
+		if p.tokens[t].kind != wildcardStar {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,44 @@
+package store_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/guyvdb/dstore/fault"
+)
+
+func TestWildcardMatch(t *testing.T) {
+	s := newProductStore(t)
+	for i, name := range []string{"apple", "apples", "banana", "application", "a*b", "bob"} {
+		put(t, s, &Product{Code: name, Name: name, Qty: int64(i)})
+	}
+
+	tests := map[string]int{
+		"app*":  3,
+		"a*":    4,
+		"*a*":   5,
+		"?ob":   1,
+		`a\*b`:  1,
+		"*":     6,
+		"apple": 1,
+		"*s":    1,
+		"b*a":   1,
+		"":      0,
+	}
+	for pattern, want := range tests {
+		// Code is a unique index and Name a non-unique one.
+		for _, index := range []string{"Product.Code", "Product.Name"} {
+			found, err := s.WildcardMatch(index, pattern)
+			if err != nil || len(found) != want {
+				t.Errorf("WildcardMatch(%s, %q) found %d, %v; want %d", index, pattern, len(found), err, want)
+			}
+		}
+	}
+
+	if _, err := s.WildcardMatch("Product.Qty", "*"); !errors.Is(err, fault.ErrUnsupportedIndexDataType) {
+		t.Errorf("WildcardMatch on an Int64Index returned %v, want %v", err, fault.ErrUnsupportedIndexDataType)
+	}
+	if _, err := s.WildcardMatch("Product.Name", `a\`); !errors.Is(err, fault.ErrInvalidWildcardPattern) {
+		t.Errorf("WildcardMatch with a trailing escape returned %v, want %v", err, fault.ErrInvalidWildcardPattern)
+	}
+}
@@ -0,0 +1,57 @@
+package types
+
+import "github.com/guyvdb/dstore/store"
+
+// SetCodec chooses the codec objects of typeName are written with. Objects
+// written with a built-in codec remain readable after a switch, as do objects
+// written with a custom codec the store was given with WithCodecs, and Migrate
+// rewrites them with the new one. A nil codec returns the type to the Marshal
+// and Unmarshal methods of its Storable.
+func (r *SystemRegistry) SetCodec(typeName string, codec store.Codec) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, item := range r.items {
+		if item.TypeName == typeName {
+			item.codec = codec
+		}
+	}
+}
+
+// Codec returns the codec of typeId, or nil if it uses its Storable methods.
+func (r *SystemRegistry) Codec(typeId int64) store.Codec {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	info, found := r.typeIdIndex[typeId]
+	if !found {
+		return nil
+	}
+	return info.codec
+}
+
+// SetCompression sets the compression options of typeName, overriding the store
+// wide options. Options with store.NoCompression keep the type uncompressed; nil
+// returns it to the store wide options.
+func (r *SystemRegistry) SetCompression(typeName string, opts *store.CompressionOptions) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, item := range r.items {
+		if item.TypeName == typeName {
+			item.compression = opts
+		}
+	}
+}
+
+// Compression returns the compression options of typeId, or nil.
+func (r *SystemRegistry) Compression(typeId int64) *store.CompressionOptions {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	info, found := r.typeIdIndex[typeId]
+	if !found {
+		return nil
+	}
+	return info.compression
+}
@@ -0,0 +1,50 @@
+package types
+
+// SetEncrypted marks typeName as encrypted at rest. Objects of the type are
+// sealed with the store's KeyProvider when they are written; objects written
+// before remain readable, and Reencrypt rewrites them. Indexes on the type stay
+// plaintext unless they are hashed with HashIndex.
+func (r *SystemRegistry) SetEncrypted(typeName string, encrypted bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, item := range r.items {
+		if item.TypeName == typeName {
+			item.encrypted = encrypted
+		}
+	}
+}
+
+// Encrypted reports whether objects of typeId are encrypted at rest.
+func (r *SystemRegistry) Encrypted(typeId int64) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	info, found := r.typeIdIndex[typeId]
+	if !found {
+		return false
+	}
+	return info.encrypted
+}
+
+// HashIndex keys the index on propertyName of typeName by the HMAC of its
+// values, using the index key of the store's KeyProvider, so that the values of
+// an encrypted type do not appear in its index buckets. A hashed index supports
+// Match but not Range or WildcardMatch. It must be called after the index is
+// declared and before the registry is loaded; Load rebuilds the index when it
+// changes between hashed and plaintext.
+func (r *SystemRegistry) HashIndex(typeName string, propertyName string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, item := range r.items {
+		if item.TypeName != typeName {
+			continue
+		}
+		for _, index := range item.Indexes {
+			if index.PropertyName == propertyName {
+				index.Hashed = true
+			}
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/guyvdb/dstore/fault"
+)
+
+// MigrationFunc upgrades a marshalled object by exactly one schema version. It
+// receives the bytes written by Marshal at the old version and returns the bytes
+// that Unmarshal expects at the next one.
+type MigrationFunc func(data []byte) ([]byte, error)
+
+// JSONMigration adapts fn to a MigrationFunc for types that marshal to a JSON
+// object. fn edits the decoded object in place, e.g. to rename a field.
+func JSONMigration(fn func(object map[string]interface{}) error) MigrationFunc {
+	return func(data []byte) ([]byte, error) {
+		object := make(map[string]interface{})
+		if err := json.Unmarshal(data, &object); err != nil {
+			return nil, err
+		}
+		if err := fn(object); err != nil {
+			return nil, err
+		}
+		return json.Marshal(object)
+	}
+}
+
+// SetSchemaVersion declares the current schema version of typeName. Objects are
+// written at this version and older objects are migrated when read. Versions
+// start at 1, which is also the version of objects written before versioning.
+func (r *SystemRegistry) SetSchemaVersion(typeName string, version int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, item := range r.items {
+		if item.TypeName == typeName {
+			item.SchemaVersion = max(version, 1)
+		}
+	}
+}
+
+// AddMigration registers fn to upgrade objects of typeName from schema version
+// 'from' to from+1. A migration is needed for every version below the current
+// one that objects may still be stored at.
+func (r *SystemRegistry) AddMigration(typeName string, from int, fn MigrationFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, item := range r.items {
+		if item.TypeName == typeName {
+			if item.migrations == nil {
+				item.migrations = make(map[int]MigrationFunc)
+			}
+			item.migrations[from] = fn
+		}
+	}
+}
+
+// SchemaVersion returns the current schema version of typeId.
+func (r *SystemRegistry) SchemaVersion(typeId int64) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	info, found := r.typeIdIndex[typeId]
+	if !found {
+		return 1
+	}
+	return max(info.SchemaVersion, 1)
+}
+
+// MigrateValue runs the migrations of typeId in order, upgrading data from
+// schema version 'from' to the current version.
+func (r *SystemRegistry) MigrateValue(typeId int64, from int, data []byte) ([]byte, error) {
+	r.mu.RLock()
+	info, found := r.typeIdIndex[typeId]
+	if !found {
+		r.mu.RUnlock()
+		return nil, fault.ErrTypeNotFound
+	}
+	current := max(info.SchemaVersion, 1)
+	steps := make([]MigrationFunc, 0, current-from)
+	for v := from; v < current; v++ {
+		fn, found := info.migrations[v]
+		if !found {
+			r.mu.RUnlock()
+			return nil, fmt.Errorf("%s from version %d to %d: %w", info.TypeName, v, v+1, fault.ErrMigrationNotFound)
+		}
+		steps = append(steps, fn)
+	}
+	r.mu.RUnlock()
+
+	// Migrations are user code, run them without holding the lock.
+	for i, fn := range steps {
+		var err error
+		if data, err = fn(data); err != nil {
+			return nil, fmt.Errorf("%s from version %d to %d: %w: %w", info.TypeName, from+i, from+i+1, fault.ErrMigrationFailed, err)
+		}
+	}
+	return data, nil
+}
@@ -0,0 +1,113 @@
+package types_test
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/guyvdb/dstore/fault"
+	"github.com/guyvdb/dstore/store"
+	"github.com/guyvdb/dstore/types"
+)
+
+// DocV1 and DocV2 are two schema versions of the Doc type: version 2 renamed
+// name to title.
+type DocV1 struct {
+	Id    *store.Id `json:"id"`
+	Name  string    `json:"name"`
+	Title string    `json:"title" dstore:"index"`
+}
+
+func (d *DocV1) GetId() *store.Id         { return d.Id }
+func (d *DocV1) SetId(id *store.Id)       { d.Id = id }
+func (d *DocV1) GetTypeName() string      { return "Doc" }
+func (d *DocV1) Marshal() ([]byte, error) { return json.Marshal(d) }
+func (d *DocV1) Unmarshal(b []byte) error { return json.Unmarshal(b, d) }
+
+type DocV2 struct {
+	Id    *store.Id `json:"id"`
+	Title string    `json:"title" dstore:"index"`
+}
+
+func (d *DocV2) GetId() *store.Id         { return d.Id }
+func (d *DocV2) SetId(id *store.Id)       { d.Id = id }
+func (d *DocV2) GetTypeName() string      { return "Doc" }
+func (d *DocV2) Marshal() ([]byte, error) { return json.Marshal(d) }
+func (d *DocV2) Unmarshal(b []byte) error { return json.Unmarshal(b, d) }
+
+// openDocs opens the store at path with version 2 of Doc, and the migration
+// from version 1 if migrate is set.
+func openDocs(t *testing.T, path string, migrate bool) store.Store {
+	t.Helper()
+	r := types.NewSystemRegistry()
+	types.MustRegisterStruct[DocV2](r)
+	r.SetSchemaVersion("Doc", 2)
+	if migrate {
+		r.AddMigration("Doc", 1, types.JSONMigration(func(object map[string]interface{}) error {
+			object["title"] = object["name"]
+			delete(object, "name")
+			return nil
+		}))
+	}
+	s, err := types.OpenBoltStore(path, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSchemaMigration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	r := types.NewSystemRegistry()
+	types.MustRegisterStruct[DocV1](r)
+	s, err := types.OpenBoltStore(path, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []*store.Id
+	for _, name := range []string{"a", "b"} {
+		d := &DocV1{Name: name}
+		if err := s.AllocateId(d); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Put(d); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, d.Id)
+	}
+	s.Close()
+
+	s = openDocs(t, path, false)
+	if _, err := s.Get(ids[0]); !errors.Is(err, fault.ErrMigrationNotFound) {
+		t.Errorf("Get without a migration returned %v, want %v", err, fault.ErrMigrationNotFound)
+	}
+	s.Close()
+
+	s = openDocs(t, path, true)
+	got, err := s.Get(ids[0])
+	if err != nil || got.(*DocV2).Title != "a" {
+		t.Fatalf("Get with the migration = %v, %v; want title a", got, err)
+	}
+	if n, err := s.Migrate("Doc"); err != nil || n != 2 {
+		t.Errorf("Migrate = %d, %v; want 2 objects rewritten", n, err)
+	}
+	if found, err := s.Match("Doc.Title", "b"); err != nil || len(found) != 1 {
+		t.Errorf("Match on the migrated title found %d, %v; want 1", len(found), err)
+	}
+	if n, err := s.Migrate("Doc"); err != nil || n != 0 {
+		t.Errorf("second Migrate = %d, %v; want nothing rewritten", n, err)
+	}
+	s.Close()
+
+	// Values written at version 2 cannot be read by version 1.
+	r = types.NewSystemRegistry()
+	types.MustRegisterStruct[DocV1](r)
+	if s, err = types.OpenBoltStore(path, r); err == nil {
+		defer s.Close()
+		_, err = s.Get(ids[0])
+	}
+	if !errors.Is(err, fault.ErrSchemaVersionTooNew) {
+		t.Errorf("reading with an older schema returned %v, want %v", err, fault.ErrSchemaVersionTooNew)
+	}
+}
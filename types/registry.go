@@ -1,6 +1,9 @@
 package types
 
 import (
+	"fmt"
+	"sync"
+
 	"github.com/guyvdb/dstore/store"
 )
 
@@ -14,15 +17,51 @@ type Registry interface {
 	// Register with a Storable with the registry
 	Register(typename string, factory TypeFactory)
 
+	// Register every type whose name starts with prefix
+	RegisterFamily(prefix string, factory FamilyFactory)
+
+	// Register a type, allocating its type id straight away if loaded
+	AddType(typeName string, factory TypeFactory, indexes ...*store.IndexDefinition) error
+
 	// Index a property
 	Index(typeName string, propertyName string, dataType store.IndexDataType, indexType store.IndexType)
 
+	// Index an ordered list of properties under one name
+	CompoundIndex(typeName string, name string, indexType store.IndexType, components ...store.IndexComponent)
+
+	// Set the current schema version of a type
+	SetSchemaVersion(typeName string, version int)
+
+	// Register a migration from a schema version to the next
+	AddMigration(typeName string, from int, fn MigrationFunc)
+
+	// Attach a schema that objects of a type are validated against
+	SetSchema(typeName string, schema []byte) error
+
+	// Choose the codec objects of a type are written with
+	SetCodec(typeName string, codec store.Codec)
+
+	// Set the compression options of a type
+	SetCompression(typeName string, opts *store.CompressionOptions)
+
+	// Encrypt the stored objects of a type
+	SetEncrypted(typeName string, encrypted bool)
+
+	// Key an index by the HMAC of its values
+	HashIndex(typeName string, propertyName string)
+
 	// Create a concrete type of a Storable
 	Instance(typeId int64) (store.Storable, error)
 
 	// Allocate a new instance
 	AllocateId(item store.Storable) error
 
+	// Allocate ids for a batch of new instances
+	AllocateIds(items []store.Storable) error
+
+	// Run a function in the transaction that loads the registry
+	OnLoad(fn func(tx store.Tx) error)
+
 	// Load additional information from a store
 	Load(store store.Store) error
 
@@ -30,12 +69,68 @@ type Registry interface {
 	//Store(store store.Store) error
 }
 
+// OpenOption configures a store opened with OpenBoltStore before its registry
+// is loaded.
+type OpenOption func(s store.Store)
+
+// WithKeyProvider gives the store its provider of encryption keys. Stores that
+// hold encrypted types or hashed indexes need it, as loading the registry may
+// read and write them.
+func WithKeyProvider(kp store.KeyProvider) OpenOption {
+	return func(s store.Store) {
+		s.SetKeyProvider(kp)
+	}
+}
+
+// WithCodecs registers the custom codecs values in the store may have been
+// written with, so that they can be read after their types switch codec.
+func WithCodecs(codecs ...store.Codec) OpenOption {
+	return func(s store.Store) {
+		for _, codec := range codecs {
+			s.RegisterCodec(codec)
+		}
+	}
+}
+
+// WithCompression sets the store wide compression options.
+func WithCompression(opts *store.CompressionOptions) OpenOption {
+	return func(s store.Store) {
+		s.SetCompression(opts)
+	}
+}
+
+// OpenBoltStore opens the BoltDB file at path with registry as its type manager,
+// applies opts and loads the registry from it. All types must be registered
+// beforehand. A registry belongs to a single store; to open several databases
+// in one process create a registry for each with NewSystemRegistry.
+func OpenBoltStore(path string, registry Registry, opts ...OpenOption) (store.Store, error) {
+	s, err := store.NewBoltStore(path, registry)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if err := registry.Load(s); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("failed to load registry: %w", err)
+	}
+
+	return s, nil
+}
+
 // Global function to return the one and only registry
 var registry Registry = nil
+var registryOnce sync.Once
 
+// GetRegistry returns a process wide registry for programs that only ever open
+// one store. It is an optional convenience; nothing is registered into it
+// unless the program does so itself.
 func GetRegistry() Registry {
-	if registry == nil {
+	registryOnce.Do(func() {
 		registry = NewSystemRegistry()
-	}
+	})
 	return registry
 }
@@ -0,0 +1,102 @@
+package types_test
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/guyvdb/dstore/fault"
+	"github.com/guyvdb/dstore/store"
+	"github.com/guyvdb/dstore/types"
+)
+
+type staticKeys struct{}
+
+func (staticKeys) CurrentKey() (uint32, []byte, error) { return 1, bytes.Repeat([]byte{7}, 32), nil }
+func (staticKeys) Key(id uint32) ([]byte, error)       { return bytes.Repeat([]byte{7}, 32), nil }
+func (staticKeys) IndexKey() ([]byte, error)           { return []byte("index key"), nil }
+
+// TestOpenBoltStoreWithKeyProvider opens a store whose Load has to build a
+// hashed index, which needs the key provider before the registry is loaded.
+func TestOpenBoltStoreWithKeyProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+
+	r := types.NewSystemRegistry()
+	r.Register("Note", func() store.Storable { return &Note{} })
+	s, err := types.OpenBoltStore(path, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := &Note{Title: "secret"}
+	if err := s.AllocateId(n); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(n); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	hashed := func() *types.SystemRegistry {
+		r := types.NewSystemRegistry()
+		r.Register("Note", func() store.Storable { return &Note{} })
+		r.Index("Note", "Title", store.StringIndex, store.NonUniqueIndex)
+		r.HashIndex("Note", "Title")
+		r.SetEncrypted("Note", true)
+		return r
+	}
+
+	if _, err := types.OpenBoltStore(path, hashed()); !errors.Is(err, fault.ErrNoKeyProvider) {
+		t.Fatalf("OpenBoltStore without a key provider returned %v, want %v", err, fault.ErrNoKeyProvider)
+	}
+
+	s, err = types.OpenBoltStore(path, hashed(), types.WithKeyProvider(staticKeys{}), types.WithCompression(&store.CompressionOptions{Algorithm: store.FlateCompression}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	found, err := s.Match("Note.Title", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].GetId().String() != n.Id.String() {
+		t.Fatalf("Match found %v, want %s", found, n.Id)
+	}
+}
+
+// TestRegistriesAreIndependent opens two stores with registries holding
+// different types and checks that neither sees the other's types, and that a
+// registry cannot be loaded into a second store.
+func TestRegistriesAreIndependent(t *testing.T) {
+	notes := types.NewSystemRegistry()
+	notes.Register("Note", func() store.Storable { return &Note{} })
+	s1, err := types.OpenBoltStore(filepath.Join(t.TempDir(), "notes"), notes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s1.Close()
+
+	empty := types.NewSystemRegistry()
+	s2, err := types.OpenBoltStore(filepath.Join(t.TempDir(), "empty"), empty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s2.Close()
+
+	if err := s1.AllocateId(&Note{}); err != nil {
+		t.Errorf("AllocateId in the store with Notes: %v", err)
+	}
+	if err := s2.AllocateId(&Note{}); !errors.Is(err, fault.ErrTypeNotFound) {
+		t.Errorf("AllocateId in the store without Notes returned %v, want %v", err, fault.ErrTypeNotFound)
+	}
+	if s1.TypeManager() != notes || s2.TypeManager() != empty {
+		t.Error("the stores do not use the registries they were opened with")
+	}
+
+	if _, err := types.OpenBoltStore(filepath.Join(t.TempDir(), "other"), notes); !errors.Is(err, fault.ErrRegistryInUse) {
+		t.Errorf("OpenBoltStore with a registry in use returned %v, want %v", err, fault.ErrRegistryInUse)
+	}
+}
@@ -0,0 +1,242 @@
+package types
+
+import (
+	"strings"
+
+	"github.com/guyvdb/dstore/fault"
+	"github.com/guyvdb/dstore/store"
+)
+
+// FamilyFactory creates an instance of one type of a type family.
+type FamilyFactory func(typeName string) store.Storable
+
+// typeFamily is a set of types that share a name prefix and a factory, such as
+// the dynamic types DynamicObject.Invoice and DynamicObject.Customer.
+type typeFamily struct {
+	prefix  string
+	factory FamilyFactory
+}
+
+// RegisterFamily registers every type whose name starts with prefix. Members of
+// the family are not registered one by one: Load picks up the ones found in the
+// store, keeping their persisted indexes, and a new member is added the first
+// time an id is allocated for it.
+func (r *SystemRegistry) RegisterFamily(prefix string, factory FamilyFactory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, family := range r.families {
+		if family.prefix == prefix {
+			family.factory = factory
+			return
+		}
+	}
+	r.families = append(r.families, &typeFamily{prefix: prefix, factory: factory})
+}
+
+// AddType registers a type while the registry may already be loaded. Before Load
+// it is the same as Register followed by Index for every index. After Load the
+// type id is allocated, or looked up if the type was persisted by an earlier run,
+// and the indexes are built straight away. Adding a type that is already
+// registered does nothing.
+func (r *SystemRegistry) AddType(typeName string, factory TypeFactory, indexes ...*store.IndexDefinition) error {
+	r.mu.Lock()
+	s := r.store
+	if s == nil {
+		defer r.mu.Unlock()
+		r.registerItem(typeName, factory, indexes)
+		return nil
+	}
+	_, exists := r.typeNameIndex[typeName]
+	r.mu.Unlock()
+
+	if exists {
+		return nil
+	}
+
+	return s.Update(func(tx store.Tx) error {
+		changes, err := r.addType(tx, typeName, factory, indexes, false)
+		if err != nil {
+			return err
+		}
+		if err := r.applyIndexChanges(tx, changes); err != nil {
+			return err
+		}
+		return tx.UpgradeIndexes()
+	})
+}
+
+// registerItem adds a RegistryItem for a type that has not been loaded yet,
+// replacing the factory and indexes of an earlier registration. The caller must
+// hold r.mu.
+func (r *SystemRegistry) registerItem(typeName string, factory TypeFactory, indexes []*store.IndexDefinition) *RegistryItem {
+	item := r.registeredItem(typeName)
+	if item != nil {
+		item.Factory = factory
+	} else {
+		item = NewRegistryItem(typeName, factory)
+		r.items = append(r.items, item)
+	}
+	for _, index := range indexes {
+		item.addIndex(index)
+	}
+	return item
+}
+
+// addType registers a type in a loaded registry within tx. A type persisted by
+// an earlier run keeps its type id; when adopt is set it also keeps its persisted
+// indexes and schema version, as members of a type family do. The type is
+// removed again if tx rolls back. The caller must not hold r.mu.
+func (r *SystemRegistry) addType(tx store.Tx, typeName string, factory TypeFactory, indexes []*store.IndexDefinition, adopt bool) ([]indexChange, error) {
+	r.mu.RLock()
+	_, exists := r.typeNameIndex[typeName]
+	r.mu.RUnlock()
+	if exists {
+		return nil, nil
+	}
+
+	persisted, err := r.persistedItem(tx, typeName)
+	if err != nil {
+		return nil, err
+	}
+
+	var p pending
+	item, changes, err := r.registerType(typeName, factory, indexes, adopt, persisted, &p)
+	if err != nil || item == nil {
+		return nil, err
+	}
+
+	tx.OnRollback(func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.removeItem(item)
+	})
+	return changes, p.put(tx)
+}
+
+// registerType is the part of addType that runs under r.mu. It returns a nil
+// item if the type was registered in the meantime.
+func (r *SystemRegistry) registerType(typeName string, factory TypeFactory, indexes []*store.IndexDefinition, adopt bool, persisted *RegistryItem, p *pending) (*RegistryItem, []indexChange, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.typeNameIndex[typeName]; exists {
+		return nil, nil, nil
+	}
+
+	item := r.registerItem(typeName, factory, indexes)
+
+	var changes []indexChange
+	if persisted != nil {
+		if adopt {
+			adoptPersisted(item, persisted)
+		}
+		var err error
+		if changes, err = r.updateTypeInfo(persisted, p); err != nil {
+			r.removeItem(item)
+			return nil, nil, err
+		}
+	} else {
+		r.allocateNewType(item, p)
+	}
+
+	r.typeIdIndex[item.TypeId] = item
+	r.typeNameIndex[item.TypeName] = item
+	return item, changes, nil
+}
+
+// persistedItem returns the persisted RegistryItem of typeName, or nil if the
+// type has never been stored.
+func (r *SystemRegistry) persistedItem(tx store.Tx, typeName string) (*RegistryItem, error) {
+	var found *RegistryItem
+	err := tx.Iterate(REGISTRY_ITEM_TYPE_ID, func(s store.Storable) bool {
+		if ri := s.(*RegistryItem); ri.TypeName == typeName {
+			found = ri
+			return false
+		}
+		return true
+	})
+	return found, err
+}
+
+// removeItem forgets a type whose registration was rolled back. The caller must
+// hold r.mu.
+func (r *SystemRegistry) removeItem(item *RegistryItem) {
+	for i, candidate := range r.items {
+		if candidate == item {
+			r.items = append(r.items[:i], r.items[i+1:]...)
+			break
+		}
+	}
+	if r.typeIdIndex[item.TypeId] == item {
+		delete(r.typeIdIndex, item.TypeId)
+	}
+	if r.typeNameIndex[item.TypeName] == item {
+		delete(r.typeNameIndex, item.TypeName)
+	}
+}
+
+// familyOf returns the type family typeName belongs to, or nil. The caller must
+// hold r.mu.
+func (r *SystemRegistry) familyOf(typeName string) *typeFamily {
+	for _, family := range r.families {
+		if strings.HasPrefix(typeName, family.prefix) && len(typeName) > len(family.prefix) {
+			return family
+		}
+	}
+	return nil
+}
+
+// familyItem creates the RegistryItem of a type family member found in the
+// store during Load. The caller must hold r.mu.
+func (r *SystemRegistry) familyItem(persisted *RegistryItem) *RegistryItem {
+	family := r.familyOf(persisted.TypeName)
+	if family == nil {
+		return nil
+	}
+	item := NewRegistryItem(persisted.TypeName, familyTypeFactory(family, persisted.TypeName))
+	adoptPersisted(item, persisted)
+	r.items = append(r.items, item)
+	return item
+}
+
+// addFamilyTypes registers the members of type families among items that are
+// not registered yet, so that ids can be allocated for them. The caller must
+// not hold r.mu.
+func (r *SystemRegistry) addFamilyTypes(tx store.Tx, items []store.Storable) error {
+	for _, item := range items {
+		typeName := item.GetTypeName()
+
+		r.mu.RLock()
+		_, exists := r.typeNameIndex[typeName]
+		family := r.familyOf(typeName)
+		r.mu.RUnlock()
+
+		if exists {
+			continue
+		}
+		if family == nil {
+			return fault.ErrTypeNotFound
+		}
+		if _, err := r.addType(tx, typeName, familyTypeFactory(family, typeName), nil, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// familyTypeFactory binds a family factory to one of its members.
+func familyTypeFactory(family *typeFamily, typeName string) TypeFactory {
+	return func() store.Storable {
+		return family.factory(typeName)
+	}
+}
+
+// adoptPersisted takes the indexes, schema version and schema of a persisted type as its
+// declaration, so Load and addType see nothing to change.
+func adoptPersisted(item *RegistryItem, persisted *RegistryItem) {
+	item.Indexes = make([]*store.IndexDefinition, len(persisted.Indexes))
+	copy(item.Indexes, persisted.Indexes)
+	item.SchemaVersion = max(persisted.SchemaVersion, 1)
+	item.Schema = persisted.Schema
+}
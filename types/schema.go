@@ -0,0 +1,96 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/guyvdb/dstore/fault"
+	"github.com/guyvdb/dstore/store"
+)
+
+// SetSchema attaches a JSON schema to typeName. The registry stores it with the
+// type without interpreting it; objects of the type that implement store.Validatable
+// are checked against it on Put. Before Load the schema is persisted when the
+// registry is loaded, afterwards it is persisted straight away. A nil schema
+// removes it.
+func (r *SystemRegistry) SetSchema(typeName string, schema []byte) error {
+	schema, err := compactSchema(schema)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	s := r.store
+	if s == nil {
+		defer r.mu.Unlock()
+		item := r.registeredItem(typeName)
+		if item == nil {
+			return fault.ErrTypeNotFound
+		}
+		item.Schema = schema
+		return nil
+	}
+	r.mu.Unlock()
+
+	return s.Update(func(tx store.Tx) error {
+		r.mu.Lock()
+		item, found := r.typeNameIndex[typeName]
+		if !found {
+			r.mu.Unlock()
+			return fault.ErrTypeNotFound
+		}
+		if bytes.Equal(item.Schema, schema) {
+			r.mu.Unlock()
+			return nil
+		}
+
+		previous := item.Schema
+		item.Schema = schema
+		persisted := item.snapshot()
+		r.mu.Unlock()
+
+		tx.OnRollback(func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			item.Schema = previous
+		})
+		return tx.Put(persisted)
+	})
+}
+
+// Schema returns the schema of typeId, or nil if it has none.
+func (r *SystemRegistry) Schema(typeId int64) []byte {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	info, found := r.typeIdIndex[typeId]
+	if !found {
+		return nil
+	}
+	return info.Schema
+}
+
+// registeredItem returns the RegistryItem of typeName, loaded or not. The caller
+// must hold r.mu.
+func (r *SystemRegistry) registeredItem(typeName string) *RegistryItem {
+	for _, item := range r.items {
+		if item.TypeName == typeName {
+			return item
+		}
+	}
+	return nil
+}
+
+// compactSchema checks that schema is JSON and compacts it the way it is
+// persisted, so an unchanged schema compares equal on the next Load.
+func compactSchema(schema []byte) ([]byte, error) {
+	if schema == nil {
+		return nil, nil
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, schema); err != nil {
+		return nil, fmt.Errorf("%w: %w", fault.ErrInvalidSchema, err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,158 @@
+package types
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/guyvdb/dstore/fault"
+	"github.com/guyvdb/dstore/store"
+)
+
+// The struct tag read by RegisterStruct. Supported forms are
+//
+//	dstore:"index"        a NonUniqueIndex on the field
+//	dstore:"index,unique" a UniqueIndex on the field
+//	dstore:"index,hashed" an index keyed by the HMAC of the value, see HashIndex
+const structTagName = "dstore"
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// structIndex is an index declared by a struct tag.
+type structIndex struct {
+	propertyName string
+	dataType     store.IndexDataType
+	indexType    store.IndexType
+	hashed       bool
+}
+
+// RegisterStruct registers the struct type T with r and declares an index for
+// every field tagged with `dstore:"index"`. The type name is the one returned by
+// GetTypeName on a new *T and the IndexDataType of each index is inferred from
+// the field's Go type. Nothing is registered if any tag is invalid or a tagged
+// field has a type that cannot be indexed.
+//
+//	err := types.RegisterStruct[Product](registry)
+func RegisterStruct[T any, PT interface {
+	*T
+	store.Storable
+}](r Registry) error {
+	typeName := PT(new(T)).GetTypeName()
+	if typeName == "" {
+		return fmt.Errorf("%T has an empty type name: %w", PT(nil), fault.ErrInvalidStructTag)
+	}
+
+	indexes, err := structIndexes(reflect.TypeFor[T]())
+	if err != nil {
+		return fmt.Errorf("register %s: %w", typeName, err)
+	}
+
+	r.Register(typeName, func() store.Storable {
+		return PT(new(T))
+	})
+	for _, idx := range indexes {
+		r.Index(typeName, idx.propertyName, idx.dataType, idx.indexType)
+		if idx.hashed {
+			r.HashIndex(typeName, idx.propertyName)
+		}
+	}
+
+	return nil
+}
+
+// MustRegisterStruct is like RegisterStruct but panics if T cannot be registered.
+// It is intended for registering types during program initialisation.
+func MustRegisterStruct[T any, PT interface {
+	*T
+	store.Storable
+}](r Registry) {
+	if err := RegisterStruct[T, PT](r); err != nil {
+		panic(err)
+	}
+}
+
+// structIndexes parses the dstore tags of a struct type, including those of
+// embedded structs.
+func structIndexes(t reflect.Type) ([]structIndex, error) {
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%s is not a struct: %w", t, fault.ErrInvalidStructTag)
+	}
+
+	indexes := make([]structIndex, 0)
+	for _, field := range reflect.VisibleFields(t) {
+		tag, found := field.Tag.Lookup(structTagName)
+		if !found {
+			continue
+		}
+
+		indexType, hashed, err := parseStructTag(tag)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", field.Name, err)
+		}
+
+		if !field.IsExported() {
+			return nil, fmt.Errorf("field %s is not exported: %w", field.Name, fault.ErrInvalidStructTag)
+		}
+
+		dataType, err := indexDataTypeOf(field.Type)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", field.Name, err)
+		}
+
+		indexes = append(indexes, structIndex{
+			propertyName: field.Name,
+			dataType:     dataType,
+			indexType:    indexType,
+			hashed:       hashed,
+		})
+	}
+
+	return indexes, nil
+}
+
+// parseStructTag returns the IndexType declared by a dstore tag and whether
+// the index is hashed.
+func parseStructTag(tag string) (store.IndexType, bool, error) {
+	parts := strings.Split(tag, ",")
+	if strings.TrimSpace(parts[0]) != "index" {
+		return 0, false, fmt.Errorf("tag '%s' does not start with 'index': %w", tag, fault.ErrInvalidStructTag)
+	}
+
+	indexType := store.NonUniqueIndex
+	hashed := false
+	for _, option := range parts[1:] {
+		switch strings.TrimSpace(option) {
+		case "unique":
+			indexType = store.UniqueIndex
+		case "hashed":
+			hashed = true
+		default:
+			return 0, false, fmt.Errorf("tag '%s' has unknown option '%s': %w", tag, option, fault.ErrInvalidStructTag)
+		}
+	}
+
+	return indexType, hashed, nil
+}
+
+// indexDataTypeOf infers the IndexDataType for a field type. Unsigned types that
+// can hold values beyond the range of an int64 are rejected.
+func indexDataTypeOf(t reflect.Type) (store.IndexDataType, error) {
+	if t == timeType {
+		return store.DateTimeIndex, nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return store.StringIndex, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return store.Int64Index, nil
+	case reflect.Float32, reflect.Float64:
+		return store.Float64Index, nil
+	case reflect.Bool:
+		return store.BoolIndex, nil
+	}
+
+	return 0, fmt.Errorf("cannot index a field of type %s: %w", t, fault.ErrUnsupportedIndexDataType)
+}
@@ -0,0 +1,114 @@
+package types_test
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/guyvdb/dstore/fault"
+	"github.com/guyvdb/dstore/store"
+	"github.com/guyvdb/dstore/types"
+)
+
+type Base struct {
+	Id      *store.Id `json:"id"`
+	Created time.Time `json:"created" dstore:"index"`
+}
+
+type Item struct {
+	Base
+	Sku    string  `json:"sku" dstore:"index,unique"`
+	Qty    int32   `json:"qty" dstore:"index"`
+	Small  uint8   `json:"small" dstore:"index"`
+	Weight float32 `json:"weight" dstore:"index"`
+	Other  string  `json:"other"`
+}
+
+func (i *Item) GetId() *store.Id         { return i.Id }
+func (i *Item) SetId(id *store.Id)       { i.Id = id }
+func (i *Item) GetTypeName() string      { return "Item" }
+func (i *Item) Marshal() ([]byte, error) { return json.Marshal(i) }
+func (i *Item) Unmarshal(d []byte) error { return json.Unmarshal(d, i) }
+
+type Tagged struct {
+	Id   *store.Id
+	Tags []string `dstore:"index"`
+}
+
+func (g *Tagged) GetId() *store.Id         { return g.Id }
+func (g *Tagged) SetId(id *store.Id)       { g.Id = id }
+func (g *Tagged) GetTypeName() string      { return "Tagged" }
+func (g *Tagged) Marshal() ([]byte, error) { return json.Marshal(g) }
+func (g *Tagged) Unmarshal(d []byte) error { return json.Unmarshal(d, g) }
+
+type Misspelt struct {
+	Id   *store.Id
+	Name string `dstore:"index,uniq"`
+}
+
+func (m *Misspelt) GetId() *store.Id         { return m.Id }
+func (m *Misspelt) SetId(id *store.Id)       { m.Id = id }
+func (m *Misspelt) GetTypeName() string      { return "Misspelt" }
+func (m *Misspelt) Marshal() ([]byte, error) { return json.Marshal(m) }
+func (m *Misspelt) Unmarshal(d []byte) error { return json.Unmarshal(d, m) }
+
+func TestRegisterStruct(t *testing.T) {
+	r := types.NewSystemRegistry()
+	if err := types.RegisterStruct[Item](r); err != nil {
+		t.Fatal(err)
+	}
+	if err := types.RegisterStruct[Tagged](r); !errors.Is(err, fault.ErrUnsupportedIndexDataType) {
+		t.Errorf("RegisterStruct with an indexed slice returned %v, want %v", err, fault.ErrUnsupportedIndexDataType)
+	}
+	if err := types.RegisterStruct[Misspelt](r); !errors.Is(err, fault.ErrInvalidStructTag) {
+		t.Errorf("RegisterStruct with an unknown tag option returned %v, want %v", err, fault.ErrInvalidStructTag)
+	}
+
+	s, err := types.OpenBoltStore(filepath.Join(t.TempDir(), "db"), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	typeId, err := r.GetTypeId("Item")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]store.IndexDataType{
+		"Created": store.DateTimeIndex,
+		"Sku":     store.StringIndex,
+		"Qty":     store.Int64Index,
+		"Small":   store.Int64Index,
+		"Weight":  store.Float64Index,
+	}
+	indexes := r.Indexes(typeId)
+	if len(indexes) != len(want) {
+		t.Errorf("Item has %d indexes, want %d", len(indexes), len(want))
+	}
+	for _, index := range indexes {
+		if index.DataType != want[index.PropertyName] {
+			t.Errorf("index on %s has data type %s, want %s", index.PropertyName, index.DataType, want[index.PropertyName])
+		}
+		if unique := index.Type == store.UniqueIndex; unique != (index.PropertyName == "Sku") {
+			t.Errorf("index on %s has type %v", index.PropertyName, index.Type)
+		}
+	}
+
+	item := &Item{Sku: "a", Qty: 5, Small: 3, Weight: 1.5, Base: Base{Created: time.Now()}}
+	if err := s.AllocateId(item); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(item); err != nil {
+		t.Fatal(err)
+	}
+	for index, value := range map[string]interface{}{"Item.Qty": 5, "Item.Small": 3, "Item.Weight": 1.5, "Item.Sku": "a", "Item.Created": item.Created} {
+		if found, err := s.Match(index, value); err != nil || len(found) != 1 {
+			t.Errorf("Match(%s, %v) found %d, %v; want 1", index, value, len(found), err)
+		}
+	}
+	if _, err := s.Match("Item.Other", "x"); !errors.Is(err, fault.ErrIndexNotFound) {
+		t.Errorf("Match on an untagged field returned %v, want %v", err, fault.ErrIndexNotFound)
+	}
+}
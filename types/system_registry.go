@@ -1,7 +1,9 @@
 package types
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"log/slog"
 	"sync"
 
@@ -28,59 +30,81 @@ const REGISTRY_INFO_TYPE_ID int64 = 1
 const REGISTRY_INFO_OBJECT_ID int64 = 1
 const REGISTRY_ITEM_TYPE_ID int64 = 2
 
+// DefaultIdLeaseSize is the number of object ids reserved per type each time the
+// registry has to persist a new high-water mark.
+const DefaultIdLeaseSize int64 = 1000
+
 type RegistryItem struct {
-	Id           *store.Id                `json:"id"`           // The id of this RegistryItem
-	TypeName     string                   `json:"typeName"`     // The string name of the type that this item represents
-	TypeId       int64                    `json:"typeId"`       // The typeid of the type that this item represents
-	NextObjectId int64                    `json:"nextObjectId"` // The next object id for this typeid
-	Indexes      []*store.IndexDefinition `json:"indexes"`
-	Factory      TypeFactory              `json:"-"`
+	Id            *store.Id                 `json:"id"`           // The id of this RegistryItem
+	TypeName      string                    `json:"typeName"`     // The string name of the type that this item represents
+	TypeId        int64                     `json:"typeId"`       // The typeid of the type that this item represents
+	NextObjectId  int64                     `json:"nextObjectId"` // The high-water mark: no object id at or above it has been handed out
+	Indexes       []*store.IndexDefinition  `json:"indexes"`
+	SchemaVersion int                       `json:"schemaVersion"`    // The schema version objects of this type are written at
+	Schema        json.RawMessage           `json:"schema,omitempty"` // The schema objects of this type are validated against
+	Factory       TypeFactory               `json:"-"`
+	next          int64                     // The next object id to hand out, always below a committed NextObjectId on the fast path
+	migrations    map[int]MigrationFunc     // Migrations from a schema version to the next one
+	codec         store.Codec               // The codec objects are written with, nil for store.StorableCodec
+	compression   *store.CompressionOptions // Compression of stored objects, nil for the store wide options
+	encrypted     bool                      // Stored objects are encrypted
 }
 
 // Registry implements the store.Registry interface.
 // It provides a way to register types, create instances of those types,
 // and manage their persistence.
+//
+// A SystemRegistry is safe for concurrent use. The store calls back into the
+// registry, so mu is never held while calling into the store: operations that
+// persist registry state change and copy it under mu and write the copies once
+// mu is released.
 type SystemRegistry struct {
-	mu            sync.RWMutex // lock
+	mu            sync.RWMutex // guards everything below
 	info          *RegistryInfo
 	store         store.Store
 	items         []*RegistryItem // all the types that we know about
 	typeIdIndex   map[int64]*RegistryItem
 	typeNameIndex map[string]*RegistryItem
+	leaseSize     int64 // ids reserved per persisted high-water mark
+	indexProgress func(typeName, property string, done, total int)
+	families      []*typeFamily // types registered by name prefix
+	loadHooks     []func(tx store.Tx) error
 }
 
 // NewRegistry creates and returns a new Registry instance.
 func NewSystemRegistry() *SystemRegistry {
 	slog.Debug("NewSystemRegistry - create registry")
 	return &SystemRegistry{
-		items: make([]*RegistryItem, 0),
+		items:     make([]*RegistryItem, 0),
+		leaseSize: DefaultIdLeaseSize,
 		//index: make(map[int64]*RegistryItem),
 	}
 }
 
 func NewRegistryItem(typeName string, factory TypeFactory) *RegistryItem {
 	return &RegistryItem{
-		TypeName: typeName,
-		Factory:  factory,
-		Indexes:  make([]*store.IndexDefinition, 0),
+		TypeName:      typeName,
+		Factory:       factory,
+		Indexes:       make([]*store.IndexDefinition, 0),
+		SchemaVersion: 1,
 	}
 }
 
 // Register registers a new type with the registry.
 // It adds the typename and the factory during this phase of registation
 // later, on Load() it will assign the typeId assigned to this typename
-// or create a new typeid, if it is the first time seeing this type
+// or create a new typeid, if it is the first time seeing this type.
+// Registering a typename again replaces its factory.
 func (r *SystemRegistry) Register(typename string, factory TypeFactory) {
-	// r.mu.Lock()
-	// defer r.mu.Unlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
-	item := NewRegistryItem(typename, factory)
-	r.items = append(r.items, item)
+	r.registerItem(typename, factory, nil)
 }
 
 func (r *SystemRegistry) Index(typeName string, propertyName string, dataType store.IndexDataType, indexType store.IndexType) {
-	// r.mu.Lock()
-	// defer r.mu.Unlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
 	for _, item := range r.items {
 		if item.TypeName == typeName {
@@ -89,28 +113,193 @@ func (r *SystemRegistry) Index(typeName string, propertyName string, dataType st
 	}
 }
 
+// CompoundIndex declares an index called name over an ordered list of
+// properties. Queries pass a []interface{} with a value for each of the leading
+// components, e.g. Match("Order.CustomerCreated", []interface{}{customerId}) or a
+// Range over the last component with the others fixed. A UniqueIndex enforces
+// uniqueness of the combination.
+func (r *SystemRegistry) CompoundIndex(typeName string, name string, indexType store.IndexType, components ...store.IndexComponent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, item := range r.items {
+		if item.TypeName == typeName {
+			item.AddCompoundIndex(name, indexType, components)
+		}
+	}
+}
+
+// SetIdLeaseSize sets how many object ids are reserved per type each time the
+// high-water mark is persisted. A size of 1 persists every allocation. Ids that
+// were reserved but not handed out are skipped after a restart.
+func (r *SystemRegistry) SetIdLeaseSize(size int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if size < 1 {
+		size = 1
+	}
+	r.leaseSize = size
+}
+
+// AllocateId assigns the next object id of the item's type to the item.
 func (r *SystemRegistry) AllocateId(item store.Storable) error {
-	// r.mu.Lock()
-	// defer r.mu.Unlock()
+	return r.AllocateIds([]store.Storable{item})
+}
 
-	info, found := r.typeNameIndex[item.GetTypeName()]
-	if !found {
-		return fault.ErrTypeNotFound
+// AllocateIds assigns the next object ids of their types to items. Ids are handed
+// out from a leased block held in memory; the store is only written when a
+// block runs out, in which case a new high-water mark is persisted in its own
+// transaction.
+func (r *SystemRegistry) AllocateIds(items []store.Storable) error {
+	r.mu.Lock()
+	s := r.store
+	leased, err := r.allocateLeased(items)
+	r.mu.Unlock()
+
+	if err != nil || leased {
+		return err
 	}
 
-	id := store.NewId(info.TypeId, info.NextObjectId)
-	info.NextObjectId++
+	if s == nil {
+		return fault.ErrRegistryNotLoaded
+	}
 
-	slog.Debug("SystemRegistry.AllocateId() - allocate id", "typeName", item.GetTypeName(), "typeId", info.TypeId, "objectId", id.ObjectId, "id", id.String())
-	item.SetId(id)
+	return s.Update(func(tx store.Tx) error {
+		return r.AllocateIdsInTx(tx, items)
+	})
+}
 
-	err := r.store.Put(info)
-	if err != nil {
-		slog.Debug("error saving type information", "err", err)
+// AllocateIdInTx assigns the next object id of the item's type to the item,
+// persisting a new high-water mark in tx if the current lease is used up.
+func (r *SystemRegistry) AllocateIdInTx(tx store.Tx, item store.Storable) error {
+	return r.AllocateIdsInTx(tx, []store.Storable{item})
+}
+
+// AllocateIdsInTx assigns the next object ids of their types to items. Types
+// whose lease cannot cover the batch get a new high-water mark written in tx.
+// The in memory mark only moves once tx commits, so ids leased by a transaction
+// that rolls back are never handed out by the fast path. A rollback leaves a
+// gap but never hands out an id twice.
+//
+// The leases are persisted with r.mu released, during which the fast path may
+// hand out ids of any type in items up to its committed mark. The ids are only
+// assigned once every type is covered by its committed mark or a mark leased
+// in tx, leasing again if the fast path used up what a type had.
+func (r *SystemRegistry) AllocateIdsInTx(tx store.Tx, items []store.Storable) error {
+	if err := r.addFamilyTypes(tx, items); err != nil {
 		return err
 	}
 
-	return nil
+	type lease struct {
+		info      *RegistryItem
+		mark      int64
+		persisted *RegistryItem
+	}
+	// The marks leased in tx, which the fast path never hands out ids below.
+	leased := make(map[*RegistryItem]int64)
+	for {
+		r.mu.Lock()
+		counts, err := r.countByType(items)
+		if err != nil {
+			r.mu.Unlock()
+			return err
+		}
+
+		var leases []lease
+		for info, count := range counts {
+			if info.next+count <= max(info.NextObjectId, leased[info]) {
+				continue
+			}
+
+			mark := max(info.next, info.NextObjectId, leased[info]) + max(r.leaseSize, count)
+
+			// Persist a copy, the in memory NextObjectId is the committed mark.
+			persisted := info.snapshot()
+			persisted.NextObjectId = mark
+			leases = append(leases, lease{info: info, mark: mark, persisted: persisted})
+
+			slog.Debug("SystemRegistry.AllocateIdsInTx() - lease ids", "typeName", info.TypeName, "from", info.next, "mark", mark)
+		}
+
+		if len(leases) == 0 {
+			r.assignIds(items)
+			r.mu.Unlock()
+			return nil
+		}
+		r.mu.Unlock()
+
+		for _, l := range leases {
+			if err := tx.Put(l.persisted); err != nil {
+				slog.Debug("error saving type information", "err", err)
+				return err
+			}
+			leased[l.info] = l.mark
+
+			info, mark := l.info, l.mark
+			tx.OnCommit(func() {
+				r.mu.Lock()
+				defer r.mu.Unlock()
+				if mark > info.NextObjectId {
+					info.NextObjectId = mark
+				}
+			})
+		}
+	}
+}
+
+// allocateLeased assigns ids to items if the committed leases of all their
+// types can cover the batch, without touching the store. It returns false,
+// assigning nothing, if any type needs a new lease. The caller must hold r.mu.
+func (r *SystemRegistry) allocateLeased(items []store.Storable) (bool, error) {
+	// Members of a type family are registered on first use, which needs a write.
+	for _, item := range items {
+		if _, exists := r.typeNameIndex[item.GetTypeName()]; !exists && r.familyOf(item.GetTypeName()) != nil {
+			return false, nil
+		}
+	}
+
+	counts, err := r.countByType(items)
+	if err != nil {
+		return false, err
+	}
+
+	for info, count := range counts {
+		if info.next+count > info.NextObjectId {
+			return false, nil
+		}
+	}
+
+	r.assignIds(items)
+	return true, nil
+}
+
+// countByType returns how many ids each type in items needs. The caller must
+// hold r.mu.
+func (r *SystemRegistry) countByType(items []store.Storable) (map[*RegistryItem]int64, error) {
+	counts := make(map[*RegistryItem]int64)
+	for _, item := range items {
+		info, found := r.typeNameIndex[item.GetTypeName()]
+		if !found {
+			return nil, fault.ErrTypeNotFound
+		}
+		counts[info]++
+	}
+	return counts, nil
+}
+
+// assignIds hands out the next ids to items. The caller must hold r.mu and have
+// checked the types with countByType.
+func (r *SystemRegistry) assignIds(items []store.Storable) {
+	for _, item := range items {
+		info := r.typeNameIndex[item.GetTypeName()]
+
+		id := store.NewId(info.TypeId, info.next)
+		info.next++
+
+		slog.Debug("SystemRegistry.AllocateId() - allocate id", "typeName", item.GetTypeName(), "typeId", info.TypeId, "objectId", id.ObjectId, "id", id.String())
+		item.SetId(id)
+	}
 }
 
 // Instance creates a new instance of a Storable type given its typeId.
@@ -127,8 +316,8 @@ func (r *SystemRegistry) Instance(typeId int64) (store.Storable, error) {
 		return &RegistryItem{}, nil
 	}
 
-	// r.mu.RLock()
-	// defer r.mu.RUnlock()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 
 	// Otherwise it is a user defined types
 	info, found := r.typeIdIndex[typeId]
@@ -144,8 +333,8 @@ func (r *SystemRegistry) CreateInstance(typeId int64) (store.Storable, error) {
 }
 
 func (r *SystemRegistry) GetTypeId(typeName string) (int64, error) {
-	// r.mu.RLock()
-	// defer r.mu.RUnlock()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 
 	info, found := r.typeNameIndex[typeName]
 	if !found {
@@ -176,15 +365,18 @@ func (r *SystemRegistry) GetTypeName(typeId int64) (string, error) {
 }
 
 func (r *SystemRegistry) Indexes(typeId int64) []*store.IndexDefinition {
-	// r.mu.RLock()
-	// defer r.mu.RUnlock()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 
 	info, found := r.typeIdIndex[typeId]
 	if !found {
 		return []*store.IndexDefinition{}
 	}
 
-	return info.Indexes
+	// Return a copy so callers can range over it while Index appends.
+	indexes := make([]*store.IndexDefinition, len(info.Indexes))
+	copy(indexes, info.Indexes)
+	return indexes
 }
 
 // Load loads registry information from a store.
@@ -196,21 +388,68 @@ func (r *SystemRegistry) Indexes(typeId int64) []*store.IndexDefinition {
 //	be incremented.
 //	The nextObjectId for this typeId should be retreived.
 func (r *SystemRegistry) Load(s store.Store) error {
-	// r.mu.Lock()
-	// defer r.mu.Unlock()
-
-	var info *RegistryInfo
-
-	// save a reference to the store
-	r.store = s
-
 	// Allocate our buckets for RegistryInfo and RegistryItem
 	s.AllocateBucketIfNeeded(REGISTRY_INFO_TYPE_NAME)
 	s.AllocateBucketIfNeeded(REGISTRY_ITEM_TYPE_NAME)
 
+	// Everything else happens in one transaction, so a partially loaded
+	// registry is never persisted.
+	return s.Update(func(tx store.Tx) error {
+		changes, err := r.load(tx, s)
+		if err != nil {
+			return err
+		}
+
+		// The store looks indexes up through the registry, so index buckets are
+		// built and dropped without holding r.mu.
+		if err := r.applyIndexChanges(tx, changes); err != nil {
+			return err
+		}
+		if err := tx.UpgradeIndexes(); err != nil {
+			return err
+		}
+
+		r.mu.RLock()
+		hooks := r.loadHooks
+		r.mu.RUnlock()
+		for _, hook := range hooks {
+			if err := hook(tx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// OnLoad registers fn to run at the end of the transaction that loads the
+// registry, once the types and their indexes are in place. It is meant for
+// upgrading stored data, such as objects written by an earlier version of a
+// package, and must be called before Load.
+func (r *SystemRegistry) OnLoad(fn func(tx store.Tx) error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.loadHooks = append(r.loadHooks, fn)
+}
+
+// load reads the persisted registry state in tx and merges it with the
+// registered types. It returns the index buckets that have to be built or
+// dropped to match the declared indexes.
+func (r *SystemRegistry) load(tx store.Tx, s store.Store) ([]indexChange, error) {
+	// A registry hands out ids for one store only.
+	r.mu.RLock()
+	inUse := r.store != nil && r.store != s
+	r.mu.RUnlock()
+	if inUse {
+		return nil, fault.ErrRegistryInUse
+	}
+
+	var p pending
+
 	// The registry info
+	var info *RegistryInfo
 	infoId := store.NewId(REGISTRY_INFO_TYPE_ID, REGISTRY_INFO_OBJECT_ID)
-	item, err := s.Get(infoId)
+	item, err := tx.Get(infoId)
 
 	if err != nil {
 		slog.Debug("SystemRegistry.Load() - error getting registry info", "err", err)
@@ -222,31 +461,58 @@ func (r *SystemRegistry) Load(s store.Store) error {
 				NextTypeId:   1001,
 				NextObjectId: 1001,
 			}
-			s.Put(info)
+			p.setInfo(info)
 		} else {
-			return err
+			return nil, err
 		}
 	} else {
 		info = item.(*RegistryInfo)
 	}
 
-	r.info = info
-
 	// All type info that we know about
-	types, err := s.GetAll(REGISTRY_ITEM_TYPE_ID)
+	types, err := tx.GetAll(REGISTRY_ITEM_TYPE_ID)
 	if err != nil {
-		return err
+		return nil, err
 	}
+
+	changes, err := r.merge(s, info, types, &p)
+	if err != nil {
+		return nil, err
+	}
+	return changes, p.put(tx)
+}
+
+// merge takes the persisted registry info and types as the state of the
+// registry, allocating type ids for types seen for the first time. The records
+// that have to be persisted are added to p.
+func (r *SystemRegistry) merge(s store.Store, info *RegistryInfo, types []store.Storable, p *pending) ([]indexChange, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var changes []indexChange
+
+	r.info = info
+
 	for _, t := range types {
 		ri := t.(*RegistryItem)
-		r.updateTypeInfo(ri)
+		if !r.isRegistered(ri.TypeName) {
+			// Members of a type family are registered as they are found.
+			if r.familyItem(ri) == nil {
+				continue
+			}
+		}
+		typeChanges, err := r.updateTypeInfo(ri, p)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, typeChanges...)
 	}
 
 	// Check any types that may be new types
 	for _, ri := range r.items {
 		if ri.TypeId == 0 {
 			slog.Debug("SystemRegistry.allocateNewType() - allocate new type", "typeName", ri.TypeName)
-			r.allocateNewType(s, ri)
+			r.allocateNewType(ri, p)
 		}
 	}
 
@@ -258,10 +524,67 @@ func (r *SystemRegistry) Load(s store.Store) error {
 		r.typeNameIndex[ri.TypeName] = ri
 	}
 
+	// save a reference to the store
+	r.store = s
+
+	return changes, nil
+}
+
+// isRegistered reports whether typeName has been registered. The caller must
+// hold r.mu.
+func (r *SystemRegistry) isRegistered(typeName string) bool {
+	return r.registeredItem(typeName) != nil
+}
+
+// indexChange is an index bucket that Load has to build or drop.
+type indexChange struct {
+	typeName string
+	property string
+	drop     bool
+}
+
+// applyIndexChanges builds the buckets of newly declared indexes from the stored
+// objects and drops the buckets of indexes that are no longer declared.
+func (r *SystemRegistry) applyIndexChanges(tx store.Tx, changes []indexChange) error {
+	r.mu.RLock()
+	report := r.indexProgress
+	r.mu.RUnlock()
+
+	for _, change := range changes {
+		if change.drop {
+			if err := tx.DropIndex(change.typeName, change.property); err != nil {
+				return err
+			}
+			continue
+		}
+
+		slog.Info("SystemRegistry.Load() - building index", "typeName", change.typeName, "property", change.property)
+
+		var progress store.ProgressFunc
+		if report != nil {
+			progress = func(done, total int) {
+				report(change.typeName, change.property, done, total)
+			}
+		}
+		if err := tx.Reindex(change.typeName, change.property, progress); err != nil {
+			return fmt.Errorf("failed to build index %s.%s: %w", change.typeName, change.property, err)
+		}
+	}
 	return nil
 }
 
-func (r *SystemRegistry) allocateNewType(s store.Store, item *RegistryItem) {
+// SetIndexProgress sets a function that Load calls while it builds the index
+// buckets of indexes that were added to types that already have objects.
+func (r *SystemRegistry) SetIndexProgress(fn func(typeName, property string, done, total int)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.indexProgress = fn
+}
+
+// allocateNewType assigns a typeId to a type seen for the first time and adds
+// it and the registry info to p. The caller must hold r.mu.
+func (r *SystemRegistry) allocateNewType(item *RegistryItem, p *pending) {
 
 	// assign a type id
 	item.TypeId = r.info.NextTypeId
@@ -270,39 +593,145 @@ func (r *SystemRegistry) allocateNewType(s store.Store, item *RegistryItem) {
 	// assign an registry info id
 	item.Id = store.NewId(REGISTRY_ITEM_TYPE_ID, r.info.NextObjectId)
 	item.NextObjectId = 1
+	item.next = 1
 	r.info.NextObjectId++
 
 	slog.Debug("Allocate indexes: ", "typeName", item.TypeName, "indexes", item.Indexes)
 
-	// save the item to the store
-	err := s.Put(item)
-	if err != nil {
-		panic(err)
+	p.addItem(item)
+	p.setInfo(r.info)
+}
+
+// updateTypeInfo copies the persisted state of a type onto its registration.
+// The registered schema version and indexes are authoritative; when they have
+// moved on they are added to p, and the index buckets that have to be built or
+// dropped are returned. The caller must hold r.mu.
+func (r *SystemRegistry) updateTypeInfo(item *RegistryItem, p *pending) ([]indexChange, error) {
+	var changes []indexChange
+
+	for _, ri := range r.items {
+		if ri.TypeName != item.TypeName {
+			continue
+		}
+
+		ri.Id = item.Id
+		ri.TypeId = item.TypeId
+		ri.NextObjectId = item.NextObjectId
+		ri.next = item.NextObjectId
+
+		dirty := false
+
+		persisted := max(item.SchemaVersion, 1)
+		if persisted > ri.SchemaVersion {
+			return nil, fmt.Errorf("%s is stored at schema version %d, registered at %d: %w", ri.TypeName, persisted, ri.SchemaVersion, fault.ErrSchemaVersionTooNew)
+		}
+		if persisted < ri.SchemaVersion {
+			slog.Info("SystemRegistry.Load() - schema version changed", "typeName", ri.TypeName, "from", persisted, "to", ri.SchemaVersion)
+			dirty = true
+		}
+
+		// A declared schema replaces the persisted one; types declared without a
+		// schema keep theirs, as schemas are usually set at runtime.
+		if ri.Schema == nil {
+			ri.Schema = item.Schema
+		} else if !bytes.Equal(ri.Schema, item.Schema) {
+			slog.Info("SystemRegistry.Load() - schema changed", "typeName", ri.TypeName)
+			dirty = true
+		}
+
+		// Declared indexes are authoritative. Indexes that are new or whose
+		// definition changed are rebuilt, persisted ones that are no longer
+		// declared are dropped.
+		for _, idx := range ri.Indexes {
+			if !containsIndex(item.Indexes, idx) {
+				slog.Info("SystemRegistry.Load() - index added", "typeName", ri.TypeName, "propertyName", idx.PropertyName, "type", idx.Type)
+				changes = append(changes, indexChange{typeName: ri.TypeName, property: idx.PropertyName})
+				dirty = true
+			}
+		}
+		for _, idx := range item.Indexes {
+			if !declaresProperty(ri.Indexes, idx.PropertyName) {
+				slog.Info("SystemRegistry.Load() - index removed", "typeName", ri.TypeName, "propertyName", idx.PropertyName)
+				changes = append(changes, indexChange{typeName: ri.TypeName, property: idx.PropertyName, drop: true})
+				dirty = true
+			}
+		}
+
+		if dirty {
+			p.addItem(ri)
+		}
 	}
+	return changes, nil
+}
 
-	// save the registry info to the store
-	err = s.Put(r.info)
-	if err != nil {
-		panic(err)
+// pending holds copies of registry records taken under r.mu, to be persisted
+// once it is released.
+type pending struct {
+	items []*RegistryItem
+	info  *RegistryInfo
+}
+
+// addItem adds a copy of item.
+func (p *pending) addItem(item *RegistryItem) {
+	p.items = append(p.items, item.snapshot())
+}
+
+// setInfo sets a copy of info, replacing an earlier one.
+func (p *pending) setInfo(info *RegistryInfo) {
+	copied := *info
+	p.info = &copied
+}
+
+// put persists the records in tx.
+func (p *pending) put(tx store.Tx) error {
+	for _, item := range p.items {
+		if err := tx.Put(item); err != nil {
+			return err
+		}
+	}
+	if p.info != nil {
+		return tx.Put(p.info)
 	}
+	return nil
+}
 
+// containsIndex reports whether indexes holds an identical definition of idx.
+func containsIndex(indexes []*store.IndexDefinition, idx *store.IndexDefinition) bool {
+	for _, candidate := range indexes {
+		if candidate.Equal(idx) {
+			return true
+		}
+	}
+	return false
 }
 
-func (r *SystemRegistry) updateTypeInfo(item *RegistryItem) {
-	for _, ri := range r.items {
-		if ri.TypeName == item.TypeName {
-			ri.Id = item.Id
-			ri.TypeId = item.TypeId
-			ri.NextObjectId = item.NextObjectId
-			ri.Indexes = make([]*store.IndexDefinition, len(item.Indexes))
-			copy(ri.Indexes, item.Indexes)
-			if len(ri.Indexes) > 0 {
-				for _, idx := range ri.Indexes {
-					slog.Debug("Index: ", "typeName", ri.TypeName, "propertyName", idx.PropertyName, "type", idx.Type)
-				}
-			}
+// declaresProperty reports whether indexes holds a definition for property.
+func declaresProperty(indexes []*store.IndexDefinition, property string) bool {
+	for _, candidate := range indexes {
+		if candidate.PropertyName == property {
+			return true
 		}
 	}
+	return false
+}
+
+// snapshot returns a copy of the persisted fields of ri that does not share the
+// index definitions, which HashIndex changes in place.
+func (ri *RegistryItem) snapshot() *RegistryItem {
+	indexes := make([]*store.IndexDefinition, len(ri.Indexes))
+	for i, index := range ri.Indexes {
+		copied := *index
+		indexes[i] = &copied
+	}
+	return &RegistryItem{
+		Id:            ri.Id,
+		TypeName:      ri.TypeName,
+		TypeId:        ri.TypeId,
+		NextObjectId:  ri.NextObjectId,
+		Indexes:       indexes,
+		SchemaVersion: ri.SchemaVersion,
+		Schema:        ri.Schema,
+	}
 }
 
 // GetId returns the Id of the RegistryItem.
@@ -318,14 +747,36 @@ func (ri *RegistryItem) GetTypeName() string {
 	return REGISTRY_ITEM_TYPE_NAME
 }
 
+// AddIndex declares an index on propertyName, replacing any earlier declaration
+// for the same property.
 func (ri *RegistryItem) AddIndex(propertyName string, dataType store.IndexDataType, indexType store.IndexType) {
-	ri.Indexes = append(ri.Indexes, &store.IndexDefinition{
+	ri.addIndex(&store.IndexDefinition{
 		PropertyName: propertyName,
 		DataType:     dataType,
 		Type:         indexType,
 	})
 }
 
+// AddCompoundIndex declares a compound index called name, replacing any earlier
+// declaration with the same name.
+func (ri *RegistryItem) AddCompoundIndex(name string, indexType store.IndexType, components []store.IndexComponent) {
+	ri.addIndex(&store.IndexDefinition{
+		PropertyName: name,
+		Type:         indexType,
+		Components:   append([]store.IndexComponent(nil), components...),
+	})
+}
+
+func (ri *RegistryItem) addIndex(index *store.IndexDefinition) {
+	for i, idx := range ri.Indexes {
+		if idx.PropertyName == index.PropertyName {
+			ri.Indexes[i] = index
+			return
+		}
+	}
+	ri.Indexes = append(ri.Indexes, index)
+}
+
 // Marshal serializes the RegistryItem to a byte slice.
 func (ri *RegistryItem) Marshal() ([]byte, error) {
 	return json.Marshal(ri)
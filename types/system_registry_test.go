@@ -0,0 +1,408 @@
+package types_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/guyvdb/dstore/fault"
+	"github.com/guyvdb/dstore/store"
+	"github.com/guyvdb/dstore/types"
+)
+
+type Note struct {
+	Id    *store.Id `json:"id"`
+	Title string    `json:"title"`
+}
+
+func (n *Note) GetId() *store.Id         { return n.Id }
+func (n *Note) SetId(id *store.Id)       { n.Id = id }
+func (n *Note) GetTypeName() string      { return "Note" }
+func (n *Note) Marshal() ([]byte, error) { return json.Marshal(n) }
+func (n *Note) Unmarshal(d []byte) error { return json.Unmarshal(d, n) }
+
+// Memo is a second type, so that batches can span types.
+type Memo struct{ Note }
+
+func (m *Memo) GetTypeName() string { return "Memo" }
+
+// openRegistry opens a store at path with Note registered and indexed on Title,
+// and Memo registered.
+func openRegistry(t *testing.T, path string, leaseSize int64) (store.Store, *types.SystemRegistry) {
+	t.Helper()
+	r := types.NewSystemRegistry()
+	r.Register("Note", func() store.Storable { return &Note{} })
+	r.Index("Note", "Title", store.StringIndex, store.NonUniqueIndex)
+	r.Register("Memo", func() store.Storable { return &Memo{} })
+	r.SetIdLeaseSize(leaseSize)
+	s, err := store.NewBoltStore(path, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Load(s); err != nil {
+		s.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s, r
+}
+
+// TestConcurrentAllocateIds allocates ids from many goroutines while others
+// read type information, add types and store objects. A lease size of 1
+// persists the registry on every allocation. Run it with -race.
+func TestConcurrentAllocateIds(t *testing.T) {
+	for _, leaseSize := range []int64{1, 7, types.DefaultIdLeaseSize} {
+		t.Run(fmt.Sprint(leaseSize), func(t *testing.T) {
+			s, r := openRegistry(t, filepath.Join(t.TempDir(), "db"), leaseSize)
+
+			const goroutines, perGoroutine = 16, 40
+			var mu sync.Mutex
+			seen := make(map[string]bool)
+			var wg sync.WaitGroup
+
+			for g := 0; g < goroutines; g++ {
+				wg.Add(1)
+				go func(g int) {
+					defer wg.Done()
+					for i := 0; i < perGoroutine; i++ {
+						n := &Note{Title: fmt.Sprintf("%d-%d", g, i)}
+						if err := r.AllocateId(n); err != nil {
+							t.Error(err)
+							return
+						}
+						r.Indexes(n.Id.TypeId)
+						r.SchemaVersion(n.Id.TypeId)
+						if _, err := r.GetTypeName(n.Id.TypeId); err != nil {
+							t.Error(err)
+						}
+
+						mu.Lock()
+						if seen[n.Id.String()] {
+							t.Errorf("id %s allocated twice", n.Id)
+						}
+						seen[n.Id.String()] = true
+						mu.Unlock()
+
+						if i%8 == 0 {
+							if err := s.Put(n); err != nil {
+								t.Error(err)
+							}
+						}
+					}
+				}(g)
+			}
+
+			// Register and index types while ids are allocated.
+			for g := 0; g < 4; g++ {
+				wg.Add(1)
+				go func(g int) {
+					defer wg.Done()
+					typeName := fmt.Sprintf("Extra%d", g)
+					index := &store.IndexDefinition{PropertyName: "Title", DataType: store.StringIndex, Type: store.NonUniqueIndex}
+					if err := r.AddType(typeName, func() store.Storable { return &Note{} }, index); err != nil {
+						t.Error(err)
+					}
+					r.Index(typeName, "Title", store.StringIndex, store.NonUniqueIndex)
+					if err := r.SetSchema(typeName, []byte(`{"type":"object"}`)); err != nil {
+						t.Error(err)
+					}
+				}(g)
+			}
+			wg.Wait()
+
+			if len(seen) != goroutines*perGoroutine {
+				t.Fatalf("allocated %d distinct ids, want %d", len(seen), goroutines*perGoroutine)
+			}
+		})
+	}
+}
+
+// TestAllocateIdsAfterRestart checks that ids leased before a restart, or by a
+// transaction that rolled back, are never handed out again.
+func TestAllocateIdsAfterRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	s, _ := openRegistry(t, path, 10)
+
+	var highest int64
+	for i := 0; i < 15; i++ {
+		n := &Note{}
+		if err := s.AllocateId(n); err != nil {
+			t.Fatal(err)
+		}
+		highest = n.Id.ObjectId
+	}
+
+	rollback := fmt.Errorf("rollback")
+	err := s.Update(func(tx store.Tx) error {
+		items := make([]store.Storable, 30)
+		for i := range items {
+			items[i] = &Note{}
+		}
+		if err := tx.AllocateIds(items); err != nil {
+			return err
+		}
+		highest = items[len(items)-1].GetId().ObjectId
+		return rollback
+	})
+	if err != rollback {
+		t.Fatalf("Update returned %v, want the rollback error", err)
+	}
+
+	n := &Note{}
+	if err := s.AllocateId(n); err != nil {
+		t.Fatal(err)
+	}
+	if n.Id.ObjectId <= highest {
+		t.Fatalf("id %d after rollback reuses an id up to %d", n.Id.ObjectId, highest)
+	}
+	highest = n.Id.ObjectId
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, _ = openRegistry(t, path, 10)
+	n = &Note{}
+	if err := s.AllocateId(n); err != nil {
+		t.Fatal(err)
+	}
+	if n.Id.ObjectId <= highest {
+		t.Fatalf("id %d after restart reuses an id up to %d", n.Id.ObjectId, highest)
+	}
+}
+
+// TestIdLeases checks that ids are handed out from a leased block, so that a
+// restart continues after the block rather than after the last id used.
+func TestIdLeases(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	s, _ := openRegistry(t, path, 10)
+
+	items := []store.Storable{&Note{}, &Note{}, &Note{}}
+	if err := s.AllocateIds(items); err != nil {
+		t.Fatal(err)
+	}
+	for i, item := range items {
+		if got := item.GetId().ObjectId; got != int64(i+1) {
+			t.Errorf("id %d of the first block = %d, want %d", i, got, i+1)
+		}
+	}
+
+	// A batch larger than the rest of the lease leases all its ids in one go,
+	// past the end of the first block at 11.
+	batch := make([]store.Storable, 25)
+	for i := range batch {
+		batch[i] = &Note{}
+	}
+	if err := s.AllocateIds(batch); err != nil {
+		t.Fatal(err)
+	}
+	if first, last := batch[0].GetId().ObjectId, batch[24].GetId().ObjectId; last-first != 24 {
+		t.Errorf("batch of 25 got ids %d to %d, want consecutive ids", first, last)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, _ = openRegistry(t, path, 10)
+	n := &Note{}
+	if err := s.AllocateId(n); err != nil {
+		t.Fatal(err)
+	}
+	if n.Id.ObjectId != 36 {
+		t.Errorf("first id after restart = %d, want 36, the end of the batch's lease", n.Id.ObjectId)
+	}
+}
+
+// interleavedTx calls between before its first Put, to run code while
+// AllocateIdsInTx persists its leases.
+type interleavedTx struct {
+	store.Tx
+	between func()
+}
+
+func (tx *interleavedTx) Put(item store.Storable) error {
+	if between := tx.between; between != nil {
+		tx.between = nil
+		between()
+	}
+	return tx.Tx.Put(item)
+}
+
+// TestAllocateIdsInTxRechecksLeases allocates a Memo from the fast path while a
+// batch leases ids for a Note, taking the last Memo id the batch counted on.
+func TestAllocateIdsInTxRechecksLeases(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	s, r := openRegistry(t, path, 10)
+
+	// Memo ids 1 to 9 of the lease up to 11.
+	for i := 0; i < 9; i++ {
+		if err := r.AllocateId(&Memo{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	note, memo, between := &Note{}, &Memo{}, &Memo{}
+	err := s.Update(func(tx store.Tx) error {
+		itx := &interleavedTx{Tx: tx, between: func() {
+			if err := r.AllocateId(between); err != nil {
+				t.Error(err)
+			}
+		}}
+		return r.AllocateIdsInTx(itx, []store.Storable{note, memo})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if between.Id == nil || between.Id.ObjectId != 10 {
+		t.Fatalf("Memo allocated during the batch got %v, want object id 10", between.Id)
+	}
+	if memo.Id.ObjectId != 11 {
+		t.Errorf("Memo of the batch got object id %d, want 11", memo.Id.ObjectId)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, _ = openRegistry(t, path, 10)
+	after := &Memo{}
+	if err := s.AllocateId(after); err != nil {
+		t.Fatal(err)
+	}
+	if after.Id.ObjectId <= memo.Id.ObjectId {
+		t.Errorf("first Memo id after restart = %d, which the batch handed out before", after.Id.ObjectId)
+	}
+}
+
+// TestConcurrentAllocateIdsInTx mixes batches allocated from the fast path
+// with batches allocated in transactions, and checks that no id is handed out
+// twice, before or after a restart. Run it with -race.
+func TestConcurrentAllocateIdsInTx(t *testing.T) {
+	for _, leaseSize := range []int64{1, 3, 7} {
+		t.Run(fmt.Sprint(leaseSize), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "db")
+			s, r := openRegistry(t, path, leaseSize)
+
+			const goroutines, perGoroutine = 8, 30
+			var mu sync.Mutex
+			seen := make(map[string]bool)
+			highest := make(map[string]int64)
+			record := func(items []store.Storable) {
+				mu.Lock()
+				defer mu.Unlock()
+				for _, item := range items {
+					if seen[item.GetId().String()] {
+						t.Errorf("id %s allocated twice", item.GetId())
+					}
+					seen[item.GetId().String()] = true
+					highest[item.GetTypeName()] = max(highest[item.GetTypeName()], item.GetId().ObjectId)
+				}
+			}
+
+			var wg sync.WaitGroup
+			for g := 0; g < goroutines; g++ {
+				wg.Add(1)
+				go func(g int) {
+					defer wg.Done()
+					for i := 0; i < perGoroutine; i++ {
+						items := []store.Storable{&Note{}, &Memo{}}
+						var err error
+						switch {
+						case g%2 == 0:
+							err = r.AllocateIds(items)
+						default:
+							err = s.Update(func(tx store.Tx) error {
+								if err := tx.AllocateIds(items[:1]); err != nil {
+									return err
+								}
+								return tx.AllocateId(items[1])
+							})
+						}
+						if err != nil {
+							t.Error(err)
+							return
+						}
+						record(items)
+					}
+				}(g)
+			}
+			wg.Wait()
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			s, _ = openRegistry(t, path, leaseSize)
+			for _, item := range []store.Storable{&Note{}, &Memo{}} {
+				if err := s.AllocateId(item); err != nil {
+					t.Fatal(err)
+				}
+				if got, before := item.GetId().ObjectId, highest[item.GetTypeName()]; got <= before {
+					t.Errorf("first %s id after restart = %d, at or below %d handed out before", item.GetTypeName(), got, before)
+				}
+			}
+		})
+	}
+}
+
+// TestIndexBackfill adds an index to a type that already has objects and checks
+// that Load builds it once, and that removing it from the registry drops it.
+func TestIndexBackfill(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	const objects = 2500
+
+	open := func(indexed bool, progress func(typeName, property string, done, total int)) store.Store {
+		t.Helper()
+		r := types.NewSystemRegistry()
+		r.Register("Note", func() store.Storable { return &Note{} })
+		if indexed {
+			r.Index("Note", "Title", store.StringIndex, store.NonUniqueIndex)
+		}
+		r.SetIndexProgress(progress)
+		s, err := types.OpenBoltStore(path, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	noProgress := func(typeName, property string, done, total int) {
+		t.Errorf("Load built %s.%s when it had nothing to build", typeName, property)
+	}
+
+	s := open(false, noProgress)
+	items := make([]store.Storable, objects)
+	for i := range items {
+		items[i] = &Note{Title: fmt.Sprint("t", i%10)}
+	}
+	if err := s.AllocateIds(items); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PutAll(items); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	var reports []int
+	s = open(true, func(typeName, property string, done, total int) {
+		if typeName != "Note" || property != "Title" || total != objects {
+			t.Errorf("progress of %s.%s with total %d, want Note.Title with %d", typeName, property, total, objects)
+		}
+		reports = append(reports, done)
+	})
+	if len(reports) == 0 || reports[len(reports)-1] != objects {
+		t.Errorf("progress = %v, want it to end at %d", reports, objects)
+	}
+	if found, err := s.Match("Note.Title", "t3"); err != nil || len(found) != objects/10 {
+		t.Errorf("Match on the backfilled index found %d, %v; want %d", len(found), err, objects/10)
+	}
+	s.Close()
+
+	s = open(true, noProgress)
+	s.Close()
+
+	s = open(false, noProgress)
+	defer s.Close()
+	if _, err := s.Match("Note.Title", "t3"); !errors.Is(err, fault.ErrIndexNotFound) {
+		t.Errorf("Match on a removed index returned %v, want %v", err, fault.ErrIndexNotFound)
+	}
+}